@@ -16,15 +16,19 @@ func main() {
 	scanner := bufio.NewScanner(os.Stdin)
 REPL:
 	for {
-		lastInput = strings.TrimSpace(lastInput)
-		if lastInput == "" {
+		if strings.TrimSpace(lastInput) == "" {
+			lastInput = ""
 			fmt.Print("postgres# ")
 		} else {
 			fmt.Print("postgres> ")
 		}
 
-		scanner.Scan()
-		query := strings.ToLower(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		// the case of query is kept, keywords and unquoted names are folded
+		// to lower case by parser
+		query := scanner.Text()
 		if lastInput != "" {
 			query = lastInput + query
 			lastInput = ""
@@ -44,13 +48,16 @@ REPL:
 				showCommand(commandType, "")
 			}
 		case parser.QueryTypeNormal:
-			_, err := lexer.Lex(query)
+			result, err := lexer.Lex(query)
 			if err != nil {
 				fmt.Printf("Error: %s\n", err)
+				continue
 			}
+			showResult(result)
 		case parser.QueryTypeUnkown:
 			// When an unexpected \n or \r is coming, holds it for next loop
-			lastInput = query + " "
+			// with the newline, which ends the -- comment of the line
+			lastInput = query + "\n"
 		}
 	}
 }
@@ -67,3 +74,10 @@ func showCommand(c parser.CommandType, info string) {
 		fmt.Printf("invalid query: %s\n", info)
 	}
 }
+
+func showResult(r *storage.Result) {
+	if len(r.Columns) > 0 {
+		storage.ShowRows(r)
+	}
+	fmt.Println(r.Tag)
+}
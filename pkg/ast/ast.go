@@ -3,15 +3,32 @@ package ast
 type QueryStmtKind uint
 
 const (
-	QueryStmtKindCreate = iota
+	QueryStmtKindCreate QueryStmtKind = iota
+	QueryStmtKindInsert
+	QueryStmtKindSelect
+	QueryStmtKindUpdate
+	QueryStmtKindDelete
+	QueryStmtKindDrop
+	QueryStmtKindTruncate
+	QueryStmtKindAlter
+	QueryStmtKindPrepare
+	QueryStmtKindExecute
+	QueryStmtKindDeallocate
 	QueryStmtKindEmpty
 	QueryStmtKindUnkown
 )
 
+// QueryStmt is the statement composed by parser, it's implemented by all of
+// the QueryStmtXXX structs.
+type QueryStmt interface {
+	Kind() QueryStmtKind
+}
+
 type ColumnName string
 type ColumnKind uint8
-type ColumnValue string
-type Row []ColumnValue
+
+// Row is the values of a row in VALUES clause, like ('walker', 18, NULL).
+type Row []Expr
 
 func (c ColumnKind) String() string {
 	switch c {
@@ -19,85 +36,482 @@ func (c ColumnKind) String() string {
 		return "Int"
 	case ColumnKindText:
 		return "Text"
+	case ColumnKindFloat:
+		return "Float"
 	}
 	return ""
 }
 
+// Column is the definition of a column, default is nil if the column hasn't
+// DEFAULT clause, in which case its default value is NULL.
 type Column struct {
-	Name ColumnName `json:"name"`
-	Kind ColumnKind `json:"kind"`
+	Name    ColumnName `json:"name"`
+	Kind    ColumnKind `json:"kind"`
+	NotNull bool       `json:"not_null,omitempty"`
+	Default *Literal   `json:"default,omitempty"`
+}
+
+type ConstraintKind uint8
+
+const (
+	ConstraintKindPrimaryKey ConstraintKind = iota
+	ConstraintKindUnique
+	ConstraintKindForeignKey
+	ConstraintKindCheck
+)
+
+func (c ConstraintKind) String() string {
+	switch c {
+	case ConstraintKindPrimaryKey:
+		return "PRIMARY KEY"
+	case ConstraintKindUnique:
+		return "UNIQUE"
+	case ConstraintKindForeignKey:
+		return "FOREIGN KEY"
+	case ConstraintKindCheck:
+		return "CHECK"
+	}
+	return ""
+}
+
+// ReferentialAction is the action on the referencing rows of FOREIGN KEY when
+// the referenced rows are deleted or their keys are updated.
+type ReferentialAction uint8
+
+const (
+	ReferentialActionNoAction ReferentialAction = iota
+	ReferentialActionRestrict
+	ReferentialActionCascade
+	ReferentialActionSetNull
+)
+
+func (a ReferentialAction) String() string {
+	switch a {
+	case ReferentialActionNoAction:
+		return "NO ACTION"
+	case ReferentialActionRestrict:
+		return "RESTRICT"
+	case ReferentialActionCascade:
+		return "CASCADE"
+	case ReferentialActionSetNull:
+		return "SET NULL"
+	}
+	return ""
+}
+
+// Constraint is the constraint over columns of a table, like PRIMARY KEY (id)
+// or UNIQUE (name, city). The constraints written after a column definition
+// are composed to it as well, name is generated if it's not specified.
+// FOREIGN KEY references the columns of RefTable, which are the primary key
+// of RefTable if they're not specified. CHECK keeps the source of expression
+// in Check, and columns are the ones referred by it.
+type Constraint struct {
+	Name       string            `json:"name"`
+	Kind       ConstraintKind    `json:"kind"`
+	Columns    []ColumnName      `json:"columns"`
+	RefTable   string            `json:"ref_table,omitempty"`
+	RefColumns []ColumnName      `json:"ref_columns,omitempty"`
+	OnDelete   ReferentialAction `json:"on_delete,omitempty"`
+	OnUpdate   ReferentialAction `json:"on_update,omitempty"`
+	Check      string            `json:"check,omitempty"`
 }
 
 const (
 	ColumnKindText ColumnKind = iota + 1
 	ColumnKindInt
 	ColumnKindUnknown
+	// ColumnKindFloat is only for computed columns, like avg(age).
+	ColumnKindFloat
 )
 
 type QueryStmtCreateTable struct {
-	Name    string // TableName
-	Columns []Column
+	Name        string // TableName
+	Columns     []Column
+	Constraints []Constraint
 }
 
+func (s QueryStmtCreateTable) Kind() QueryStmtKind { return QueryStmtKindCreate }
+
+// QueryStmtInsertValues inserts Rows into table, or the rows returned by Query
+// if it isn't nil, like INSERT INTO t (a, b) SELECT x, y FROM o. The columns
+// could be listed in any order, and the ones not listed get their defaults.
 type QueryStmtInsertValues struct {
 	TableName          string
 	ColumnNames        []ColumnName
 	Rows               []Row
+	Query              Query
 	ContainsAllColumns bool
+	Returning          *Returning // nil if without RETURNING clause
 }
 
+func (s QueryStmtInsertValues) Kind() QueryStmtKind { return QueryStmtKindInsert }
+
 type CmpKind uint
 
 const (
-	CmpKindEq CmpKind = iota // ==
-	CmpKindNotEq
-	CmpKindGt  // >
-	CmpKindGte // >=
-	CmpKindLt  // <
-	CmpKindLte // <=
+	CmpKindEq    CmpKind = iota // = or ==
+	CmpKindNotEq                // != or <>
+	CmpKindGt                   // >
+	CmpKindGte                  // >=
+	CmpKindLt                   // <
+	CmpKindLte                  // <=
 )
 
-// Now just support simple selection based on value comparation, like:
-// SELECT ... FROM fdt WHERE c1 >/>=/</<=/!= 5
-type WhereClause struct {
-	Column ColumnName
-	Value  string
-	Cmp    CmpKind
+// NullsOrder is the position of NULLs in ORDER BY, by default NULLs are
+// last for ascending order and first for descending order.
+type NullsOrder uint8
+
+const (
+	NullsOrderDefault NullsOrder = iota
+	NullsOrderFirst
+	NullsOrderLast
+)
+
+// OrderBy is one sort key of ORDER BY clause, like age DESC NULLS LAST.
+type OrderBy struct {
+	Expr  Expr
+	Desc  bool
+	Nulls NullsOrder
 }
 
-// Tests if both column and value is empty.
-func (w WhereClause) IsEmpty() bool {
-	if w.Column == "" && w.Value == "" {
-		return true
-	}
-	return false
+// SelectColumn is one output column of SELECT, like name, count(*) or
+// age + 1 AS next, alias is empty if not specified.
+type SelectColumn struct {
+	Expr  Expr
+	Alias string
 }
 
-// Tests if either column or value is empty.
-func (w WhereClause) EitherEmpty() bool {
-	if w.IsEmpty() {
-		return false
-	}
-	if w.Column == "" || w.Value == "" {
-		return true
-	}
-	return false
+// Returning is the RETURNING clause of INSERT, UPDATE or DELETE, whose
+// columns are evaluated with the inserted, updated or deleted rows, like
+// RETURNING id, name or RETURNING * if ContainsAllColumns is true.
+type Returning struct {
+	Columns            []SelectColumn
+	ContainsAllColumns bool
 }
 
+type JoinKind uint8
+
+const (
+	JoinKindInner JoinKind = iota
+	JoinKindLeft
+	JoinKindRight
+	JoinKindFull
+	JoinKindCross
+)
+
+// Join joins a table to the tables before it in FROM clause, like
+// LEFT JOIN orders o ON u.id = o.uid, on is nil for CROSS JOIN.
+type Join struct {
+	Kind      JoinKind
+	TableName string
+	Alias     string
+	On        Expr
+}
+
+// QueryStmtSelectValues selects rows from tables, the duplicated rows are
+// removed if Distinct is true. With DistinctOn, only the first row of rows
+// whose values of DistinctOn are the same is kept, and Distinct is true too.
 type QueryStmtSelectValues struct {
+	Distinct           bool
+	DistinctOn         []Expr
 	TableName          string
-	ColumnNames        []ColumnName
+	Alias              string // alias of table, empty if not specified
+	Joins              []Join
+	Columns            []SelectColumn
 	ContainsAllColumns bool
-	Where              WhereClause
+	Where              Expr // nil if without WHERE clause
+	GroupBy            []Expr
+	Having             Expr // nil if without HAVING clause
+	OrderBy            []OrderBy
+	Limit              Expr // nil if without LIMIT clause or LIMIT ALL
+	Offset             Expr // nil if without OFFSET clause
+}
+
+func (s QueryStmtSelectValues) Kind() QueryStmtKind { return QueryStmtKindSelect }
+func (s QueryStmtSelectValues) query()              {}
+
+// Query is the statement returning rows, which is SELECT or set operation of
+// queries, so queries can be composed like SELECT ... UNION (SELECT ...).
+type Query interface {
+	QueryStmt
+	query()
+}
+
+type SetOp uint8
+
+const (
+	SetOpUnion SetOp = iota
+	SetOpIntersect
+	SetOpExcept
+)
+
+// QueryStmtSetOperation combines the rows of Left and Right queries by Op,
+// the duplicated rows are removed unless All is true. ORDER BY, LIMIT and
+// OFFSET are applied to the combined rows.
+type QueryStmtSetOperation struct {
+	Op      SetOp
+	All     bool
+	Left    Query
+	Right   Query
+	OrderBy []OrderBy
+	Limit   Expr // nil if without LIMIT clause or LIMIT ALL
+	Offset  Expr // nil if without OFFSET clause
+}
+
+func (s QueryStmtSetOperation) Kind() QueryStmtKind { return QueryStmtKindSelect }
+func (s QueryStmtSetOperation) query()              {}
+
+// CommonTableExpr is a query named by WITH clause, like t (a, b) AS (SELECT
+// ...), its rows could be read as a table by Name, and the columns are
+// renamed by Columns in order if they're specified.
+type CommonTableExpr struct {
+	Name    string
+	Columns []ColumnName
+	Query   Query
+}
+
+// QueryStmtWith executes Stmt with the queries of WITH clause, which is
+// SELECT, INSERT, UPDATE or DELETE. The queries are evaluated in order before
+// Stmt, so each one could read the ones before it. With Recursive, a query
+// could read its own rows if it's like non-recursive term UNION [ALL]
+// recursive term.
+type QueryStmtWith struct {
+	Recursive bool
+	CTEs      []CommonTableExpr
+	Stmt      QueryStmt
 }
 
+func (s QueryStmtWith) Kind() QueryStmtKind { return s.Stmt.Kind() }
+
 type ColumnUpdatedValue struct {
 	Name  ColumnName
-	Value string
+	Value Expr
 }
 
+// QueryStmtUpdateValues updates the rows of table by Values, which could refer
+// to the old versions of rows and the tables of FROM clause. From is the
+// tables of FROM clause joined like SELECT, the first one is cross joined.
 type QueryStmtUpdateValues struct {
 	TableName string
+	Alias     string // alias of table, empty if not specified
 	Values    []ColumnUpdatedValue
-	Where     WhereClause
+	From      []Join
+	Where     Expr
+	Returning *Returning // nil if without RETURNING clause
+}
+
+func (s QueryStmtUpdateValues) Kind() QueryStmtKind { return QueryStmtKindUpdate }
+
+type QueryStmtDeleteValues struct {
+	TableName string
+	Where     Expr
+	Returning *Returning // nil if without RETURNING clause
+}
+
+func (s QueryStmtDeleteValues) Kind() QueryStmtKind { return QueryStmtKindDelete }
+
+// QueryStmtDropTable drops tables, tables not existed are skipped instead of
+// failing if IfExists is true.
+type QueryStmtDropTable struct {
+	TableNames []string
+	IfExists   bool
+}
+
+func (s QueryStmtDropTable) Kind() QueryStmtKind { return QueryStmtKindDrop }
+
+type QueryStmtTruncateTable struct {
+	TableNames []string
+}
+
+func (s QueryStmtTruncateTable) Kind() QueryStmtKind { return QueryStmtKindTruncate }
+
+type AlterTableAction uint8
+
+const (
+	AlterTableActionAddColumn     AlterTableAction = iota // ADD COLUMN c TEXT
+	AlterTableActionDropColumn                            // DROP COLUMN c
+	AlterTableActionRenameColumn                          // RENAME COLUMN c TO d
+	AlterTableActionRenameTable                           // RENAME TO t
+	AlterTableActionAddConstraint                         // ADD CONSTRAINT c CHECK (age > 0)
+)
+
+// QueryStmtAlterTable changes the columns or name of a table by one action,
+// Column is the added column with its Constraints, or Constraints has the
+// added table constraint only, ColumnName is the dropped or renamed column,
+// and NewName is the new name of column or table.
+type QueryStmtAlterTable struct {
+	TableName   string
+	Action      AlterTableAction
+	Column      Column
+	Constraints []Constraint
+	ColumnName  ColumnName
+	NewName     string
+}
+
+func (s QueryStmtAlterTable) Kind() QueryStmtKind { return QueryStmtKindAlter }
+
+// QueryStmtPrepare prepares statement Stmt with parameters $1, $2 and so on
+// as Name, ParamKinds are the declared kinds of parameters, which could be
+// less than the parameters used by Stmt, then the rest are unknown.
+type QueryStmtPrepare struct {
+	Name       string
+	ParamKinds []ColumnKind
+	Stmt       QueryStmt
+}
+
+func (s QueryStmtPrepare) Kind() QueryStmtKind { return QueryStmtKindPrepare }
+
+// QueryStmtExecute executes the prepared statement Name with Params, which
+// are the values of $1, $2 and so on.
+type QueryStmtExecute struct {
+	Name   string
+	Params []*Literal
+}
+
+func (s QueryStmtExecute) Kind() QueryStmtKind { return QueryStmtKindExecute }
+
+// QueryStmtDeallocate deallocates the prepared statement Name, or all of the
+// prepared statements if All is true.
+type QueryStmtDeallocate struct {
+	Name string
+	All  bool
+}
+
+func (s QueryStmtDeallocate) Kind() QueryStmtKind { return QueryStmtKindDeallocate }
+
+// TransformStmt returns a copy of statement whose expressions are transformed
+// by fn like Transform, including the expressions of subqueries, and the
+// statements without expressions are returned as they are.
+func TransformStmt(stmt QueryStmt, fn func(Expr) (Expr, bool)) QueryStmt {
+	return transformStmt(stmt, transformSubqueries(fn))
+}
+
+// transformSubqueries returns the function which transforms the subqueries
+// by fn after fn is called.
+func transformSubqueries(fn func(Expr) (Expr, bool)) func(Expr) (Expr, bool) {
+	var sub func(Expr) (Expr, bool)
+	sub = func(e Expr) (Expr, bool) {
+		if r, ok := fn(e); ok {
+			return r, true
+		}
+		switch e := e.(type) {
+		case *SubqueryExpr:
+			return &SubqueryExpr{Query: TransformStmt(e.Query, fn).(Query)}, true
+		case *ExistsExpr:
+			return &ExistsExpr{Query: TransformStmt(e.Query, fn).(Query)}, true
+		case *InExpr:
+			if e.Query != nil {
+				q := TransformStmt(e.Query, fn).(Query)
+				return &InExpr{Expr: Transform(e.Expr, sub), Query: q, Not: e.Not}, true
+			}
+		}
+		return e, false
+	}
+	return sub
+}
+
+func transformStmt(stmt QueryStmt, fn func(Expr) (Expr, bool)) QueryStmt {
+	switch s := stmt.(type) {
+	case *QueryStmtInsertValues:
+		c := *s
+		c.Rows = make([]Row, 0, len(s.Rows))
+		for _, r := range s.Rows {
+			row := make(Row, 0, len(r))
+			for _, e := range r {
+				row = append(row, Transform(e, fn))
+			}
+			c.Rows = append(c.Rows, row)
+		}
+		if s.Query != nil {
+			c.Query = transformStmt(s.Query, fn).(Query)
+		}
+		c.Returning = transformReturning(s.Returning, fn)
+		return &c
+	case *QueryStmtSelectValues:
+		c := *s
+		c.DistinctOn = make([]Expr, 0, len(s.DistinctOn))
+		for _, e := range s.DistinctOn {
+			c.DistinctOn = append(c.DistinctOn, Transform(e, fn))
+		}
+		c.Joins = make([]Join, 0, len(s.Joins))
+		for _, j := range s.Joins {
+			j.On = Transform(j.On, fn)
+			c.Joins = append(c.Joins, j)
+		}
+		c.Columns = make([]SelectColumn, 0, len(s.Columns))
+		for _, sc := range s.Columns {
+			sc.Expr = Transform(sc.Expr, fn)
+			c.Columns = append(c.Columns, sc)
+		}
+		c.Where = Transform(s.Where, fn)
+		c.GroupBy = make([]Expr, 0, len(s.GroupBy))
+		for _, e := range s.GroupBy {
+			c.GroupBy = append(c.GroupBy, Transform(e, fn))
+		}
+		c.Having = Transform(s.Having, fn)
+		c.OrderBy = make([]OrderBy, 0, len(s.OrderBy))
+		for _, o := range s.OrderBy {
+			o.Expr = Transform(o.Expr, fn)
+			c.OrderBy = append(c.OrderBy, o)
+		}
+		c.Limit = Transform(s.Limit, fn)
+		c.Offset = Transform(s.Offset, fn)
+		return &c
+	case *QueryStmtSetOperation:
+		c := *s
+		c.Left = transformStmt(s.Left, fn).(Query)
+		c.Right = transformStmt(s.Right, fn).(Query)
+		c.OrderBy = make([]OrderBy, 0, len(s.OrderBy))
+		for _, o := range s.OrderBy {
+			o.Expr = Transform(o.Expr, fn)
+			c.OrderBy = append(c.OrderBy, o)
+		}
+		c.Limit = Transform(s.Limit, fn)
+		c.Offset = Transform(s.Offset, fn)
+		return &c
+	case *QueryStmtUpdateValues:
+		c := *s
+		c.Values = make([]ColumnUpdatedValue, 0, len(s.Values))
+		for _, v := range s.Values {
+			v.Value = Transform(v.Value, fn)
+			c.Values = append(c.Values, v)
+		}
+		c.From = make([]Join, 0, len(s.From))
+		for _, j := range s.From {
+			j.On = Transform(j.On, fn)
+			c.From = append(c.From, j)
+		}
+		c.Where = Transform(s.Where, fn)
+		c.Returning = transformReturning(s.Returning, fn)
+		return &c
+	case *QueryStmtDeleteValues:
+		c := *s
+		c.Where = Transform(s.Where, fn)
+		c.Returning = transformReturning(s.Returning, fn)
+		return &c
+	case *QueryStmtWith:
+		c := *s
+		c.CTEs = make([]CommonTableExpr, 0, len(s.CTEs))
+		for _, cte := range s.CTEs {
+			cte.Query = transformStmt(cte.Query, fn).(Query)
+			c.CTEs = append(c.CTEs, cte)
+		}
+		c.Stmt = transformStmt(s.Stmt, fn)
+		return &c
+	}
+	return stmt
+}
+
+// transformReturning returns a copy of RETURNING clause whose expressions are
+// transformed by fn like Transform.
+func transformReturning(r *Returning, fn func(Expr) (Expr, bool)) *Returning {
+	if r == nil {
+		return nil
+	}
+	c := &Returning{Columns: make([]SelectColumn, 0, len(r.Columns)), ContainsAllColumns: r.ContainsAllColumns}
+	for _, sc := range r.Columns {
+		sc.Expr = Transform(sc.Expr, fn)
+		c.Columns = append(c.Columns, sc)
+	}
+	return c
 }
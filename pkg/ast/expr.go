@@ -0,0 +1,344 @@
+package ast
+
+// Expr is the node of expression tree, like the condition of WHERE clause:
+// (age > 18 OR name == 'walker') AND NOT city == 'beijing'
+type Expr interface {
+	expr()
+}
+
+// ColumnRef refers to a column, table is optional and could be table alias.
+type ColumnRef struct {
+	Table string
+	Name  ColumnName
+}
+
+type LiteralKind uint8
+
+const (
+	LiteralKindString LiteralKind = iota + 1
+	LiteralKindNumber
+	LiteralKindNull
+)
+
+// Literal is the constant value written in query, like 'walker', 18 or NULL,
+// value is empty for NULL.
+type Literal struct {
+	Kind  LiteralKind
+	Value string
+}
+
+// Param is the positional parameter of prepared statement, like $1, index
+// starts from 1.
+type Param struct {
+	Index int
+}
+
+// CmpExpr compares values of two expressions, like age > 18 or a.x == b.y.
+type CmpExpr struct {
+	Cmp   CmpKind
+	Left  Expr
+	Right Expr
+}
+
+type LogicOp uint8
+
+const (
+	LogicOpAnd LogicOp = iota
+	LogicOpOr
+)
+
+// LogicExpr combines two conditions with AND or OR.
+type LogicExpr struct {
+	Op    LogicOp
+	Left  Expr
+	Right Expr
+}
+
+// NotExpr negates a condition.
+type NotExpr struct {
+	Expr Expr
+}
+
+// IsNullExpr tests if the value of expression is NULL, like age IS NULL or
+// age IS NOT NULL if not is true.
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+type BinaryOp uint8
+
+const (
+	BinaryOpAdd    BinaryOp = iota // +
+	BinaryOpSub                    // -
+	BinaryOpMul                    // *
+	BinaryOpDiv                    // /
+	BinaryOpMod                    // %
+	BinaryOpConcat                 // ||
+)
+
+// BinaryExpr computes value from two expressions by arithmetic operator or
+// concatenation, like age + 1 or first || ' ' || last.
+type BinaryExpr struct {
+	Op    BinaryOp
+	Left  Expr
+	Right Expr
+}
+
+// NegExpr negates a number, like -age.
+type NegExpr struct {
+	Expr Expr
+}
+
+// CaseWhen is a WHEN clause of CASE, cond is the condition of searched CASE,
+// or the value compared with operand of simple CASE.
+type CaseWhen struct {
+	Cond   Expr
+	Result Expr
+}
+
+// CaseExpr chooses the result of first met WHEN clause, or Else if none is
+// met, like CASE WHEN age < 18 THEN 'minor' ELSE 'adult' END. Operand is nil
+// for searched CASE, and Else is nil if without ELSE clause.
+type CaseExpr struct {
+	Operand Expr
+	Whens   []CaseWhen
+	Else    Expr
+}
+
+// LikeExpr matches string with pattern, % in pattern matches any sequence
+// of characters and _ matches any single character, like name LIKE 'wa%'.
+// The case is ignored if Insensitive is true, which is ILIKE.
+type LikeExpr struct {
+	Expr        Expr
+	Pattern     Expr
+	Not         bool
+	Insensitive bool
+}
+
+// InExpr tests if the value of expression equals to any value of list, like
+// age IN (18, 20) or age NOT IN (18, 20) if not is true. The values could be
+// the rows of subquery instead of list, like id IN (SELECT uid FROM orders).
+type InExpr struct {
+	Expr  Expr
+	List  []Expr
+	Query Query // nil unless the values are returned by subquery
+	Not   bool
+}
+
+// BetweenExpr tests if the value of expression is between low and high, both
+// are inclusive, like age BETWEEN 18 AND 30.
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// SubqueryExpr is the value returned by subquery which returns one column and
+// at most one row, like (SELECT max(age) FROM users).
+type SubqueryExpr struct {
+	Query Query
+}
+
+// ExistsExpr tests if subquery returns any row, like EXISTS (SELECT * FROM
+// orders WHERE orders.uid = users.id).
+type ExistsExpr struct {
+	Query Query
+}
+
+// FuncCall calls function with arguments, like count(*) or sum(age), star is
+// true only for count(*). Over is nil unless it's called as window function,
+// like rank() OVER (ORDER BY age).
+type FuncCall struct {
+	Name string
+	Args []Expr
+	Star bool
+	Over *WindowSpec
+}
+
+// WindowSpec is the window of OVER clause, the rows are partitioned by the
+// values of PartitionBy and sorted by OrderBy in every partition. Frame is
+// nil if without frame clause, then the frame is from the start of partition
+// to the last peer of current row with ORDER BY, or the whole partition
+// without it.
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []OrderBy
+	Frame       *WindowFrame
+}
+
+// WindowFrame is the rows of ROWS frame clause, like ROWS BETWEEN 1 PRECEDING
+// AND CURRENT ROW.
+type WindowFrame struct {
+	Start FrameBound
+	End   FrameBound
+}
+
+type FrameBoundKind uint8
+
+const (
+	FrameBoundUnboundedPreceding FrameBoundKind = iota
+	FrameBoundPreceding
+	FrameBoundCurrentRow
+	FrameBoundFollowing
+	FrameBoundUnboundedFollowing
+)
+
+// FrameBound is the start or end of frame, Offset is the number of rows of
+// n PRECEDING or n FOLLOWING, which is nil for the others.
+type FrameBound struct {
+	Kind   FrameBoundKind
+	Offset Expr
+}
+
+func (*ColumnRef) expr()    {}
+func (*Literal) expr()      {}
+func (*Param) expr()        {}
+func (*CmpExpr) expr()      {}
+func (*LogicExpr) expr()    {}
+func (*NotExpr) expr()      {}
+func (*IsNullExpr) expr()   {}
+func (*FuncCall) expr()     {}
+func (*BinaryExpr) expr()   {}
+func (*NegExpr) expr()      {}
+func (*CaseExpr) expr()     {}
+func (*LikeExpr) expr()     {}
+func (*InExpr) expr()       {}
+func (*BetweenExpr) expr()  {}
+func (*SubqueryExpr) expr() {}
+func (*ExistsExpr) expr()   {}
+
+// Walk traverses expression tree with depth-first order, fn is called for
+// every node, and the children of node are skipped if fn returns false. The
+// subqueries aren't traversed, as their columns are resolved by their own
+// tables.
+func Walk(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	switch e := e.(type) {
+	case *CmpExpr:
+		Walk(e.Left, fn)
+		Walk(e.Right, fn)
+	case *LogicExpr:
+		Walk(e.Left, fn)
+		Walk(e.Right, fn)
+	case *NotExpr:
+		Walk(e.Expr, fn)
+	case *IsNullExpr:
+		Walk(e.Expr, fn)
+	case *FuncCall:
+		for _, a := range e.Args {
+			Walk(a, fn)
+		}
+		if e.Over != nil {
+			for _, p := range e.Over.PartitionBy {
+				Walk(p, fn)
+			}
+			for _, o := range e.Over.OrderBy {
+				Walk(o.Expr, fn)
+			}
+			if f := e.Over.Frame; f != nil {
+				Walk(f.Start.Offset, fn)
+				Walk(f.End.Offset, fn)
+			}
+		}
+	case *BinaryExpr:
+		Walk(e.Left, fn)
+		Walk(e.Right, fn)
+	case *NegExpr:
+		Walk(e.Expr, fn)
+	case *CaseExpr:
+		Walk(e.Operand, fn)
+		for _, w := range e.Whens {
+			Walk(w.Cond, fn)
+			Walk(w.Result, fn)
+		}
+		Walk(e.Else, fn)
+	case *LikeExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Pattern, fn)
+	case *InExpr:
+		Walk(e.Expr, fn)
+		for _, v := range e.List {
+			Walk(v, fn)
+		}
+	case *BetweenExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Low, fn)
+		Walk(e.High, fn)
+	}
+}
+
+// Transform returns a copy of expression tree, every node is replaced by the
+// result of fn if ok is true, otherwise its children are transformed. The
+// subqueries aren't transformed like Walk, but TransformStmt does.
+func Transform(e Expr, fn func(Expr) (Expr, bool)) Expr {
+	if e == nil {
+		return nil
+	}
+	if r, ok := fn(e); ok {
+		return r
+	}
+	switch e := e.(type) {
+	case *CmpExpr:
+		return &CmpExpr{Cmp: e.Cmp, Left: Transform(e.Left, fn), Right: Transform(e.Right, fn)}
+	case *LogicExpr:
+		return &LogicExpr{Op: e.Op, Left: Transform(e.Left, fn), Right: Transform(e.Right, fn)}
+	case *NotExpr:
+		return &NotExpr{Expr: Transform(e.Expr, fn)}
+	case *IsNullExpr:
+		return &IsNullExpr{Expr: Transform(e.Expr, fn), Not: e.Not}
+	case *FuncCall:
+		args := make([]Expr, 0, len(e.Args))
+		for _, a := range e.Args {
+			args = append(args, Transform(a, fn))
+		}
+		return &FuncCall{Name: e.Name, Args: args, Star: e.Star, Over: transformWindow(e.Over, fn)}
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, Left: Transform(e.Left, fn), Right: Transform(e.Right, fn)}
+	case *NegExpr:
+		return &NegExpr{Expr: Transform(e.Expr, fn)}
+	case *CaseExpr:
+		whens := make([]CaseWhen, 0, len(e.Whens))
+		for _, w := range e.Whens {
+			whens = append(whens, CaseWhen{Cond: Transform(w.Cond, fn), Result: Transform(w.Result, fn)})
+		}
+		return &CaseExpr{Operand: Transform(e.Operand, fn), Whens: whens, Else: Transform(e.Else, fn)}
+	case *LikeExpr:
+		return &LikeExpr{Expr: Transform(e.Expr, fn), Pattern: Transform(e.Pattern, fn), Not: e.Not, Insensitive: e.Insensitive}
+	case *InExpr:
+		list := make([]Expr, 0, len(e.List))
+		for _, v := range e.List {
+			list = append(list, Transform(v, fn))
+		}
+		return &InExpr{Expr: Transform(e.Expr, fn), List: list, Query: e.Query, Not: e.Not}
+	case *BetweenExpr:
+		return &BetweenExpr{Expr: Transform(e.Expr, fn), Low: Transform(e.Low, fn), High: Transform(e.High, fn), Not: e.Not}
+	}
+	return e
+}
+
+// transformWindow returns a copy of window whose expressions are transformed
+// by fn like Transform.
+func transformWindow(w *WindowSpec, fn func(Expr) (Expr, bool)) *WindowSpec {
+	if w == nil {
+		return nil
+	}
+	c := &WindowSpec{PartitionBy: make([]Expr, 0, len(w.PartitionBy)), OrderBy: make([]OrderBy, 0, len(w.OrderBy))}
+	for _, p := range w.PartitionBy {
+		c.PartitionBy = append(c.PartitionBy, Transform(p, fn))
+	}
+	for _, o := range w.OrderBy {
+		o.Expr = Transform(o.Expr, fn)
+		c.OrderBy = append(c.OrderBy, o)
+	}
+	if f := w.Frame; f != nil {
+		c.Frame = &WindowFrame{
+			Start: FrameBound{Kind: f.Start.Kind, Offset: Transform(f.Start.Offset, fn)},
+			End:   FrameBound{Kind: f.End.Kind, Offset: Transform(f.End.Offset, fn)},
+		}
+	}
+	return c
+}
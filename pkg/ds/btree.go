@@ -89,6 +89,76 @@ func (t *Btree) search(n *BtreeNode, k string) BtreeKey {
 	return t.search(n.Children[i], k)
 }
 
+// SearchAll returns all keys whose names are k in the B-tree, as the names of
+// keys could be duplicated.
+func (t *Btree) SearchAll(k string) []BtreeKey {
+	keys := make([]BtreeKey, 0)
+	return t.searchAll(t.Root, k, keys)
+}
+
+func (t *Btree) searchAll(n *BtreeNode, k string, keys []BtreeKey) []BtreeKey {
+	if n == nil {
+		return keys
+	}
+	for i := 0; i <= len(n.Keys); i++ {
+		// the keys of child i are between key i-1 and key i
+		if !n.IsLeaf && i < len(n.Children) &&
+			(i == 0 || n.Keys[i-1].Name <= k) && (i == len(n.Keys) || k <= n.Keys[i].Name) {
+			keys = t.searchAll(n.Children[i], k, keys)
+		}
+		if i < len(n.Keys) && n.Keys[i].Name == k {
+			keys = append(keys, n.Keys[i])
+		}
+	}
+	return keys
+}
+
+// Range returns the keys whose names are in range [from, to) in ascending
+// order, the range has no upper bound if to is empty.
+func (t *Btree) Range(from, to string) []BtreeKey {
+	keys := make([]BtreeKey, 0)
+	return t.rangeKeys(t.Root, from, to, keys)
+}
+
+func (t *Btree) rangeKeys(n *BtreeNode, from, to string, keys []BtreeKey) []BtreeKey {
+	if n == nil {
+		return keys
+	}
+	for i := 0; i <= len(n.Keys); i++ {
+		// the keys of child i are between key i-1 and key i
+		if !n.IsLeaf && i < len(n.Children) &&
+			(i == len(n.Keys) || from <= n.Keys[i].Name) && (i == 0 || to == "" || n.Keys[i-1].Name < to) {
+			keys = t.rangeKeys(n.Children[i], from, to, keys)
+		}
+		if i < len(n.Keys) && from <= n.Keys[i].Name && (to == "" || n.Keys[i].Name < to) {
+			keys = append(keys, n.Keys[i])
+		}
+	}
+	return keys
+}
+
+// Keys returns all keys of the B-tree in ascending order.
+func (t *Btree) Keys() []BtreeKey {
+	keys := make([]BtreeKey, 0)
+	return t.keys(t.Root, keys)
+}
+
+func (t *Btree) keys(n *BtreeNode, keys []BtreeKey) []BtreeKey {
+	if n == nil {
+		return keys
+	}
+	for i, k := range n.Keys {
+		if !n.IsLeaf && i < len(n.Children) {
+			keys = t.keys(n.Children[i], keys)
+		}
+		keys = append(keys, k)
+	}
+	if !n.IsLeaf && len(n.Children) > len(n.Keys) {
+		keys = t.keys(n.Children[len(n.Keys)], keys)
+	}
+	return keys
+}
+
 // Insert inserts a key into the B-tree.
 func (t *Btree) Insert(k BtreeKey) *BtreeNode {
 	return t.insert(t.Root, k)
@@ -103,7 +173,7 @@ func (t *Btree) insert(n *BtreeNode, k BtreeKey) *BtreeNode {
 			n.Keys[j+1] = n.Keys[j]
 		}
 		n.Keys[j+1] = k
-		go t.flush()
+		t.flush()
 		return n
 	}
 	for i >= 0 && k.lt(n.Keys[i]) {
@@ -122,6 +192,73 @@ func (t *Btree) insert(n *BtreeNode, k BtreeKey) *BtreeNode {
 	return t.insert(n.Children[i], k)
 }
 
+// Delete deletes the key whose name and data both equal to k from the B-tree,
+// as different rows could have same column value, so the data is needed to
+// identify the key. It returns false if the key is not found.
+func (t *Btree) Delete(k BtreeKey) bool {
+	if !t.delete(t.Root, k) {
+		return false
+	}
+	t.flush()
+	return true
+}
+
+func (t *Btree) delete(n *BtreeNode, k BtreeKey) bool {
+	i := 0
+	for i < len(n.Keys) && n.Keys[i].Name < k.Name {
+		i++
+	}
+	// keys with same name could be placed on both sides of each other
+	for ; i < len(n.Keys) && n.Keys[i].Name == k.Name; i++ {
+		if !n.IsLeaf && t.delete(n.Children[i], k) {
+			return true
+		}
+		if n.Keys[i] == k {
+			t.deleteAt(n, i)
+			return true
+		}
+	}
+	if n.IsLeaf {
+		return false
+	}
+	return t.delete(n.Children[i], k)
+}
+
+// deleteAt deletes the ith key of node n. For a leaf, the key is removed
+// directly, otherwise it is replaced with the max key of its left subtree.
+// Note: nodes are not rebalanced after deleting, which keeps the order of keys
+// and is enough for searching.
+func (t *Btree) deleteAt(n *BtreeNode, i int) {
+	if !n.IsLeaf {
+		if k, ok := t.popMax(n.Children[i]); ok {
+			n.Keys[i] = k
+			return
+		}
+		// the left subtree is empty, so remove it with the key together
+		n.Children = append(n.Children[:i:i], n.Children[i+1:]...)
+	}
+	n.Keys = append(n.Keys[:i:i], n.Keys[i+1:]...)
+}
+
+// popMax removes and returns the max key of the subtree rooted at n.
+func (t *Btree) popMax(n *BtreeNode) (BtreeKey, bool) {
+	if !n.IsLeaf {
+		if k, ok := t.popMax(n.Children[len(n.Children)-1]); ok {
+			return k, true
+		}
+	}
+	if len(n.Keys) == 0 {
+		return BtreeKey{}, false
+	}
+	k := n.Keys[len(n.Keys)-1]
+	n.Keys = n.Keys[:len(n.Keys)-1]
+	if !n.IsLeaf {
+		// the rightmost subtree is empty, drop it with its parent key
+		n.Children = n.Children[:len(n.Children)-1]
+	}
+	return k, true
+}
+
 // Split node when the number of the keys = [2*t-1].
 // In this case, first split the original child into two pieces with the
 // middle key, then constuct a new node with the middle key and two children,
@@ -2,6 +2,7 @@ package ds
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -131,3 +132,142 @@ func TestBtreeWhenDegreeIs10(t *testing.T) {
 		t.Error("string should not be found")
 	}
 }
+
+func TestBtreeDelete(t *testing.T) {
+	// GIVEN
+	r := &BtreeNode{
+		Keys: []BtreeKey{makeKey("e", 1), makeKey("k", 2)},
+		Children: []*BtreeNode{
+			{Keys: []BtreeKey{makeKey("a", 3), makeKey("b", 4)}, IsLeaf: true, Level: 2},
+			{Keys: []BtreeKey{makeKey("f", 5), makeKey("g", 6), makeKey("g", 7)}, IsLeaf: true, Level: 2},
+			{Keys: []BtreeKey{makeKey("m", 8)}, IsLeaf: true, Level: 2}},
+		IsLeaf: false,
+		Level:  1,
+	}
+	tree := &Btree{Root: r, Degree: 2}
+
+	// WHEN
+	ok1 := tree.Delete(makeKey("e", 1))
+	ok2 := tree.Delete(makeKey("g", 6))
+	ok3 := tree.Delete(makeKey("m", 100))
+	ok4 := tree.Delete(makeKey("m", 8))
+
+	// THEN
+	if !ok1 || !ok2 || !ok4 {
+		t.Errorf("existed keys should be deleted")
+	}
+	if ok3 {
+		t.Errorf("key with different data should not be deleted")
+	}
+	if k := tree.Search("e"); !k.IsEmpty() {
+		t.Error("e should not be found")
+	}
+	if k := tree.Search("g"); k.Data.Offset != 7 {
+		t.Errorf("g should be found with offset 7, but got %d", k.Data.Offset)
+	}
+	if k := tree.Search("m"); !k.IsEmpty() {
+		t.Error("m should not be found")
+	}
+	for _, n := range []string{"a", "b", "f", "k"} {
+		if k := tree.Search(n); k.IsEmpty() {
+			t.Errorf("%s should be found", n)
+		}
+	}
+}
+
+func TestBtreeKeys(t *testing.T) {
+	// GIVEN
+	tree := NewBtree(2, "")
+	for i, n := range []string{"k", "b", "x", "e", "a", "m", "e", "c"} {
+		tree.Insert(makeKey(n, uint16(i)))
+	}
+
+	// WHEN
+	keys := tree.Keys()
+
+	// THEN
+	want := []string{"a", "b", "c", "e", "e", "k", "m", "x"}
+	if len(keys) != len(want) {
+		t.Fatalf("tree should have %d keys, but got %d", len(want), len(keys))
+	}
+	for i, k := range keys {
+		if k.Name != want[i] {
+			t.Errorf("keys[%d] = %s, want %s", i, k.Name, want[i])
+		}
+	}
+}
+
+func TestBtreeRange(t *testing.T) {
+	// GIVEN
+	tree := NewBtree(2, "")
+	for i, n := range []string{"k", "b", "x", "e", "a", "m", "e", "c", "ea", "f"} {
+		tree.Insert(makeKey(n, uint16(i)))
+	}
+
+	tests := []struct {
+		from, to string
+		want     []string
+	}{
+		{"b", "e", []string{"b", "c"}},
+		{"e", "f", []string{"e", "e", "ea"}},
+		{"e", "e\x00", []string{"e", "e"}},
+		{"d", "", []string{"e", "e", "ea", "f", "k", "m", "x"}},
+		{"", "b", []string{"a"}},
+		{"y", "", []string{}},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		keys := tree.Range(tt.from, tt.to)
+
+		// THEN
+		names := make([]string, 0, len(keys))
+		for _, k := range keys {
+			names = append(names, k.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("test %d: range [%q, %q) should be %v, but got %v", i, tt.from, tt.to, tt.want, names)
+		}
+	}
+}
+
+func TestBtreeSearchAll(t *testing.T) {
+	// GIVEN
+	r := &BtreeNode{
+		Keys: []BtreeKey{makeKey("e", 1), makeKey("g", 2)},
+		Children: []*BtreeNode{
+			{Keys: []BtreeKey{makeKey("a", 3), makeKey("e", 4)}, IsLeaf: true, Level: 2},
+			{Keys: []BtreeKey{makeKey("e", 5), makeKey("f", 6), makeKey("g", 7)}, IsLeaf: true, Level: 2},
+			{Keys: []BtreeKey{makeKey("g", 8), makeKey("m", 9)}, IsLeaf: true, Level: 2}},
+		IsLeaf: false,
+		Level:  1,
+	}
+	tree := &Btree{Root: r, Degree: 2}
+
+	tests := []struct {
+		name    string
+		offsets []uint16
+	}{
+		{"a", []uint16{3}},
+		{"e", []uint16{4, 1, 5}},
+		{"g", []uint16{7, 2, 8}},
+		{"m", []uint16{9}},
+		{"b", []uint16{}},
+	}
+
+	for _, tt := range tests {
+		// WHEN
+		keys := tree.SearchAll(tt.name)
+
+		// THEN
+		if len(keys) != len(tt.offsets) {
+			t.Errorf("SearchAll(%s) should get %d keys, but got %d", tt.name, len(tt.offsets), len(keys))
+			continue
+		}
+		for i, k := range keys {
+			if k.Name != tt.name || k.Data.Offset != tt.offsets[i] {
+				t.Errorf("SearchAll(%s)[%d] = %v, want offset %d", tt.name, i, k, tt.offsets[i])
+			}
+		}
+	}
+}
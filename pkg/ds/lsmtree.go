@@ -48,14 +48,20 @@ func NewLSMTree(baseDir string) *LSMTree {
 // Load loads LSM-Tree from disk when launching database.
 func (tree *LSMTree) Load() error {
 	f, err := os.Open(tree.memtablePath)
+	// the memtable file does not exist until the first key is inserted.
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
 	defer f.Close()
 	r := bufio.NewReader(f)
-	if err := json.NewDecoder(r).Decode(&tree.memtable); err != nil {
+	var memtable *SkipListNode
+	if err := json.NewDecoder(r).Decode(&memtable); err != nil {
 		return err
 	}
+	tree.loadMemtable(memtable)
 	f, err = os.Open(tree.sstablePath)
 	// it is possible that the sstable file does not exist as memtable hasn't
 	// reach the limit, so we just return nil if the file does not exist.
@@ -73,6 +79,24 @@ func (tree *LSMTree) Load() error {
 	return nil
 }
 
+// loadMemtable rebuilds memtable from the nodes decoded from file. The nodes
+// shared by levels are decoded as copies and they have no dicision maker, so
+// the memtable is built again by inserting the nodes of bottom level.
+func (tree *LSMTree) loadMemtable(decoded *SkipListNode) {
+	tree.memtable, tree.memtableSize = nil, 0
+	if decoded == nil {
+		return
+	}
+	for _, n := range decoded.AllNodes() {
+		tree.updateMemsize(n.Key, n.Data)
+		if tree.memtable == nil {
+			tree.memtable = NewSkipList(n.Key, n.Data)
+			continue
+		}
+		tree.memtable = tree.memtable.Insert(n.Key, n.Data)
+	}
+}
+
 // SetLimit sets the size limit of memtable and sstable, l1 is the size limit
 // of memtable, l2 is the size limit of sstable.
 func (tree *LSMTree) SetLimit(l1, l2 int) {
@@ -123,6 +147,77 @@ func (tree *LSMTree) Search(k string) IndexData {
 	return IndexData{}
 }
 
+// Delete deletes the key from LSM-Tree, if the key is in memtable, the memtable
+// is flushed to disk again, and if the key is in sstable, the sstable is
+// rewritten to disk.
+func (tree *LSMTree) Delete(k string) {
+	if tree.memtable != nil && !tree.memtable.Search(k).IsEmpty() {
+		tree.deleteMemtable(k)
+	}
+	if tree.sstable == nil {
+		tree.sstable = Decode(tree.sstablePath)
+	}
+	if d := tree.sstable.search(k); !d.IsEmpty() {
+		tree.deleteSstable(k)
+	}
+}
+
+// deleteMemtable deletes the key from memtable. As the head node of skip list
+// is also a key, memtable is rebuilt without the key when deleting head.
+func (tree *LSMTree) deleteMemtable(k string) {
+	if tree.memtable.Key != k {
+		tree.memtable.Delete(k)
+		tree.memtableSize -= len(k) + IndexData{}.size()
+		tree.flushMemtable()
+		return
+	}
+	nodes := tree.memtable.AllNodes()
+	tree.memtable = nil
+	tree.memtableSize = 0
+	for _, n := range nodes {
+		if n.Key == k {
+			continue
+		}
+		tree.updateMemsize(n.Key, n.Data)
+		if tree.memtable == nil {
+			tree.memtable = NewSkipList(n.Key, n.Data)
+			continue
+		}
+		tree.memtable.Insert(n.Key, n.Data)
+	}
+	if tree.memtable == nil {
+		os.Remove(tree.memtablePath)
+		return
+	}
+	tree.flushMemtable()
+}
+
+// deleteSstable deletes the key from sstable and rewrites it to disk.
+func (tree *LSMTree) deleteSstable(k string) {
+	c := make([]*SkipListNode, 0, len(tree.sstable))
+	for _, n := range tree.sstable {
+		if n.Key != k {
+			c = append(c, n)
+		}
+	}
+	tree.sstable = c
+	f, err := os.OpenFile(tree.sstablePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	if _, err := w.Write(bytes); err != nil {
+		fmt.Printf("write sstable to disk failed: %v\n", err)
+		return
+	}
+	w.Flush()
+}
+
 // flushMemtable flushes the memtable to disk every time inserts a new row.
 func (tree *LSMTree) flushMemtable() {
 	// check if the base dir exists, if not, create it
@@ -132,7 +227,7 @@ func (tree *LSMTree) flushMemtable() {
 	if tree.memtable == nil {
 		return
 	}
-	f, err := os.OpenFile(tree.memtablePath, os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(tree.memtablePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return
 	}
@@ -135,3 +135,62 @@ func TestMergeSSTable(t *testing.T) {
 		t.Errorf("tree sstable size is not correct")
 	}
 }
+
+func TestDeleteLSMTree(t *testing.T) {
+	// GIVEN
+	dir := fmt.Sprintf("%s/lsmd8", testDir)
+	tree := NewLSMTree(dir)
+	tree.SetLimit(100, 200)
+	for i := 0; i < 15; i++ {
+		k := fmt.Sprintf("k%d", i+10)
+		tree.Insert(k, IndexData{Offset: uint16(10 * i), Length: 10})
+	}
+
+	// WHEN
+	tree.Delete("k12") // in sstable
+	tree.Delete("k20") // head of memtable
+	tree.Delete("k22") // in memtable
+
+	// THEN
+	for _, k := range []string{"k12", "k20", "k22"} {
+		if d := tree.Search(k); !d.IsEmpty() {
+			t.Errorf("%s should be deleted, but got %v", k, d)
+		}
+	}
+	for _, k := range []string{"k10", "k19", "k21", "k24"} {
+		if d := tree.Search(k); d.IsEmpty() {
+			t.Errorf("%s should be found", k)
+		}
+	}
+}
+
+func TestLoadLSMTreeAndInsert(t *testing.T) {
+	// GIVEN
+	dir := fmt.Sprintf("%s/lsmd9", testDir)
+	tree := NewLSMTree(dir)
+	for i := 0; i < 10; i++ {
+		tree.Insert(fmt.Sprintf("k%d", i+10), IndexData{Offset: uint16(10 * i), Length: 10})
+	}
+
+	// WHEN
+	loaded := NewLSMTree(dir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("failed to load tree: %v", err)
+	}
+	if loaded.memtableSize != tree.memtableSize {
+		t.Errorf("memtable size should be %d, but got %d", tree.memtableSize, loaded.memtableSize)
+	}
+	loaded.Insert("k30", IndexData{Offset: 300, Length: 10})
+	loaded.Insert("k05", IndexData{Offset: 50, Length: 10})
+	loaded.Delete("k15")
+
+	// THEN
+	for _, k := range []string{"k05", "k10", "k19", "k30"} {
+		if d := loaded.Search(k); d.IsEmpty() {
+			t.Errorf("%s should be found", k)
+		}
+	}
+	if d := loaded.Search("k15"); !d.IsEmpty() {
+		t.Errorf("k15 should be deleted, but got %v", d)
+	}
+}
@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/wangwalker/gpostgres/pkg/ast"
@@ -44,18 +46,20 @@ func TestCreateTableSucceed(t *testing.T) {
 	}
 
 	for i, tt := range createTests {
-		stmt, err := Lex(tt.source)
+		r, err := Lex(tt.source)
 		if err != nil {
 			t.Errorf("%s: test %d should create table ok, but err is not null: %v", t.Name(), i, err)
+			continue
 		}
-		create, ok := stmt.(*ast.QueryStmtCreateTable)
-		if !ok {
-			t.Errorf("%s: test %d should create table ok, but return wrong type", t.Name(), i)
+		if r.Tag != "CREATE TABLE" {
+			t.Errorf("%s: test %d should create table ok, but got tag %s", t.Name(), i, r.Tag)
 		}
-		if tt.stmt.Name != create.Name {
-			t.Errorf("%s: test %d should create table ok, but name is not equal", t.Name(), i)
+		r, err = Lex("select * from " + tt.stmt.Name)
+		if err != nil {
+			t.Errorf("%s: test %d should create table ok, but select failed: %v", t.Name(), i, err)
+			continue
 		}
-		if tt.columns != len(create.Columns) {
+		if tt.columns != len(r.Columns) {
 			t.Errorf("%s: test %d should create table ok, but get wrong columns", t.Name(), i)
 		}
 	}
@@ -200,7 +204,7 @@ func TestSelectFailsWhenTableExistButWrongWhere(t *testing.T) {
 		// "select * from stu1 == 'a';",
 		"select * from stu1 nn == 'a';",
 		"select * from stu1 where == 'a';",
-		"select * from stu1 where name = 'a';",
+		"select * from stu1 where name => 'a';",
 		"select (name, age) from stu1 where name === 'a';",
 	}
 	// THEN
@@ -240,6 +244,9 @@ func TestSelectSucceed(t *testing.T) {
 		{"select * from stu2 where name != 'a';", 2},
 		{"select (name) from stu2 where name == 'a';", 4},
 		{"select (name, age) from stu2 where name != 'a'", 2},
+		{"select name, age from stu2 where name = 'a';", 4},
+		{"SELECT name FROM stu2 WHERE name <> 'a';", 2},
+		{"select * from stu2 -- comment\n where age >= 14;", 2},
 	}
 	// THEN
 	for i, tt := range selectTests {
@@ -247,9 +254,8 @@ func TestSelectSucceed(t *testing.T) {
 		if err != nil {
 			t.Errorf("%s: then: test %d should ok, but err isn't null", t.Name(), i)
 		}
-		rows, ok := r.([]storage.Row)
-		if !ok || len(rows) != tt.rows {
-			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(rows))
+		if err == nil && len(r.Rows) != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(r.Rows))
 		}
 	}
 }
@@ -307,7 +313,7 @@ func TestUpdateFailsWhenTableExistButWrongWhere(t *testing.T) {
 	selectTests := []string{
 		"update utu1 set name = 'www', age = 0 nn == 'a';",
 		"update utu1 set name = 'www', age = 0 where == 'a';",
-		"update utu1 set name = 'www', age = 0 where name = 'a';",
+		"update utu1 set name = 'www', age = 0 where name => 'a';",
 		"update utu1 set name = 'www', age = 0 where name === 'a';",
 	}
 	// THEN
@@ -351,9 +357,1024 @@ func TestUpdateSucceed(t *testing.T) {
 		if err != nil {
 			t.Errorf("%s: then: test %d should ok, but err isn't null", t.Name(), i)
 		}
-		rows, ok := r.(int)
-		if !ok || rows != tt.rows {
-			t.Errorf("%s: then: test %d should update %d rows, but updated %d ", t.Name(), i, tt.rows, rows)
+		if err == nil && r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should update %d rows, but updated %d ", t.Name(), i, tt.rows, r.Affected)
+		}
+	}
+}
+
+func TestDeleteFailsWhenSyntaxWrong(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table dtu (name text, age int);",
+		"insert into dtu values ('a', 11), ('b', 12);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	deleteTests := []string{
+		"delete dtu;",
+		"delete from;",
+		"delete from nonexistedtable;",
+		"delete from dtu name == 'a';",
+		"delete from dtu where == 'a';",
+		"delete from dtu where name => 'a';",
+		"delete from dtu where gender == 'a';",
+	}
+	// THEN
+	for i, tt := range deleteTests {
+		_, err := Lex(tt)
+		if err == nil {
+			t.Errorf("%s: then: %d should fail, but err is null", t.Name(), i)
+		}
+	}
+}
+
+func TestDeleteSucceed(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table dtu1 (name text, age int);",
+		"insert into dtu1 values ('a', 11), ('b', 12), ('a', 13);",
+		"insert into dtu1 values ('c', 14), ('d', 15);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	deleteTests := []struct {
+		source string
+		rows   int
+	}{
+		{"delete from dtu1 where name == 'a';", 2},
+		{"delete from dtu1 where name == 'a';", 0},
+		{"delete from dtu1 where name != 'b';", 2},
+		{"delete from dtu1;", 1},
+	}
+	// THEN
+	for i, tt := range deleteTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null", t.Name(), i)
+		}
+		if err == nil && r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should delete %d rows, but deleted %d ", t.Name(), i, tt.rows, r.Affected)
+		}
+	}
+}
+
+func TestSelectWithBooleanWhere(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu3 (name text, city text, school text);",
+		"insert into stu3 values ('a', 'bj', 'pku'), ('b', 'sh', 'fdu'), ('c', 'bj', 'thu'), ('d', 'gz', 'gz');",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	selectTests := []struct {
+		source string
+		rows   int
+	}{
+		{"select * from stu3 where city = 'bj' and school = 'thu';", 1},
+		{"select * from stu3 where city = 'bj' or city = 'sh';", 3},
+		{"select * from stu3 where not city = 'bj';", 2},
+		{"select * from stu3 where not (city = 'bj' or name = 'b') and 'a' < name;", 1},
+		{"select * from stu3 where city = school;", 1},
+		{"select * from stu3 where stu3.city != school or name = 'a';", 3},
+	}
+	// THEN
+	for i, tt := range selectTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+			continue
+		}
+		if len(r.Rows) != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(r.Rows))
+		}
+	}
+
+	// THEN, conditions composed of wrong columns or types fail
+	failedTests := []string{
+		"select * from stu3 where city = 'bj' and age = 1;",
+		"select * from stu3 where city and name = 'a';",
+		"select * from stu3 where other.city = 'bj';",
+		"update stu3 set city = 'bj' where not name;",
+		"delete from stu3 where name = 'a' or gender = 'm';",
+	}
+	for i, tt := range failedTests {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: failed test %d should fail, but err is null", t.Name(), i)
+		}
+	}
+}
+
+func TestIntColumnsAreTyped(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu4 (name text, age int);",
+		"insert into stu4 values ('a', 9), ('b', 10), ('c', 100), ('d', -3);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	selectTests := []struct {
+		source string
+		rows   int
+	}{
+		{"select * from stu4 where age > 9;", 2},
+		{"select * from stu4 where age < 10;", 2},
+		{"select * from stu4 where age >= -3 and age <= 9;", 2},
+		{"select * from stu4 where age = '100';", 1},
+	}
+	// THEN
+	for i, tt := range selectTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+			continue
+		}
+		if len(r.Rows) != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(r.Rows))
+		}
+	}
+
+	// THEN, values which aren't valid integers are rejected
+	failedTests := []string{
+		"insert into stu4 values ('e', 'abc');",
+		"insert into stu4 values ('e', 1.5);",
+		"insert into stu4 values ('e', 3000000000);",
+		"update stu4 set age = 'x' where name = 'a';",
+		"select * from stu4 where age = 'x';",
+	}
+	for i, tt := range failedTests {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: failed test %d should fail, but err is null", t.Name(), i)
+		}
+	}
+	r, _ := Lex("select * from stu4 where name = 'a';")
+	if r == nil || len(r.Rows) != 1 || r.Rows[0][1] != int64(9) {
+		t.Errorf("%s: then: failed update shouldn't change row", t.Name())
+	}
+}
+
+func TestSelectWithOrderByAndLimit(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu5 (name text, age int, city text);",
+		"insert into stu5 values ('a', 12, 'bj'), ('b', 9, 'sh'), ('c', 100, 'bj'), ('d', 12, 'gz');",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	selectTests := []struct {
+		source string
+		names  string
+	}{
+		{"select name from stu5 order by age;", "badc"},
+		{"select name from stu5 order by age desc;", "cadb"},
+		{"select name from stu5 order by city, age desc;", "cadb"},
+		{"select name from stu5 where city = 'bj' order by name desc;", "ca"},
+		{"select name from stu5 order by age limit 2;", "ba"},
+		{"select name from stu5 order by age limit 2 offset 1;", "ad"},
+		{"select name from stu5 order by age offset 3;", "c"},
+		{"select name from stu5 limit all offset 10;", ""},
+	}
+	// THEN
+	for i, tt := range selectTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+			continue
+		}
+		names := ""
+		for _, row := range r.Rows {
+			names += row[0].(string)
+		}
+		if names != tt.names {
+			t.Errorf("%s: then: test %d should get %s, but got %s ", t.Name(), i, tt.names, names)
+		}
+	}
+
+	// THEN, wrong sort keys or limits fail
+	failedTests := []string{
+		"select * from stu5 order by gender;",
+		"select * from stu5 limit -1;",
+		"select * from stu5 limit 'a';",
+		"select * from stu5 offset age;",
+	}
+	for i, tt := range failedTests {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: failed test %d should fail, but err is null", t.Name(), i)
+		}
+	}
+}
+
+func TestSelectWithAggregates(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu6 (name text, age int, city text);",
+		"insert into stu6 values ('a', 12, 'bj'), ('b', 9, 'sh'), ('c', 100, 'bj'), ('d', 12, 'gz');",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	r, err := Lex("select city, count(*), sum(age), max(name) from stu6 group by city having sum(age) > 10 order by city;")
+
+	// THEN
+	if err != nil {
+		t.Fatalf("%s: then: select should ok, but err isn't null: %v", t.Name(), err)
+	}
+	headers := []ast.ColumnName{"city", "count", "sum", "max"}
+	for i, c := range r.Columns {
+		if c.Name != headers[i] {
+			t.Errorf("%s: then: column %d should be %s, but got %s", t.Name(), i, headers[i], c.Name)
+		}
+	}
+	if len(r.Rows) != 2 || r.Tag != "SELECT 2" {
+		t.Fatalf("%s: then: should get 2 groups, but got %d", t.Name(), len(r.Rows))
+	}
+	if r.Rows[0][0] != "bj" || r.Rows[0][1] != int64(2) || r.Rows[0][2] != int64(112) || r.Rows[0][3] != "c" {
+		t.Errorf("%s: then: first group is not correct: %v", t.Name(), r.Rows[0])
+	}
+	if r.Rows[1][0] != "gz" || r.Rows[1][2] != int64(12) {
+		t.Errorf("%s: then: second group is not correct: %v", t.Name(), r.Rows[1])
+	}
+
+	// THEN, wrong aggregates fail
+	failedTests := []string{
+		"select name, count(*) from stu6 group by city;",
+		"select city from stu6 where count(*) > 1 group by city;",
+		"select sum(city) from stu6;",
+		"select avg(*) from stu6;",
+		"select city from stu6 group by count(*);",
+	}
+	for i, tt := range failedTests {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: failed test %d should fail, but err is null", t.Name(), i)
+		}
+	}
+}
+
+func TestSelectWithJoins(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table jusers (id int, name text);",
+		"create table jorders (uid int, item text, price int);",
+		"insert into jusers values (1, 'wang'), (2, 'li'), (3, 'zhao');",
+		"insert into jorders values (1, 'book', 30), (3, 'pen', 2), (1, 'cup', 12), (4, 'bag', 99);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	selectTests := []struct {
+		source string
+		rows   int
+	}{
+		{"select u.name, o.item from jusers u join jorders o on u.id = o.uid;", 3},
+		{"select name, item from jusers inner join jorders on id = uid where price > 10;", 2},
+		{"select * from jusers u left join jorders o on u.id = o.uid;", 4},
+		{"select * from jusers u right join jorders o on u.id = o.uid;", 4},
+		{"select * from jusers u full outer join jorders o on u.id = o.uid;", 5},
+		{"select * from jusers cross join jorders;", 12},
+		{"select * from jusers, jorders where id = uid;", 3},
+		{"select a.name from jusers a join jusers b on a.id < b.id;", 3},
+		{"select name, count(o.item) from jusers u left join jorders o on u.id = o.uid group by name;", 3},
+		{"select u.name from jusers u left join jorders o on u.id = o.uid where o.item = 'pen' or u.id = 2;", 2},
+	}
+	// THEN
+	for i, tt := range selectTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+			continue
+		}
+		if len(r.Rows) != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(r.Rows))
+		}
+	}
+
+	// THEN, wrong joins fail
+	failedTests := []string{
+		"select * from jusers join jusers on id = id;",
+		"select name from jusers a join jusers b on a.id = b.id;",
+		"select * from jusers u join jorders o on u.id = x.uid;",
+		"select * from jusers join jx on id = uid;",
+		"select jusers.name from jusers u;",
+	}
+	for i, tt := range failedTests {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: failed test %d should fail, but err is null", t.Name(), i)
+		}
+	}
+}
+
+func TestAlterTruncateAndDropTable(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table altu (name text, age int);",
+		"insert into altu values ('wang', 18), ('li', 20);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	statements := []string{
+		"alter table altu add column city text;",
+		"insert into altu values ('zhao', 30, 'bj');",
+		"alter table altu drop column age;",
+		"alter table altu rename column name to nick;",
+		"alter table altu rename to altm;",
+	}
+	for i, tt := range statements {
+		if _, err := Lex(tt); err != nil {
+			t.Errorf("%s: when: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+		}
+	}
+
+	// THEN
+	r, err := Lex("select nick, city from altm where city = 'bj';")
+	if err != nil {
+		t.Fatalf("%s: then: select should ok, but err isn't null: %v", t.Name(), err)
+	}
+	if len(r.Rows) != 1 || r.Rows[0][0] != "zhao" {
+		t.Errorf("%s: then: should get altered row, but got %v", t.Name(), r.Rows)
+	}
+	if _, err := Lex("select * from altu;"); err == nil {
+		t.Errorf("%s: then: table of old name should not exist", t.Name())
+	}
+
+	// THEN, truncate and drop
+	if r, err := Lex("truncate altm;"); err != nil || r.Tag != "TRUNCATE TABLE" {
+		t.Errorf("%s: then: truncate should ok, but got %v", t.Name(), err)
+	}
+	if r, err := Lex("select * from altm;"); err != nil || len(r.Rows) != 0 {
+		t.Errorf("%s: then: table should be empty after truncate", t.Name())
+	}
+	if r, err := Lex("drop table altm;"); err != nil || r.Tag != "DROP TABLE" {
+		t.Errorf("%s: then: drop should ok, but got %v", t.Name(), err)
+	}
+	if _, err := Lex("drop table altm;"); err == nil {
+		t.Errorf("%s: then: dropping again should fail", t.Name())
+	}
+	if _, err := Lex("drop table if exists altm;"); err != nil {
+		t.Errorf("%s: then: dropping with if exists should ok, but got %v", t.Name(), err)
+	}
+}
+
+func TestNullValues(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu7 (name text, age int);",
+		"insert into stu7 values ('a', null), (null, 12), ('c', 9);",
+	}
+	for i, tt := range createAndInsert {
+		_, err := Lex(tt)
+		if err != nil {
+			t.Errorf("%s: given: test %d should ok, but err isn't null", t.Name(), i)
+		}
+	}
+
+	// WHEN
+	selectTests := []struct {
+		source string
+		rows   int
+	}{
+		{"select * from stu7 where age is null;", 1},
+		{"select * from stu7 where age is not null;", 2},
+		{"select * from stu7 where age > 1;", 2},
+		{"select * from stu7 where not age > 1;", 0},
+		{"select * from stu7 where age = null;", 0},
+		{"select * from stu7 where age > 10 or name = 'a';", 2},
+		{"select * from stu7 where name is null and age > 10;", 1},
+	}
+	// THEN
+	for i, tt := range selectTests {
+		r, err := Lex(tt.source)
+		if err != nil {
+			t.Errorf("%s: then: test %d should ok, but err isn't null: %v", t.Name(), i, err)
+			continue
+		}
+		if len(r.Rows) != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %d ", t.Name(), i, tt.rows, len(r.Rows))
 		}
 	}
+
+	// THEN, NULLs are updated and ignored by aggregates
+	if r, err := Lex("update stu7 set age = null where name = 'c';"); err != nil || r.Affected != 1 {
+		t.Fatalf("%s: then: update should ok, but got %v", t.Name(), err)
+	}
+	r, err := Lex("select count(*), count(age), max(age) from stu7;")
+	if err != nil {
+		t.Fatalf("%s: then: select should ok, but err isn't null: %v", t.Name(), err)
+	}
+	if r.Rows[0][0] != int64(3) || r.Rows[0][1] != int64(1) || r.Rows[0][2] != int64(12) {
+		t.Errorf("%s: then: aggregates are not correct: %v", t.Name(), r.Rows[0])
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	// GIVEN
+	create := "create table stu8 (id int primary key, name text not null unique, age int default 18);"
+	if _, err := Lex(create); err != nil {
+		t.Fatalf("%s: given: create should ok, but got err: %v", t.Name(), err)
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{"insert into stu8 (id, name) values (1, 'a'), (2, 'b');", true},
+		{"insert into stu8 values (1, 'c', 20);", false},
+		{"insert into stu8 values (3, 'a', 20);", false},
+		{"insert into stu8 (id) values (3);", false},
+		{"insert into stu8 values (null, 'c', 20);", false},
+		{"update stu8 set name = 'b' where id = 1;", false},
+		{"update stu8 set id = 3 where id = 1;", true},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		if _, err := Lex(tt.source); (err == nil) != tt.ok {
+			t.Errorf("%s: then: test %d should ok: %v, but got err: %v", t.Name(), i, tt.ok, err)
+		}
+	}
+	r, err := Lex("select * from stu8 where age = 18;")
+	if err != nil || len(r.Rows) != 2 {
+		t.Errorf("%s: then: default age should be filled, but got %v, %v", t.Name(), r, err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table cls9 (id int primary key, name text);",
+		"create table stu9 (name text, cid int references cls9 on delete cascade on update cascade);",
+		"insert into cls9 values (1, 'a'), (2, 'b');",
+		"insert into stu9 values ('x', 1), ('y', 2), ('z', null);",
+	}
+	for i, tt := range createAndInsert {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{"insert into stu9 values ('w', 3);", false},
+		{"update stu9 set cid = 3 where name = 'x';", false},
+		{"update cls9 set id = 3 where id = 1;", true},
+		{"delete from cls9 where id = 2;", true},
+		{"drop table cls9;", false},
+	}
+	for i, tt := range tests {
+		if _, err := Lex(tt.source); (err == nil) != tt.ok {
+			t.Errorf("%s: when: test %d should ok: %v, but got err: %v", t.Name(), i, tt.ok, err)
+		}
+	}
+
+	// THEN
+	r, err := Lex("select * from stu9 where cid = 3;")
+	if err != nil || len(r.Rows) != 1 {
+		t.Errorf("%s: then: key should be updated by cascade, but got %v, %v", t.Name(), r, err)
+	}
+	r, err = Lex("select * from stu9;")
+	if err != nil || len(r.Rows) != 2 {
+		t.Errorf("%s: then: rows should be deleted by cascade, but got %v, %v", t.Name(), r, err)
+	}
+}
+
+func TestCheckConstraints(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu10 (name text, age int check (age > 0));",
+		"insert into stu10 values ('a', 11), ('b', null);",
+	}
+	for i, tt := range createAndInsert {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{"insert into stu10 values ('c', 0);", false},
+		{"update stu10 set age = -1 where name = 'a';", false},
+		{"alter table stu10 add constraint stu10_name_check check (name <> 'a');", false},
+		{"alter table stu10 add check (name <> 'c');", true},
+		{"insert into stu10 values ('c', 12);", false},
+		{"insert into stu10 values ('d', 12);", true},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		if _, err := Lex(tt.source); (err == nil) != tt.ok {
+			t.Errorf("%s: then: test %d should ok: %v, but got err: %v", t.Name(), i, tt.ok, err)
+		}
+	}
+}
+
+func TestCaseAndQuotes(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"CREATE TABLE \"Stu11\" (\"FullName\" TEXT, Age INT);",
+		"Insert Into \"Stu11\" Values ('Walker', 18), ('O''Brien', 21), ('say \"hi\"', 22);",
+	}
+	for i, tt := range createAndInsert {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"SeLeCt \"FullName\" FROM \"Stu11\" WHERE AGE = 18;", "Walker"},
+		{"select \"FullName\" from \"Stu11\" where \"FullName\" = 'O''Brien';", "O'Brien"},
+		{"select \"FullName\" from \"Stu11\" where age = 22;", "say \"hi\""},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || len(r.Rows) != 1 || r.Rows[0][0] != tt.want {
+			t.Errorf("%s: then: test %d should get %s, but got %v, %v", t.Name(), i, tt.want, r, err)
+		}
+	}
+	for i, tt := range []string{"select * from stu11;", "select fullname from \"Stu11\";"} {
+		if _, err := Lex(tt); err == nil {
+			t.Errorf("%s: then: test %d should fail as names are case sensitive when quoted", t.Name(), i)
+		}
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	// GIVEN
+	createAndPrepare := []string{
+		"create table stu12 (name text, age int);",
+		"prepare add12 (text, int) as insert into stu12 values ($1, $2);",
+		"prepare older12 as select name from stu12 where age > $1 order by age;",
+	}
+	for i, tt := range createAndPrepare {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{"execute add12 ('a''b', 11);", true},
+		{"execute add12 ('x'' OR 1 = 1 --', '12');", true},
+		{"execute add12 ('c', 'x');", false},
+		{"execute add12 ('c');", false},
+		{"execute add13 ('c', 13);", false},
+		{"prepare add12 as select * from stu12;", false},
+		{"select * from stu12 where age > $1;", false},
+	}
+	for i, tt := range tests {
+		if _, err := Lex(tt.source); (err == nil) != tt.ok {
+			t.Errorf("%s: when: test %d should ok: %v, but got err: %v", t.Name(), i, tt.ok, err)
+		}
+	}
+
+	// THEN
+	r, err := Lex("execute older12 (11);")
+	if err != nil || len(r.Rows) != 1 || r.Rows[0][0] != "x' OR 1 = 1 --" {
+		t.Errorf("%s: then: parameter should be bound as value, but got %v, %v", t.Name(), r, err)
+	}
+	if _, err := Lex("deallocate older12;"); err != nil {
+		t.Errorf("%s: then: deallocate should ok, but got err: %v", t.Name(), err)
+	}
+	if _, err := Lex("execute older12 (11);"); !errors.Is(err, ErrStatementNotExisted) {
+		t.Errorf("%s: then: execute should fail with %v, but got %v", t.Name(), ErrStatementNotExisted, err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	// GIVEN
+	if _, err := Lex("create table stu13 (name text, age int);"); err != nil {
+		t.Fatalf("%s: given: create table should ok, but got err: %v", t.Name(), err)
+	}
+	insert, err := Prepare("insert into stu13 (age, name) values ($2, $1);")
+	if err != nil || insert.NumParams() != 2 {
+		t.Fatalf("%s: given: prepare should get 2 parameters, but got %v, %v", t.Name(), insert, err)
+	}
+	query, err := Prepare("select name, age from stu13 where name = $1;")
+	if err != nil {
+		t.Fatalf("%s: given: prepare should ok, but got err: %v", t.Name(), err)
+	}
+
+	// WHEN
+	tests := []struct {
+		args []interface{}
+		err  error
+	}{
+		{[]interface{}{"walker", 18}, nil},
+		{[]interface{}{"'; drop table stu13; --", int64(21)}, nil},
+		{[]interface{}{"jack", nil}, nil},
+		{[]interface{}{"jack"}, ErrParamsNotMatched},
+		{[]interface{}{"jack", true}, ErrParamKindUnsupported},
+	}
+	for i, tt := range tests {
+		if _, err := insert.Exec(tt.args...); !errors.Is(err, tt.err) {
+			t.Errorf("%s: when: test %d should get err %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+
+	// THEN
+	for _, name := range []string{"walker", "'; drop table stu13; --"} {
+		r, err := query.Exec(name)
+		if err != nil || len(r.Rows) != 1 || r.Rows[0][0] != name {
+			t.Errorf("%s: then: should select %q, but got %v, %v", t.Name(), name, r, err)
+		}
+	}
+	if _, err := Prepare("drop table stu13;"); !errors.Is(err, ErrStatementInvalid) {
+		t.Errorf("%s: then: prepare should fail with %v, but got %v", t.Name(), ErrStatementInvalid, err)
+	}
+}
+
+func TestSelectExpressions(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu14 (name text, age int, city text);",
+		"insert into stu14 values ('wang', 18, 'beijing'), ('li', 9, null);",
+	}
+	for i, tt := range createAndInsert {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	r, err := Lex(`select upper(name) AS "Name", age * 2 + 1 next, coalesce(city, 'unknown'), ` +
+		`case when age >= 18 then 'adult' else 'minor' end, name || '@' || age from stu14 order by age;`)
+	if err != nil {
+		t.Fatalf("%s: when: select should ok, but got err: %v", t.Name(), err)
+	}
+
+	// THEN
+	names := []ast.ColumnName{"Name", "next", "coalesce", "case", "?column?"}
+	kinds := []ast.ColumnKind{ast.ColumnKindText, ast.ColumnKindInt, ast.ColumnKindText, ast.ColumnKindText, ast.ColumnKindText}
+	for i, c := range r.Columns {
+		if c.Name != names[i] || c.Kind != kinds[i] {
+			t.Errorf("%s: then: column %d should be %s %v, but got %v", t.Name(), i, names[i], kinds[i], c)
+		}
+	}
+	want := [][]interface{}{
+		{"LI", int64(19), "unknown", "minor", "li@9"},
+		{"WANG", int64(37), "beijing", "adult", "wang@18"},
+	}
+	for i, row := range want {
+		for j, v := range row {
+			if r.Rows[i][j] != v {
+				t.Errorf("%s: then: value (%d, %d) should be %v, but got %v", t.Name(), i, j, v, r.Rows[i][j])
+			}
+		}
+	}
+
+	// THEN, scalar functions work with aggregates
+	r, err = Lex("select upper(city), count(*) * 10 from stu14 group by city order by city;")
+	if err != nil || len(r.Rows) != 2 || r.Rows[0][0] != "BEIJING" || r.Rows[0][1] != int64(10) {
+		t.Errorf("%s: then: select with group by should ok, but got %v, %v", t.Name(), r, err)
+	}
+}
+
+func TestSelectWithPredicates(t *testing.T) {
+	// GIVEN
+	createAndInsert := []string{
+		"create table stu15 (name text, age int);",
+		"insert into stu15 values ('Wang', 18), ('walker', 20), ('li', 9), ('wangxin', 30), (null, 11);",
+	}
+	for i, tt := range createAndInsert {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"select * from stu15 where name like 'wa%';", 2},
+		{"select * from stu15 where name ilike 'wa%';", 3},
+		{"select * from stu15 where name not like 'w%';", 2},
+		{"select * from stu15 where age in (9, 18, 19);", 2},
+		{"select * from stu15 where age not in (9, 18);", 3},
+		{"select * from stu15 where age between 10 and 20;", 3},
+		{"select * from stu15 where age between 10 and 20 and name like 'w%';", 1},
+		{"delete from stu15 where name in ('li', 'Wang');", 2},
+		{"select * from stu15 where age not between 10 and 20;", 1},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+}
+
+func TestUpdateWithExprsAndFrom(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu16 (id int, name text, age int);",
+		"create table stu16_score (sid int, score int);",
+		"insert into stu16 values (1, 'wang', 18), (2, 'li', 20), (3, 'zhao', 22);",
+		"insert into stu16_score values (1, 90), (3, 60);",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"update stu16 set age = age + 1, name = upper(name) where id < 3;", 2},
+		{"update stu16 s set age = s.age + score from stu16_score where s.id = sid and score > 80;", 1},
+		{"select * from stu16 where age = 109 and name = 'WANG';", 1},
+		{"select * from stu16 where age = 21 and name = 'LI';", 1},
+		{"select * from stu16 where age = 22 and name = 'zhao';", 1},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+}
+
+func TestSelectDistinct(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu17 (name text, age int, class text);",
+		"insert into stu17 values ('wang', 18, 'a'), ('li', 20, 'b'), ('wang', 18, 'b'), ('zhao', 19, 'a');",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"select distinct name, age from stu17;", 3},
+		{"select distinct class from stu17 limit 1;", 1},
+		{"select distinct on (class) class, name from stu17 order by class, age desc;", 2},
+		{"select all name from stu17;", 4},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+}
+
+func TestSelectSetOperations(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu18 (name text, age int);",
+		"create table stu18_old (name text, age int);",
+		"insert into stu18 values ('wang', 18), ('li', 20), ('zhao', 22);",
+		"insert into stu18_old values ('li', 20), ('sun', 40);",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"select name from stu18 union select name from stu18_old;", 4},
+		{"select name, age from stu18 union all select name, age from stu18_old order by age desc limit 4;", 4},
+		{"select name from stu18 intersect select name from stu18_old;", 1},
+		{"select name from stu18 except select name from stu18_old;", 2},
+		{"(select name from stu18 order by age limit 1) union select name from stu18_old;", 3},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+	if _, err := Lex("select name, age from stu18 union select name from stu18_old;"); !errors.Is(err, storage.ErrSetColumnsNotMatched) {
+		t.Errorf("%s: then: union should fail for different columns, but got %v", t.Name(), err)
+	}
+}
+
+func TestSelectSubqueries(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu19 (id int, name text);",
+		"create table stu19_score (sid int, score int);",
+		"insert into stu19 values (1, 'wang'), (2, 'li'), (3, 'zhao');",
+		"insert into stu19_score values (1, 90), (1, 70), (2, 60);",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"select name from stu19 where id in (select sid from stu19_score);", 2},
+		{"select name from stu19 where id not in (select sid from stu19_score where score > 80);", 2},
+		{"select name from stu19 s where exists (select * from stu19_score where sid = s.id and score < 65);", 1},
+		{"select name, (select max(score) from stu19_score where sid = id) from stu19;", 3},
+		{"select name from stu19 where id = (select sid from stu19_score where score = 60);", 1},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+	if _, err := Lex("select name from stu19 where id = (select sid from stu19_score);"); !errors.Is(err, storage.ErrSubqueryRows) {
+		t.Errorf("%s: then: scalar subquery should fail for more rows, but got %v", t.Name(), err)
+	}
+}
+
+func TestWithQueries(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu20 (id int, name text, parent int);",
+		"insert into stu20 values (1, 'root', null), (2, 'a', 1), (3, 'b', 1), (4, 'a1', 2), (5, 'a11', 4);",
+		"prepare below20 as with recursive sub (id) as (select id from stu20 where id = $1 union all select c.id from stu20 c join sub on c.parent = sub.id) select id from sub;",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+	}{
+		{"with top as (select id from stu20 where parent = 1) select name from stu20 where parent in (select id from top);", 1},
+		{"with recursive sub (id, depth) as (select id, 0 from stu20 where parent is null union all select c.id, depth + 1 from stu20 c join sub on c.parent = sub.id) select id from sub where depth >= 2;", 2},
+		{"execute below20 (2);", 3},
+		{"with old as (select id from stu20 where id > 4) delete from stu20 where id in (select id from old);", 1},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows {
+			t.Errorf("%s: then: test %d should get %d rows, but got %v, %v", t.Name(), i, tt.rows, r, err)
+		}
+	}
+	if _, err := Lex("with recursive r (n) as (select 1 from stu20 union all select n from r) select * from r;"); !errors.Is(err, storage.ErrRecursionTooDeep) {
+		t.Errorf("%s: then: endless recursive query should fail, but got %v", t.Name(), err)
+	}
+}
+
+func TestSelectWindowFunctions(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu21 (name text, class text, score int);",
+		"insert into stu21 values ('wang', 'a', 90), ('li', 'a', 80), ('zhao', 'b', 85), ('qian', 'b', 85), ('sun', 'b', 70);",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   int
+		first  storage.Row
+	}{
+		{"select name, rank() over (partition by class order by score desc) from stu21 order by class, name;", 5, storage.Row{"li", int64(2)}},
+		{"select name, sum(score) over (order by score rows between 1 preceding and current row) from stu21 order by score, name;", 5, storage.Row{"sun", int64(70)}},
+		{"select name, lag(score) over (order by score desc, name) from stu21 order by score desc, name;", 5, storage.Row{"wang", nil}},
+		{"select class, avg(score), dense_rank() over (order by avg(score) desc) from stu21 group by class order by class;", 2, storage.Row{"a", float64(85), int64(1)}},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Affected != tt.rows || !reflect.DeepEqual(r.Rows[0], tt.first) {
+			t.Errorf("%s: then: test %d should get %d rows starting with %v, but got %v, %v", t.Name(), i, tt.rows, tt.first, r, err)
+		}
+	}
+	if _, err := Lex("select name from stu21 where rank() over () = 1;"); !errors.Is(err, storage.ErrWindowMisplaced) {
+		t.Errorf("%s: then: window function in WHERE should fail, but got %v", t.Name(), err)
+	}
+}
+
+func TestInsertSelectAndReturning(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table stu22 (id int, name text, age int default 18);",
+		"create table stu22old (name text, age int);",
+		"insert into stu22old values ('wang', 20), ('li', 19), ('zhao', 21);",
+		"prepare older22 (int) as update stu22 set age = age + 1 where id = $1 returning name, age;",
+	}
+	for i, tt := range given {
+		if _, err := Lex(tt); err != nil {
+			t.Fatalf("%s: given: test %d should ok, but got err: %v", t.Name(), i, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		tag    string
+		first  storage.Row
+	}{
+		{"insert into stu22 (name, id) values ('sun', 1) returning *;", "INSERT 0 1", storage.Row{int64(1), "sun", int64(18)}},
+		{"insert into stu22 (age, name, id) select age, name, age * 10 from stu22old where age > 19 order by age returning id;", "INSERT 0 2", storage.Row{int64(200)}},
+		{"execute older22 (200);", "UPDATE 1", storage.Row{"wang", int64(21)}},
+		{"delete from stu22 where age > 20 returning name;", "DELETE 2", storage.Row{"wang"}},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := Lex(tt.source)
+		if err != nil || r.Tag != tt.tag || len(r.Rows) == 0 || !reflect.DeepEqual(r.Rows[0], tt.first) {
+			t.Errorf("%s: then: test %d should get %s with first row %v, but got %v, %v", t.Name(), i, tt.tag, tt.first, r, err)
+		}
+	}
+	if _, err := Lex("insert into stu22 select * from stu22old;"); !errors.Is(err, storage.ErrValuesIncomplete) {
+		t.Errorf("%s: then: inserting 2 columns into 3 columns should fail, but got %v", t.Name(), err)
+	}
 }
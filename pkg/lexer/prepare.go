@@ -0,0 +1,199 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+	"github.com/wangwalker/gpostgres/pkg/storage"
+)
+
+var (
+	ErrStatementExisted     = errors.New("prepared statement already exists")
+	ErrStatementNotExisted  = errors.New("prepared statement does not exist")
+	ErrStatementInvalid     = errors.New("only SELECT, INSERT, UPDATE and DELETE could be prepared")
+	ErrParamsNotMatched     = errors.New("wrong number of parameters for prepared statement")
+	ErrParamKindUnsupported = errors.New("parameter type is not supported")
+	ErrParamInvalid         = errors.New("invalid input syntax for parameter")
+)
+
+// The prepared statements by name, they are kept until deallocated.
+var statements = make(map[string]*Statement)
+
+// Statement is the statement parsed once and executed many times with
+// parameters $1, $2 and so on. The parameters are bound to the statement as
+// literals, so their values are never parsed as part of query.
+type Statement struct {
+	stmt ast.QueryStmt
+	// kinds of parameters, it's unknown if the kind isn't declared
+	kinds []ast.ColumnKind
+}
+
+// Prepare parses source to a statement with parameters, which is executed by
+// binding values to parameters in order.
+func Prepare(source string) (*Statement, error) {
+	stmt, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return newStatement(stmt, nil)
+}
+
+// Creates statement with the declared kinds of parameters, the parameters
+// used by stmt but not declared are unknown.
+func newStatement(stmt ast.QueryStmt, kinds []ast.ColumnKind) (*Statement, error) {
+	switch stmt.(type) {
+	case *ast.QueryStmtSelectValues, *ast.QueryStmtSetOperation, *ast.QueryStmtInsertValues, *ast.QueryStmtUpdateValues,
+		*ast.QueryStmtDeleteValues, *ast.QueryStmtWith:
+	default:
+		return nil, ErrStatementInvalid
+	}
+	n := len(kinds)
+	ast.TransformStmt(stmt, func(e ast.Expr) (ast.Expr, bool) {
+		if p, ok := e.(*ast.Param); ok && p.Index > n {
+			n = p.Index
+		}
+		return e, false
+	})
+	s := &Statement{stmt: stmt, kinds: make([]ast.ColumnKind, n)}
+	for i := range s.kinds {
+		s.kinds[i] = ast.ColumnKindUnknown
+		if i < len(kinds) {
+			s.kinds[i] = kinds[i]
+		}
+	}
+	return s, nil
+}
+
+// NumParams returns the number of parameters, which must be bound when
+// executing the statement.
+func (s *Statement) NumParams() int {
+	return len(s.kinds)
+}
+
+// Exec binds args to the parameters of statement and executes it. The args
+// could be nil for NULL, string for TEXT, integers and floats for numbers.
+func (s *Statement) Exec(args ...interface{}) (*storage.Result, error) {
+	params := make([]*ast.Literal, 0, len(args))
+	for i, a := range args {
+		l, err := paramLiteral(a)
+		if err != nil {
+			return nil, fmt.Errorf("%w: $%d", err, i+1)
+		}
+		params = append(params, l)
+	}
+	return s.exec(params)
+}
+
+// Executes the statement with params, which are cast to the declared kinds
+// of parameters before binding.
+func (s *Statement) exec(params []*ast.Literal) (*storage.Result, error) {
+	if len(params) != len(s.kinds) {
+		return nil, fmt.Errorf("%w: expected %d but got %d", ErrParamsNotMatched, len(s.kinds), len(params))
+	}
+	bound := make([]*ast.Literal, 0, len(params))
+	for i, l := range params {
+		l, err := castParam(s.kinds[i], l)
+		if err != nil {
+			return nil, fmt.Errorf("%w: $%d", err, i+1)
+		}
+		bound = append(bound, l)
+	}
+	stmt := ast.TransformStmt(s.stmt, func(e ast.Expr) (ast.Expr, bool) {
+		if p, ok := e.(*ast.Param); ok {
+			return bound[p.Index-1], true
+		}
+		return e, false
+	})
+	return Exec(stmt)
+}
+
+// ParamLiteral converts the value of Go to literal.
+func paramLiteral(v interface{}) (*ast.Literal, error) {
+	var number string
+	switch v := v.(type) {
+	case nil:
+		return &ast.Literal{Kind: ast.LiteralKindNull}, nil
+	case string:
+		return &ast.Literal{Kind: ast.LiteralKindString, Value: v}, nil
+	case int:
+		number = strconv.FormatInt(int64(v), 10)
+	case int8:
+		number = strconv.FormatInt(int64(v), 10)
+	case int16:
+		number = strconv.FormatInt(int64(v), 10)
+	case int32:
+		number = strconv.FormatInt(int64(v), 10)
+	case int64:
+		number = strconv.FormatInt(v, 10)
+	case uint8:
+		number = strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		number = strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		number = strconv.FormatUint(uint64(v), 10)
+	case float32:
+		number = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		number = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrParamKindUnsupported, v)
+	}
+	return &ast.Literal{Kind: ast.LiteralKindNumber, Value: number}, nil
+}
+
+// CastParam casts literal l to parameter of kind k, INT parameter accepts
+// integers and strings of integers, and TEXT parameter accepts any values.
+// The parameter of unknown kind is kept as it is.
+func castParam(k ast.ColumnKind, l *ast.Literal) (*ast.Literal, error) {
+	if l.Kind == ast.LiteralKindNull {
+		return l, nil
+	}
+	switch k {
+	case ast.ColumnKindInt:
+		if _, err := strconv.ParseInt(l.Value, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: type integer \"%s\"", ErrParamInvalid, l.Value)
+		}
+		return &ast.Literal{Kind: ast.LiteralKindNumber, Value: l.Value}, nil
+	case ast.ColumnKindText:
+		return &ast.Literal{Kind: ast.LiteralKindString, Value: l.Value}, nil
+	}
+	return l, nil
+}
+
+// Prepares the statement of PREPARE, name must be unique.
+func prepare(s *ast.QueryStmtPrepare) (*storage.Result, error) {
+	if _, ok := statements[s.Name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatementExisted, s.Name)
+	}
+	stmt, err := newStatement(s.Stmt, s.ParamKinds)
+	if err != nil {
+		return nil, err
+	}
+	statements[s.Name] = stmt
+	return &storage.Result{Tag: "PREPARE"}, nil
+}
+
+// Executes the prepared statement of EXECUTE with its parameters.
+func execute(s *ast.QueryStmtExecute) (*storage.Result, error) {
+	stmt, ok := statements[s.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatementNotExisted, s.Name)
+	}
+	return stmt.exec(s.Params)
+}
+
+// Deallocates the prepared statement of DEALLOCATE, or all of them.
+func deallocate(s *ast.QueryStmtDeallocate) (*storage.Result, error) {
+	if s.All {
+		statements = make(map[string]*Statement)
+		return &storage.Result{Tag: "DEALLOCATE ALL"}, nil
+	}
+	if _, ok := statements[s.Name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatementNotExisted, s.Name)
+	}
+	delete(statements, s.Name)
+	return &storage.Result{Tag: "DEALLOCATE"}, nil
+}
@@ -0,0 +1,70 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for these queries, COLUMN keyword is optional:
+//
+//	ALTER TABLE users ADD COLUMN city TEXT NOT NULL DEFAULT 'beijing';
+//	ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0);
+//	ALTER TABLE users DROP COLUMN city;
+//	ALTER TABLE users RENAME COLUMN city TO town;
+//	ALTER TABLE users RENAME TO members;
+func (p *Parser) parseAlter() (*ast.QueryStmtAlterTable, error) {
+	if err := p.expectKeyword("alter"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtAlterTable{TableName: name}
+	switch {
+	case p.acceptKeyword("add"):
+		if p.isTableConstraint() {
+			stmt.Action = ast.AlterTableActionAddConstraint
+			c, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Constraints = []ast.Constraint{c}
+			break
+		}
+		p.acceptKeyword("column")
+		stmt.Action = ast.AlterTableActionAddColumn
+		if stmt.Column, stmt.Constraints, err = p.parseColumn(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("drop"):
+		p.acceptKeyword("column")
+		stmt.Action = ast.AlterTableActionDropColumn
+		c, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.ColumnName = ast.ColumnName(c)
+	case p.acceptKeyword("rename"):
+		if p.acceptKeyword("to") {
+			stmt.Action = ast.AlterTableActionRenameTable
+		} else {
+			p.acceptKeyword("column")
+			stmt.Action = ast.AlterTableActionRenameColumn
+			c, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ColumnName = ast.ColumnName(c)
+			if err := p.expectKeyword("to"); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.NewName, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.expected("ADD, DROP or RENAME")
+	}
+	return stmt, nil
+}
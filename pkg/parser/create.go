@@ -0,0 +1,291 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// for this query:
+//
+//	CREATE TABLE users (
+//		id INT PRIMARY KEY,
+//		name TEXT NOT NULL,
+//		age INT DEFAULT 18 CHECK (age > 0),
+//		city_id INT REFERENCES cities (id) ON DELETE SET NULL,
+//		CONSTRAINT users_name_age_key UNIQUE (name, age)
+//	);
+func (p *Parser) parseCreate() (*ast.QueryStmtCreateTable, error) {
+	if err := p.expectKeyword("create"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtCreateTable{Name: name, Columns: make([]ast.Column, 0)}
+	for {
+		if p.isTableConstraint() {
+			c, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Constraints = append(stmt.Constraints, c)
+		} else {
+			c, constraints, err := p.parseColumn()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, c)
+			stmt.Constraints = append(stmt.Constraints, constraints...)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if len(stmt.Columns) == 0 {
+		return nil, p.expected("column definition")
+	}
+	return stmt, nil
+}
+
+// parseColumn parses the column definition which is composed of name, type
+// and optional column constraints, like: id INT NOT NULL PRIMARY KEY. The
+// constraints over the column like PRIMARY KEY and UNIQUE are returned.
+func (p *Parser) parseColumn() (ast.Column, []ast.Constraint, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return ast.Column{}, nil, err
+	}
+	kind, err := p.parseColumnKind()
+	if err != nil {
+		return ast.Column{}, nil, err
+	}
+	column := ast.Column{Name: ast.ColumnName(name), Kind: kind}
+	var constraints []ast.Constraint
+	for {
+		var constraint string
+		if p.acceptKeyword("constraint") {
+			if constraint, err = p.parseIdent(); err != nil {
+				return ast.Column{}, nil, err
+			}
+		}
+		switch {
+		case p.acceptKeyword("not"):
+			if err := p.expectKeyword("null"); err != nil {
+				return ast.Column{}, nil, err
+			}
+			column.NotNull = true
+		case p.acceptKeyword("null"):
+			column.NotNull = false
+		case p.acceptKeyword("default"):
+			if column.Default, err = p.parseLiteral(); err != nil {
+				return ast.Column{}, nil, err
+			}
+		case p.isKeyword("primary") || p.isKeyword("unique"):
+			kind, err := p.parseKeyKind()
+			if err != nil {
+				return ast.Column{}, nil, err
+			}
+			c := ast.Constraint{Name: constraint, Kind: kind, Columns: []ast.ColumnName{column.Name}}
+			constraints = append(constraints, c)
+		case p.isKeyword("check"):
+			c := ast.Constraint{Name: constraint, Kind: ast.ConstraintKindCheck}
+			if c.Check, err = p.parseCheck(); err != nil {
+				return ast.Column{}, nil, err
+			}
+			constraints = append(constraints, c)
+		case p.isKeyword("references"):
+			c := ast.Constraint{Name: constraint, Kind: ast.ConstraintKindForeignKey, Columns: []ast.ColumnName{column.Name}}
+			if err := p.parseReferences(&c); err != nil {
+				return ast.Column{}, nil, err
+			}
+			constraints = append(constraints, c)
+		case constraint != "":
+			return ast.Column{}, nil, p.expected("column constraint")
+		default:
+			return column, constraints, nil
+		}
+	}
+}
+
+// parseColumnKind parses the type of column or parameter, like TEXT or INT.
+func (p *Parser) parseColumnKind() (ast.ColumnKind, error) {
+	t := p.peek()
+	if t.Kind != TokenKindIdent {
+		return ast.ColumnKindUnknown, p.expected("column type")
+	}
+	kind := mapColumnKind(t.Value)
+	if kind == ast.ColumnKindUnknown {
+		return kind, fmt.Errorf("%w: %s at position %d", ErrColumnKindUnknown, t.Value, t.Pos)
+	}
+	p.next()
+	return kind, nil
+}
+
+// isTableConstraint reports whether the table constraint starts here.
+func (p *Parser) isTableConstraint() bool {
+	for _, kw := range []string{"constraint", "primary", "unique", "foreign", "check"} {
+		if p.isKeyword(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTableConstraint parses the constraint over columns of table, like:
+// CONSTRAINT users_pkey PRIMARY KEY (id), UNIQUE (name, age), FOREIGN KEY
+// (city_id) REFERENCES cities (id) or CHECK (age > 0 AND name <> 'x').
+func (p *Parser) parseTableConstraint() (ast.Constraint, error) {
+	c := ast.Constraint{}
+	if p.acceptKeyword("constraint") {
+		name, err := p.parseIdent()
+		if err != nil {
+			return c, err
+		}
+		c.Name = name
+	}
+	if p.isKeyword("check") {
+		var err error
+		c.Kind = ast.ConstraintKindCheck
+		c.Check, err = p.parseCheck()
+		return c, err
+	}
+	if p.acceptKeyword("foreign") {
+		if err := p.expectKeyword("key"); err != nil {
+			return c, err
+		}
+		c.Kind = ast.ConstraintKindForeignKey
+	} else {
+		kind, err := p.parseKeyKind()
+		if err != nil {
+			return c, err
+		}
+		c.Kind = kind
+	}
+	columns, err := p.parseColumnNames()
+	if err != nil {
+		return c, err
+	}
+	c.Columns = columns
+	if c.Kind == ast.ConstraintKindForeignKey {
+		return c, p.parseReferences(&c)
+	}
+	return c, nil
+}
+
+// parseCheck parses the expression of CHECK, and returns its source.
+func (p *Parser) parseCheck() (string, error) {
+	if err := p.expectKeyword("check"); err != nil {
+		return "", err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return "", err
+	}
+	start := p.pos
+	if _, err := p.parseExpr(); err != nil {
+		return "", err
+	}
+	end := p.pos
+	if err := p.expectSymbol(")"); err != nil {
+		return "", err
+	}
+	return p.source(start, end), nil
+}
+
+// parseReferences parses the referenced table and columns of FOREIGN KEY,
+// and the optional actions, like: REFERENCES cities (id) ON DELETE CASCADE.
+func (p *Parser) parseReferences(c *ast.Constraint) error {
+	if err := p.expectKeyword("references"); err != nil {
+		return err
+	}
+	table, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	c.RefTable = table
+	if p.isSymbol("(") {
+		if c.RefColumns, err = p.parseColumnNames(); err != nil {
+			return err
+		}
+	}
+	for p.acceptKeyword("on") {
+		var action *ast.ReferentialAction
+		switch {
+		case p.acceptKeyword("delete"):
+			action = &c.OnDelete
+		case p.acceptKeyword("update"):
+			action = &c.OnUpdate
+		default:
+			return p.expected("DELETE or UPDATE")
+		}
+		if *action, err = p.parseReferentialAction(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseReferentialAction parses NO ACTION, RESTRICT, CASCADE or SET NULL.
+func (p *Parser) parseReferentialAction() (ast.ReferentialAction, error) {
+	switch {
+	case p.acceptKeyword("no"):
+		return ast.ReferentialActionNoAction, p.expectKeyword("action")
+	case p.acceptKeyword("restrict"):
+		return ast.ReferentialActionRestrict, nil
+	case p.acceptKeyword("cascade"):
+		return ast.ReferentialActionCascade, nil
+	case p.acceptKeyword("set"):
+		return ast.ReferentialActionSetNull, p.expectKeyword("null")
+	}
+	return 0, p.expected("referential action")
+}
+
+// parseColumnNames parses column names in parentheses, like: (name, age).
+func (p *Parser) parseColumnNames() ([]ast.ColumnName, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	names, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]ast.ColumnName, 0, len(names))
+	for _, n := range names {
+		columns = append(columns, ast.ColumnName(n))
+	}
+	return columns, p.expectSymbol(")")
+}
+
+// parseKeyKind parses PRIMARY KEY or UNIQUE.
+func (p *Parser) parseKeyKind() (ast.ConstraintKind, error) {
+	if p.acceptKeyword("unique") {
+		return ast.ConstraintKindUnique, nil
+	}
+	if err := p.expectKeyword("primary"); err != nil {
+		return 0, err
+	}
+	if err := p.expectKeyword("key"); err != nil {
+		return 0, err
+	}
+	return ast.ConstraintKindPrimaryKey, nil
+}
+
+func mapColumnKind(t string) ast.ColumnKind {
+	switch t {
+	case "text":
+		return ast.ColumnKindText
+	case "int", "integer":
+		return ast.ColumnKindInt
+	}
+	return ast.ColumnKindUnknown
+}
@@ -0,0 +1,26 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: DELETE FROM mytable WHERE a > 0 RETURNING *;
+func (p *Parser) parseDelete() (*ast.QueryStmtDeleteValues, error) {
+	if err := p.expectKeyword("delete"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.QueryStmtDeleteValues{TableName: name, Where: where, Returning: returning}, nil
+}
@@ -0,0 +1,38 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: DROP TABLE IF EXISTS users, orders;
+func (p *Parser) parseDrop() (*ast.QueryStmtDropTable, error) {
+	if err := p.expectKeyword("drop"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtDropTable{}
+	if p.isKeyword("if") && p.lookahead(1).Kind == TokenKindIdent && p.lookahead(1).Value == "exists" {
+		p.next()
+		p.next()
+		stmt.IfExists = true
+	}
+	names, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	stmt.TableNames = names
+	return stmt, nil
+}
+
+// for this query: TRUNCATE TABLE users, orders; TABLE keyword is optional.
+func (p *Parser) parseTruncate() (*ast.QueryStmtTruncateTable, error) {
+	if err := p.expectKeyword("truncate"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("table")
+	names, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.QueryStmtTruncateTable{TableNames: names}, nil
+}
@@ -0,0 +1,507 @@
+package parser
+
+import (
+	"strconv"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// The expressions are parsed by precedence from low to high:
+//
+//	expr       := or
+//	or         := and { OR and }
+//	and        := not { AND not }
+//	not        := NOT not | comparison
+//	comparison := concat [ cmp concat | IS [ NOT ] NULL | predicate ]
+//	predicate  := [ NOT ] ( LIKE concat | ILIKE concat | IN ( expr { , expr } )
+//	              | IN ( query ) | BETWEEN concat AND concat )
+//	concat     := additive { || additive }
+//	additive   := term { ( + | - ) term }
+//	term       := unary { ( * | / | % ) unary }
+//	unary      := ( - | + ) unary | primary
+//	primary    := literal | NULL | $n | column | function | case | ( expr )
+//	              | ( query ) | EXISTS ( query )
+func (p *Parser) parseExpr() (ast.Expr, error) {
+	return p.parseOr()
+}
+
+func (p *Parser) parseOr() (ast.Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.LogicExpr{Op: ast.LogicOpOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (ast.Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.LogicExpr{Op: ast.LogicOpAnd, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (ast.Expr, error) {
+	if p.acceptKeyword("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.NotExpr{Expr: e}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *Parser) parseComparison() (ast.Expr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		if err := p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		return &ast.IsNullExpr{Expr: left, Not: not}, nil
+	}
+	if p.isPredicate() {
+		return p.parsePredicate(left)
+	}
+	cmp, ok := p.acceptCmp()
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.CmpExpr{Cmp: cmp, Left: left, Right: right}, nil
+}
+
+func (p *Parser) parseConcat() (ast.Expr, error) {
+	return p.parseBinary(p.parseAdditive, map[string]ast.BinaryOp{"||": ast.BinaryOpConcat})
+}
+
+func (p *Parser) parseAdditive() (ast.Expr, error) {
+	return p.parseBinary(p.parseTerm, map[string]ast.BinaryOp{"+": ast.BinaryOpAdd, "-": ast.BinaryOpSub})
+}
+
+func (p *Parser) parseTerm() (ast.Expr, error) {
+	ops := map[string]ast.BinaryOp{"*": ast.BinaryOpMul, "/": ast.BinaryOpDiv, "%": ast.BinaryOpMod}
+	return p.parseBinary(p.parseUnary, ops)
+}
+
+// parseBinary parses the left associative operators ops, whose operands are
+// parsed by operand.
+func (p *Parser) parseBinary(operand func() (ast.Expr, error), ops map[string]ast.BinaryOp) (ast.Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op, ok := ops[t.Value]
+		if t.Kind != TokenKindSymbol || !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// parseUnary parses the sign of expression, the signed numbers are parsed as
+// literals.
+func (p *Parser) parseUnary() (ast.Expr, error) {
+	if (p.isSymbol("-") || p.isSymbol("+")) && p.lookahead(1).Kind != TokenKindNumber {
+		neg := p.next().Value == "-"
+		e, err := p.parseUnary()
+		if err != nil || !neg {
+			return e, err
+		}
+		return &ast.NegExpr{Expr: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+// isPredicate reports whether current token starts [NOT] LIKE, ILIKE, IN or
+// BETWEEN.
+func (p *Parser) isPredicate() bool {
+	t := p.peek()
+	if p.isKeyword("not") {
+		t = p.lookahead(1)
+	}
+	if t.Kind != TokenKindIdent {
+		return false
+	}
+	switch t.Value {
+	case "like", "ilike", "in", "between":
+		return true
+	}
+	return false
+}
+
+// parsePredicate parses the predicates of left, like name LIKE 'wa%', age
+// IN (18, 20) or age NOT BETWEEN 18 AND 30.
+func (p *Parser) parsePredicate(left ast.Expr) (ast.Expr, error) {
+	not := p.acceptKeyword("not")
+	switch kw := p.next().Value; kw {
+	case "like", "ilike":
+		pattern, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.LikeExpr{Expr: left, Pattern: pattern, Not: not, Insensitive: kw == "ilike"}, nil
+	case "in":
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &ast.InExpr{Expr: left, Not: not}
+		if p.isKeyword("select") {
+			q, err := p.parseSelectQuery()
+			if err != nil {
+				return nil, err
+			}
+			in.Query = q
+			return in, p.expectSymbol(")")
+		}
+		for {
+			v, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, v)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+	low, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("and"); err != nil {
+		return nil, err
+	}
+	high, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+}
+
+// acceptCmp accepts a comparison operator if current token is.
+func (p *Parser) acceptCmp() (ast.CmpKind, bool) {
+	t := p.peek()
+	if t.Kind != TokenKindSymbol {
+		return 0, false
+	}
+	var cmp ast.CmpKind
+	switch t.Value {
+	case "=", "==":
+		cmp = ast.CmpKindEq
+	case "!=", "<>":
+		cmp = ast.CmpKindNotEq
+	case ">":
+		cmp = ast.CmpKindGt
+	case ">=":
+		cmp = ast.CmpKindGte
+	case "<":
+		cmp = ast.CmpKindLt
+	case "<=":
+		cmp = ast.CmpKindLte
+	default:
+		return 0, false
+	}
+	p.next()
+	return cmp, true
+}
+
+func (p *Parser) parsePrimary() (ast.Expr, error) {
+	t := p.peek()
+	switch {
+	case t.Kind == TokenKindString || t.Kind == TokenKindNumber || p.isSymbol("-") ||
+		p.isSymbol("+") || p.isKeyword("null"):
+		return p.parseLiteral()
+	case t.Kind == TokenKindParam:
+		return p.parseParam()
+	case p.isKeyword("case"):
+		return p.parseCase()
+	case p.isSymbol("(") && p.lookahead(1).Kind == TokenKindIdent && p.lookahead(1).Value == "select":
+		q, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.SubqueryExpr{Query: q}, nil
+	case p.acceptKeyword("exists"):
+		q, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ExistsExpr{Query: q}, nil
+	case p.acceptSymbol("("):
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if t.Kind == TokenKindIdent && !reservedKeywords[t.Value] && p.lookahead(1).Value == "(" &&
+		p.lookahead(1).Kind == TokenKindSymbol {
+		return p.parseFuncCall()
+	}
+	return p.parseColumnRef()
+}
+
+// parseLiteral parses a string, signed number or NULL.
+func (p *Parser) parseLiteral() (*ast.Literal, error) {
+	if p.acceptKeyword("null") {
+		return &ast.Literal{Kind: ast.LiteralKindNull}, nil
+	}
+	kind := ast.LiteralKindNumber
+	if p.peek().Kind == TokenKindString {
+		kind = ast.LiteralKindString
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Literal{Kind: kind, Value: v}, nil
+}
+
+// parseParam parses positional parameter like $1, the number starts from 1.
+func (p *Parser) parseParam() (*ast.Param, error) {
+	t := p.peek()
+	i, err := strconv.Atoi(t.Value)
+	if err != nil || i < 1 {
+		return nil, p.unexpected()
+	}
+	p.next()
+	return &ast.Param{Index: i}, nil
+}
+
+// parseSubquery parses the query in brackets, like (SELECT max(age) FROM
+// users).
+func (p *Parser) parseSubquery() (ast.Query, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	q, err := p.parseSelectQuery()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseCase parses searched CASE like CASE WHEN age < 18 THEN 'minor' END,
+// or simple CASE like CASE age WHEN 18 THEN 'adult' ELSE 'other' END.
+func (p *Parser) parseCase() (*ast.CaseExpr, error) {
+	if err := p.expectKeyword("case"); err != nil {
+		return nil, err
+	}
+	c := &ast.CaseExpr{}
+	var err error
+	if !p.isKeyword("when") {
+		if c.Operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("when") {
+		var w ast.CaseWhen
+		if w.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("then"); err != nil {
+			return nil, err
+		}
+		if w.Result, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, w)
+	}
+	if len(c.Whens) == 0 {
+		return nil, p.expected("WHEN")
+	}
+	if p.acceptKeyword("else") {
+		if c.Else, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("end"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseFuncCall parses function call like count(*) or sum(age), which could
+// be followed by OVER clause of window function.
+func (p *Parser) parseFuncCall() (*ast.FuncCall, error) {
+	name := p.next().Value
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	f := &ast.FuncCall{Name: name}
+	if p.acceptSymbol("*") {
+		f.Star = true
+	} else if !p.isSymbol(")") {
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			f.Args = append(f.Args, e)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("over") {
+		w, err := p.parseWindow()
+		if err != nil {
+			return nil, err
+		}
+		f.Over = w
+	}
+	return f, nil
+}
+
+// parseWindow parses the window of OVER clause in brackets, like (PARTITION BY
+// city ORDER BY age ROWS BETWEEN 1 PRECEDING AND CURRENT ROW), all clauses
+// are optional.
+func (p *Parser) parseWindow() (*ast.WindowSpec, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	w := &ast.WindowSpec{}
+	if p.acceptKeyword("partition") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			w.PartitionBy = append(w.PartitionBy, e)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	var err error
+	if w.OrderBy, err = p.parseOrderBy(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("rows") {
+		if w.Frame, err = p.parseFrame(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// parseFrame parses the frame after ROWS, which is BETWEEN start AND end, or
+// start only whose end is CURRENT ROW. The frame can't start from UNBOUNDED
+// FOLLOWING or end at UNBOUNDED PRECEDING.
+func (p *Parser) parseFrame() (*ast.WindowFrame, error) {
+	between := p.acceptKeyword("between")
+	start, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	f := &ast.WindowFrame{Start: start, End: ast.FrameBound{Kind: ast.FrameBoundCurrentRow}}
+	if between {
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		if f.End, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Start.Kind == ast.FrameBoundUnboundedFollowing || f.End.Kind == ast.FrameBoundUnboundedPreceding ||
+		f.Start.Kind > f.End.Kind {
+		return nil, ErrQuerySyntaxInvalid
+	}
+	return f, nil
+}
+
+// parseFrameBound parses UNBOUNDED PRECEDING, n PRECEDING, CURRENT ROW,
+// n FOLLOWING or UNBOUNDED FOLLOWING.
+func (p *Parser) parseFrameBound() (ast.FrameBound, error) {
+	if p.acceptKeyword("current") {
+		return ast.FrameBound{Kind: ast.FrameBoundCurrentRow}, p.expectKeyword("row")
+	}
+	b := ast.FrameBound{}
+	unbounded := p.acceptKeyword("unbounded")
+	if !unbounded {
+		var err error
+		if b.Offset, err = p.parsePrimary(); err != nil {
+			return ast.FrameBound{}, err
+		}
+	}
+	switch {
+	case p.acceptKeyword("preceding"):
+		b.Kind = ast.FrameBoundPreceding
+		if unbounded {
+			b.Kind = ast.FrameBoundUnboundedPreceding
+		}
+	case p.acceptKeyword("following"):
+		b.Kind = ast.FrameBoundFollowing
+		if unbounded {
+			b.Kind = ast.FrameBoundUnboundedFollowing
+		}
+	default:
+		return ast.FrameBound{}, p.expected("PRECEDING or FOLLOWING")
+	}
+	return b, nil
+}
+
+// parseColumnRef parses column name which could be qualified by table name,
+// like users.name.
+func (p *Parser) parseColumnRef() (*ast.ColumnRef, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol(".") {
+		return &ast.ColumnRef{Name: ast.ColumnName(name)}, nil
+	}
+	column, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.ColumnRef{Table: name, Name: ast.ColumnName(column)}, nil
+}
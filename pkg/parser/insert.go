@@ -0,0 +1,89 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: INSERT INTO products (no, name) VALUES (1, 'Cheese'), (2, 'Bread');
+// the column names are optional, the rows could be returned by a query like
+// INSERT INTO products SELECT * FROM goods, and the optional RETURNING clause
+// is at the end.
+func (p *Parser) parseInsert() (*ast.QueryStmtInsertValues, error) {
+	if err := p.expectKeyword("insert"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtInsertValues{TableName: name}
+	// the bracket starts the query instead of column names, like (SELECT ...)
+	if t := p.lookahead(1); p.isSymbol("(") && (t.Kind != TokenKindIdent || t.Value != "select") {
+		if stmt.ColumnNames, err = p.parseColumnNames(); err != nil {
+			return nil, err
+		}
+	}
+	stmt.ContainsAllColumns = len(stmt.ColumnNames) == 0
+	switch {
+	case p.acceptKeyword("values"):
+		for {
+			row, err := p.parseRow()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Rows = append(stmt.Rows, row)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	case p.isKeyword("select") || p.isSymbol("("):
+		if stmt.Query, err = p.parseSelectQuery(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.expected("VALUES or SELECT")
+	}
+	if stmt.Returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseReturning parses the optional RETURNING clause, if there isn't
+// returning keyword, nil is returned.
+func (p *Parser) parseReturning() (*ast.Returning, error) {
+	if !p.acceptKeyword("returning") {
+		return nil, nil
+	}
+	if p.acceptSymbol("*") {
+		return &ast.Returning{ContainsAllColumns: true}, nil
+	}
+	columns, err := p.parseSelectList()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Returning{Columns: columns}, nil
+}
+
+// parseRow parses values in brackets like: ('walker', 18, NULL).
+func (p *Parser) parseRow() (ast.Row, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	row := make(ast.Row, 0)
+	for {
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
 )
 
 type QueryType uint
@@ -22,14 +26,25 @@ const (
 )
 
 // Prepare parses the type of incoming query, if valid, return its type, otherwise QueryTypeUnkown.
+// A statement is complete if its last token is a semicolon, so the comments
+// after it are ignored, and a semicolon in strings or comments doesn't end it.
+// The query which can't be scanned is complete too, unless its string, quoted
+// identifier or comment isn't terminated yet.
 func Prepare(query string) QueryType {
 	if strings.HasPrefix(query, "\\") {
 		return QueryTypeCommand
-	} else if strings.HasSuffix(query, ";") {
+	}
+	tokens, err := Scan(query)
+	if err != nil {
+		if errors.Is(err, ErrStringUnterminated) || errors.Is(err, ErrIdentifierUnterminated) || errors.Is(err, ErrCommentUnterminated) {
+			return QueryTypeUnkown
+		}
+		return QueryTypeNormal
+	}
+	if n := len(tokens); n > 1 && tokens[n-2].Kind == TokenKindSymbol && tokens[n-2].Value == ";" {
 		return QueryTypeNormal
-	} else {
-		return QueryTypeUnkown
 	}
+	return QueryTypeUnkown
 }
 
 // ParseCommand tests if a command is valid. If so, return the right CommandType,
@@ -39,7 +54,7 @@ func ParseCommand(c string) (CommandType, string) {
 	comand = strings.TrimSpace(comand)
 	if strings.HasPrefix(comand, "d ") {
 		tn := strings.Replace(comand, "d ", "", 1)
-		return SchemeCommand, strings.TrimSpace(tn)
+		return SchemeCommand, identName(strings.TrimSpace(tn))
 	}
 	t := UnknownCommand
 	switch comand {
@@ -52,3 +67,304 @@ func ParseCommand(c string) (CommandType, string) {
 	}
 	return t, ""
 }
+
+// identName returns the name of identifier s, which is folded to lower case
+// unless it's quoted, like the names in queries.
+func identName(s string) string {
+	tokens, err := Scan(s)
+	if err != nil || len(tokens) != 2 || (tokens[0].Kind != TokenKindIdent && tokens[0].Kind != TokenKindQuotedIdent) {
+		return s
+	}
+	return tokens[0].Value
+}
+
+var (
+	ErrQuerySyntaxInvalid = errors.New("syntax is wrong")
+	ErrQueryEmpty         = errors.New("query is empty")
+	ErrColumnKindUnknown  = errors.New("column type is unknown")
+)
+
+// Keywords which can't be used as table or column names without quotes.
+var reservedKeywords = map[string]bool{
+	"create": true, "table": true, "insert": true, "into": true, "values": true,
+	"select": true, "from": true, "where": true, "update": true, "set": true,
+	"delete": true, "and": true, "or": true, "not": true, "order": true,
+	"limit": true, "offset": true, "group": true, "having": true, "as": true,
+	"join": true, "inner": true, "left": true, "right": true, "full": true,
+	"outer": true, "cross": true, "on": true, "drop": true, "truncate": true,
+	"alter": true, "column": true, "to": true, "null": true, "is": true,
+	"primary": true, "unique": true, "constraint": true, "default": true,
+	"foreign": true, "references": true, "check": true, "case": true,
+	"when": true, "then": true, "else": true, "end": true, "like": true,
+	"ilike": true, "in": true, "between": true, "distinct": true, "all": true,
+	"union": true, "intersect": true, "except": true, "exists": true,
+	"with": true, "returning": true,
+}
+
+// Parser is a recursive descent parser, which composes the statement from the
+// tokens of a query.
+type Parser struct {
+	tokens []Token
+	pos    int
+}
+
+// Parse parses one statement from source, the trailing semicolon is optional.
+func Parse(source string) (ast.QueryStmt, error) {
+	tokens, err := Scan(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &Parser{tokens: tokens}
+	return p.parseStatement()
+}
+
+func (p *Parser) parseStatement() (ast.QueryStmt, error) {
+	if p.peek().Kind == TokenKindEOF {
+		return nil, ErrQueryEmpty
+	}
+	var stmt ast.QueryStmt
+	var err error
+	switch {
+	case p.isKeyword("prepare"):
+		stmt, err = p.parsePrepare()
+	case p.isKeyword("execute"):
+		stmt, err = p.parseExecute()
+	case p.isKeyword("deallocate"):
+		stmt, err = p.parseDeallocate()
+	default:
+		stmt, err = p.parseQuery()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if p.peek().Kind != TokenKindEOF {
+		return nil, p.unexpected()
+	}
+	return stmt, nil
+}
+
+// parseQuery parses the statement of creating or manipulating tables, which
+// could be prepared except the ones creating or altering tables.
+func (p *Parser) parseQuery() (ast.QueryStmt, error) {
+	switch {
+	case p.isKeyword("create"):
+		return p.parseCreate()
+	case p.isKeyword("insert"):
+		return p.parseInsert()
+	case p.isKeyword("select") || p.isSymbol("("):
+		return p.parseSelectQuery()
+	case p.isKeyword("with"):
+		return p.parseWith()
+	case p.isKeyword("update"):
+		return p.parseUpdate()
+	case p.isKeyword("delete"):
+		return p.parseDelete()
+	case p.isKeyword("drop"):
+		return p.parseDrop()
+	case p.isKeyword("truncate"):
+		return p.parseTruncate()
+	case p.isKeyword("alter"):
+		return p.parseAlter()
+	}
+	return nil, p.unexpected()
+}
+
+// ParseExpr parses an expression from source, like the source of CHECK which
+// is saved with the table.
+func ParseExpr(source string) (ast.Expr, error) {
+	tokens, err := Scan(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &Parser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Kind != TokenKindEOF {
+		return nil, p.unexpected()
+	}
+	return e, nil
+}
+
+// RenameColumn renames the column references of c to n in the source of an
+// expression, the names of tables and functions aren't renamed.
+func RenameColumn(source, c, n string) (string, error) {
+	tokens, err := Scan(source)
+	if err != nil {
+		return "", err
+	}
+	// n is quoted unless it's scanned as the same name
+	renamed := Token{Kind: TokenKindQuotedIdent, Value: n}
+	if ts, err := Scan(n); err == nil && len(ts) == 2 && ts[0].Kind == TokenKindIdent && ts[0].Value == n && !reservedKeywords[n] {
+		renamed.Kind = TokenKindIdent
+	}
+	for i, t := range tokens {
+		if (t.Kind != TokenKindIdent && t.Kind != TokenKindQuotedIdent) || t.Value != c {
+			continue
+		}
+		if next := tokens[i+1]; next.Kind == TokenKindSymbol && (next.Value == "(" || next.Value == ".") {
+			continue
+		}
+		tokens[i] = renamed
+	}
+	return joinTokens(tokens[:len(tokens)-1]), nil
+}
+
+// source returns the source of tokens from start to end, which is composed
+// again by the tokens, so the spaces and comments are normalized.
+func (p *Parser) source(start, end int) string {
+	return joinTokens(p.tokens[start:end])
+}
+
+// joinTokens joins tokens with spaces, except the ones around dots, after
+// opening brackets, before closing brackets and commas, and between names of
+// functions and their brackets.
+func joinTokens(tokens []Token) string {
+	var sb strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			prev := tokens[i-1]
+			glued := (prev.Kind == TokenKindSymbol && (prev.Value == "(" || prev.Value == ".")) ||
+				(t.Kind == TokenKindSymbol && (t.Value == ")" || t.Value == "," || t.Value == ".")) ||
+				(t.Kind == TokenKindSymbol && t.Value == "(" && prev.Kind == TokenKindIdent && !reservedKeywords[prev.Value])
+			if !glued {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(t.String())
+	}
+	return sb.String()
+}
+
+// parseWhere parses the optional where clause, if there isn't where keyword,
+// nil is returned.
+func (p *Parser) parseWhere() (ast.Expr, error) {
+	if !p.acceptKeyword("where") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// parseValue parses a string or numeric literal, numbers could have sign.
+func (p *Parser) parseValue() (string, error) {
+	sign := ""
+	if p.isSymbol("-") || p.isSymbol("+") {
+		sign = p.next().Value
+		if p.peek().Kind != TokenKindNumber {
+			return "", p.unexpected()
+		}
+	}
+	switch t := p.peek(); t.Kind {
+	case TokenKindString, TokenKindNumber:
+		p.next()
+		if sign == "-" {
+			return sign + t.Value, nil
+		}
+		return t.Value, nil
+	}
+	return "", p.unexpected()
+}
+
+// parseIdent parses a table or column name, reserved keywords can only be
+// used as names when they are quoted.
+func (p *Parser) parseIdent() (string, error) {
+	t := p.peek()
+	switch {
+	case t.Kind == TokenKindQuotedIdent:
+	case t.Kind == TokenKindIdent && !reservedKeywords[t.Value]:
+	default:
+		return "", p.unexpected()
+	}
+	p.next()
+	return t.Value, nil
+}
+
+// parseIdentList parses names separated by comma.
+func (p *Parser) parseIdentList() ([]string, error) {
+	names := make([]string, 0)
+	for {
+		n, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+		if !p.acceptSymbol(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *Parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+// lookahead returns the token after n tokens of current one, it's EOF if
+// there aren't enough tokens.
+func (p *Parser) lookahead(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+// next returns current token and moves to the next, it stays at the last
+// token which is always EOF.
+func (p *Parser) next() Token {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *Parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.Kind == TokenKindIdent && t.Value == kw
+}
+
+func (p *Parser) isSymbol(s string) bool {
+	t := p.peek()
+	return t.Kind == TokenKindSymbol && t.Value == s
+}
+
+func (p *Parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) acceptSymbol(s string) bool {
+	if p.isSymbol(s) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.expected(strings.ToUpper(kw))
+	}
+	return nil
+}
+
+func (p *Parser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return p.expected(s)
+	}
+	return nil
+}
+
+func (p *Parser) unexpected() error {
+	t := p.peek()
+	return fmt.Errorf("%w: unexpected %s at position %d", ErrQuerySyntaxInvalid, t, t.Pos)
+}
+
+func (p *Parser) expected(want string) error {
+	t := p.peek()
+	return fmt.Errorf("%w: expected %s but got %s at position %d", ErrQuerySyntaxInvalid, want, t, t.Pos)
+}
@@ -1,6 +1,11 @@
 package parser
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
 
 func TestPrepare(t *testing.T) {
 	queryTests := []struct {
@@ -20,6 +25,13 @@ func TestPrepare(t *testing.T) {
 		{"create table users (name text)", QueryTypeUnkown},
 		{"create table users (name text);", QueryTypeNormal},
 		{"create table users (name text, age int);", QueryTypeNormal},
+		{"create table users (name text); -- note", QueryTypeNormal},
+		{"create table users (name text) -- note;", QueryTypeUnkown},
+		{"create table users (name text) /* note; */", QueryTypeUnkown},
+		{"insert into users values ('a;", QueryTypeUnkown},
+		{"insert into users values ('a;');", QueryTypeNormal},
+		{"select 1 /* note", QueryTypeUnkown},
+		{"select @", QueryTypeNormal},
 	}
 
 	for _, tt := range queryTests {
@@ -56,3 +68,901 @@ func TestParseCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestParseCommandTableName(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		name string
+	}{
+		{"\\d users", "users"},
+		{"\\d Users ", "users"},
+		{"\\d \"MixedCase\"", "MixedCase"},
+	}
+
+	for _, tt := range tests {
+		_, name := ParseCommand(tt.cmd)
+		if name != tt.name {
+			t.Errorf("input string %s should describe table %s, but got %s", tt.cmd, tt.name, name)
+		}
+	}
+}
+
+func TestParseSucceed(t *testing.T) {
+	parseTests := []struct {
+		source string
+		kind   ast.QueryStmtKind
+	}{
+		{"create table users (name text, age int);", ast.QueryStmtKindCreate},
+		{"CREATE TABLE \"Select\" (\"from\" TEXT, age INTEGER)", ast.QueryStmtKindCreate},
+		{"insert into users values ('walker wang', 18), ('jack', -3);", ast.QueryStmtKindInsert},
+		{"insert into users (name, age) values ('O''Brien', 20)", ast.QueryStmtKindInsert},
+		{"select * from users;", ast.QueryStmtKindSelect},
+		{"select (name, age) from users where age >= 18;", ast.QueryStmtKindSelect},
+		{"select name from users /* comment */ where name = 'a b';", ast.QueryStmtKindSelect},
+		{"update users set name = 'a', age = 1 where name <> 'b';", ast.QueryStmtKindUpdate},
+		{"delete from users;", ast.QueryStmtKindDelete},
+		{"delete from users where age < 3 -- comment", ast.QueryStmtKindDelete},
+		{"select * from users order by age;", ast.QueryStmtKindSelect},
+		{"select * from users order by age desc, name asc nulls first limit 2;", ast.QueryStmtKindSelect},
+		{"select * from users offset 2 rows limit all;", ast.QueryStmtKindSelect},
+		{"select count(*), max(age) from users;", ast.QueryStmtKindSelect},
+		{"select city, avg(age) from users group by city having count(*) > 1 order by city;", ast.QueryStmtKindSelect},
+		{"select u.name, o.item from users u join orders as o on u.id = o.uid;", ast.QueryStmtKindSelect},
+		{"select * from a left outer join b on a.x = b.y right join c on c.z = b.y full join d on c.z = d.z;", ast.QueryStmtKindSelect},
+		{"select * from a, b cross join c inner join d on a.x = d.x;", ast.QueryStmtKindSelect},
+		{"drop table users;", ast.QueryStmtKindDrop},
+		{"drop table if exists users, orders;", ast.QueryStmtKindDrop},
+		{"truncate users;", ast.QueryStmtKindTruncate},
+		{"truncate table users, orders;", ast.QueryStmtKindTruncate},
+		{"alter table users add column city text;", ast.QueryStmtKindAlter},
+		{"alter table users drop city;", ast.QueryStmtKindAlter},
+		{"alter table users rename to members;", ast.QueryStmtKindAlter},
+		{"select * from users where age is null or name is not null;", ast.QueryStmtKindSelect},
+		{"update users set age = null where age is not null;", ast.QueryStmtKindUpdate},
+		{"update users u set age = u.age + 1, name = upper(name) where id in (1, 2);", ast.QueryStmtKindUpdate},
+		{"update users set name = o.name from orders o, items i where users.id = o.uid;", ast.QueryStmtKindUpdate},
+		{"create table users (id int primary key, name text not null unique, age int null default -1);", ast.QueryStmtKindCreate},
+		{"create table users (id int, name text default null, constraint users_key unique (id, name));", ast.QueryStmtKindCreate},
+		{"alter table users add column email text constraint users_email unique;", ast.QueryStmtKindAlter},
+		{"create table orders (id int, uid int references users on delete cascade on update set null);", ast.QueryStmtKindCreate},
+		{"create table orders (id int, uid int, foreign key (uid) references users (id) on update no action on delete restrict);", ast.QueryStmtKindCreate},
+		{"create table users (age int check (age > 0), name text, check (name <> '' or age is null));", ast.QueryStmtKindCreate},
+		{"alter table users add constraint users_age check (age < 200);", ast.QueryStmtKindAlter},
+		{"alter table users add unique (name, age);", ast.QueryStmtKindAlter},
+		{"alter table users add foreign key (cid) references cities;", ast.QueryStmtKindAlter},
+	}
+
+	for _, tt := range parseTests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if stmt.Kind() != tt.kind {
+			t.Errorf("parse %q should get kind %v, but got %v", tt.source, tt.kind, stmt.Kind())
+		}
+	}
+}
+
+func TestParseFailed(t *testing.T) {
+	parseTests := []string{
+		"",
+		";",
+		"create table users",
+		"create table users ()",
+		"create table users (name)",
+		"create table users (name float)",
+		"create table users (name text,)",
+		"create table select (name text)",
+		"insert into users values",
+		"insert into users values ()",
+		"insert into users values ('a') ('b')",
+		"insert into users (name text) values ('a')",
+		"select from users",
+		"select * from",
+		"select * from users where",
+		"select * from users where name 'a'",
+		"select * from users name = 'a'",
+		"select (name from users",
+		"update users name = 'a'",
+		"update users set name = 'a' where",
+		"update users set name = 'a' from",
+		"update users set name = 'a' from orders join items",
+		"update users set age = age + where id = 1",
+		"delete users",
+		"delete from users where name == 'a' and",
+		"select * from users where (name = 'a'",
+		"select * from users where name = 'a' or not",
+		"select * from users where a.b.c = 1",
+		"select * from users; select * from users;",
+		"select * from users order age",
+		"select * from users order by",
+		"select * from users order by age nulls",
+		"select * from users limit",
+		"select * from users limit 1 limit 2",
+		"select * from users limit 1 where age = 1",
+		"select count(* from users",
+		"select count(age,) from users",
+		"select city from users group city",
+		"select city from users group by",
+		"select city from users having",
+		"select city from users having count(*) > 1 group by city",
+		"select * from a join b",
+		"select * from a join b on",
+		"select * from a cross join b on a.x = b.x",
+		"select * from a left b on a.x = b.x",
+		"select * from a as",
+		"select * from a,",
+		"drop users",
+		"drop table",
+		"drop table if exists",
+		"truncate",
+		"alter table users",
+		"alter table users add column city",
+		"alter table users drop column",
+		"alter table users rename city town",
+		"alter table users rename to",
+		"select * from users where age is",
+		"select * from users where age is not",
+		"select * from users where age is not 1",
+		"select * from users where null is null is null",
+		"create table users (id int primary)",
+		"create table users (id int not)",
+		"create table users (id int default)",
+		"create table users (id int default age)",
+		"create table users (id int constraint users_pkey)",
+		"create table users (unique (id))",
+		"create table users (id int, primary key id)",
+		"create table users (id int, unique ())",
+		"create table orders (uid int references)",
+		"create table orders (uid int references users ())",
+		"create table orders (uid int references users on delete)",
+		"create table orders (uid int references users on insert cascade)",
+		"create table orders (uid int references users on delete set default)",
+		"create table orders (uid int references users on update no)",
+		"create table orders (uid int, foreign (uid) references users)",
+		"create table orders (uid int, foreign key (uid))",
+		"create table users (age int check)",
+		"create table users (age int check ())",
+		"create table users (age int check (age >))",
+		"create table users (age int check age > 0)",
+		"create table users (age int, constraint check (age > 0))",
+		"alter table users add constraint users_age",
+		"alter table users add check (age > 0",
+		"prepare q",
+		"prepare q as",
+		"prepare q () as select * from users",
+		"prepare q (float) as select * from users",
+		"prepare q as drop table users",
+		"select * from users where age > $0",
+		"execute",
+		"execute q (age)",
+		"execute q (1",
+		"deallocate",
+		"select a as from t",
+		"select a + from t",
+		"select case end from t",
+		"select case when a then b from t",
+		"select case a when 1 then 2 else 3 from t",
+		"select (a, b from t",
+		"select * from t where a like",
+		"select distinct from t",
+		"select a from t union",
+		"select a from t union all",
+		"select a from t order by a union select a from u",
+		"(select a from t",
+		"(select a from t limit 1) limit 2",
+		"select a from t intersect (select a from u",
+		"select distinct on name from t",
+		"select distinct on () name from t",
+		"select distinct on (name name from t",
+		"select * from t where a not",
+		"select * from t where a in ()",
+		"select * from t where a in (1, 2",
+		"select * from t where a between 1",
+		"select * from t where a between 1 or 2",
+		"select * from t where a in (select",
+		"select * from t where a in (select b from u",
+		"select * from t where exists",
+		"select * from t where exists select b from u",
+		"select exists from t",
+		"select (select b from u from t",
+		"with t as select a from u select * from t",
+		"with t (a as (select a from u) select * from t",
+		"with t as (select a from u)",
+		"with t as (select a from u), select * from t",
+		"with t as (select a from u) drop table t",
+		"select rank() over from t",
+		"select rank() over (order by a from t",
+		"select sum(a) over (rows between current row and 1 preceding) from t",
+		"select sum(a) over (rows unbounded following) from t",
+		"select sum(a) over (rows between 1 preceding) from t",
+		"select sum(a) over (rows 1) from t",
+		"insert into t (a) select",
+		"insert into t (a) update u set a = 1",
+		"insert into t values (1) returning",
+		"insert into t values (1) returning *, a",
+		"update t set a = 1 returning a,",
+		"delete from t returning",
+	}
+
+	for _, tt := range parseTests {
+		if _, err := Parse(tt); err == nil {
+			t.Errorf("parse %q should fail, but err is nil", tt)
+		}
+	}
+}
+
+func TestParseInsertValues(t *testing.T) {
+	// GIVEN
+	source := "INSERT INTO users (name, age) VALUES ('walker wang', 18), ('O''Brien', -20), (NULL, null);"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	insert, ok := stmt.(*ast.QueryStmtInsertValues)
+	if !ok {
+		t.Fatalf("statement should be insert, but got %T", stmt)
+	}
+	if insert.TableName != "users" || len(insert.ColumnNames) != 2 || insert.ContainsAllColumns {
+		t.Errorf("insert statement is not correct: %+v", insert)
+	}
+	want := []ast.Row{
+		{&ast.Literal{Kind: ast.LiteralKindString, Value: "walker wang"}, &ast.Literal{Kind: ast.LiteralKindNumber, Value: "18"}},
+		{&ast.Literal{Kind: ast.LiteralKindString, Value: "O'Brien"}, &ast.Literal{Kind: ast.LiteralKindNumber, Value: "-20"}},
+		{&ast.Literal{Kind: ast.LiteralKindNull}, &ast.Literal{Kind: ast.LiteralKindNull}},
+	}
+	if !reflect.DeepEqual(insert.Rows, want) {
+		t.Errorf("rows should be %#v, but got %#v", want, insert.Rows)
+	}
+}
+
+func TestParseWhereExpr(t *testing.T) {
+	// GIVEN
+	source := "select * from t where not (a = 1 or t.b == 'x') and c <> d"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	where := stmt.(*ast.QueryStmtSelectValues).Where
+	and, ok := where.(*ast.LogicExpr)
+	if !ok || and.Op != ast.LogicOpAnd {
+		t.Fatalf("root should be AND, but got %#v", where)
+	}
+	not, ok := and.Left.(*ast.NotExpr)
+	if !ok {
+		t.Fatalf("left of AND should be NOT, but got %#v", and.Left)
+	}
+	or, ok := not.Expr.(*ast.LogicExpr)
+	if !ok || or.Op != ast.LogicOpOr {
+		t.Fatalf("operand of NOT should be OR, but got %#v", not.Expr)
+	}
+	if c, ok := or.Right.(*ast.CmpExpr); !ok || c.Left.(*ast.ColumnRef).Table != "t" {
+		t.Errorf("right of OR should compare qualified column, but got %#v", or.Right)
+	}
+	cmp, ok := and.Right.(*ast.CmpExpr)
+	if !ok || cmp.Cmp != ast.CmpKindNotEq {
+		t.Fatalf("right of AND should be <>, but got %#v", and.Right)
+	}
+	if _, ok := cmp.Right.(*ast.ColumnRef); !ok {
+		t.Errorf("right of <> should be column, but got %#v", cmp.Right)
+	}
+}
+
+func TestParseOrderByAndLimit(t *testing.T) {
+	// GIVEN
+	source := "select * from t where a > 1 order by a desc, t.b nulls last, c asc limit 10 offset 5"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	s := stmt.(*ast.QueryStmtSelectValues)
+	if len(s.OrderBy) != 3 {
+		t.Fatalf("select should have 3 sort keys, but got %d", len(s.OrderBy))
+	}
+	if !s.OrderBy[0].Desc || s.OrderBy[0].Nulls != ast.NullsOrderDefault {
+		t.Errorf("first key should be DESC, but got %#v", s.OrderBy[0])
+	}
+	if c, ok := s.OrderBy[1].Expr.(*ast.ColumnRef); !ok || c.Table != "t" || c.Name != "b" {
+		t.Errorf("second key should be t.b, but got %#v", s.OrderBy[1].Expr)
+	}
+	if s.OrderBy[1].Desc || s.OrderBy[1].Nulls != ast.NullsOrderLast {
+		t.Errorf("second key should be ASC NULLS LAST, but got %#v", s.OrderBy[1])
+	}
+	if l, ok := s.Limit.(*ast.Literal); !ok || l.Value != "10" {
+		t.Errorf("limit should be 10, but got %#v", s.Limit)
+	}
+	if o, ok := s.Offset.(*ast.Literal); !ok || o.Value != "5" {
+		t.Errorf("offset should be 5, but got %#v", s.Offset)
+	}
+}
+
+func TestParseGroupByAndHaving(t *testing.T) {
+	// GIVEN
+	source := "select city, count(*), sum(age) from t group by city, t.age having count(*) >= 2"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	s := stmt.(*ast.QueryStmtSelectValues)
+	if len(s.Columns) != 3 {
+		t.Fatalf("select should have 3 columns, but got %d", len(s.Columns))
+	}
+	if f, ok := s.Columns[1].Expr.(*ast.FuncCall); !ok || f.Name != "count" || !f.Star || len(f.Args) != 0 {
+		t.Errorf("second column should be count(*), but got %#v", s.Columns[1].Expr)
+	}
+	if f, ok := s.Columns[2].Expr.(*ast.FuncCall); !ok || f.Name != "sum" || f.Star || len(f.Args) != 1 {
+		t.Errorf("third column should be sum(age), but got %#v", s.Columns[2].Expr)
+	}
+	if len(s.GroupBy) != 2 {
+		t.Errorf("select should have 2 group keys, but got %d", len(s.GroupBy))
+	}
+	if c, ok := s.Having.(*ast.CmpExpr); !ok || c.Cmp != ast.CmpKindGte {
+		t.Errorf("having should be count(*) >= 2, but got %#v", s.Having)
+	}
+}
+
+func TestParseJoins(t *testing.T) {
+	// GIVEN
+	source := "select * from users u left join orders o on u.id = o.uid, items cross join shops as s"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	s := stmt.(*ast.QueryStmtSelectValues)
+	if s.TableName != "users" || s.Alias != "u" {
+		t.Errorf("first table should be users u, but got %s %s", s.TableName, s.Alias)
+	}
+	want := []ast.Join{
+		{Kind: ast.JoinKindLeft, TableName: "orders", Alias: "o"},
+		{Kind: ast.JoinKindCross, TableName: "items"},
+		{Kind: ast.JoinKindCross, TableName: "shops", Alias: "s"},
+	}
+	if len(s.Joins) != len(want) {
+		t.Fatalf("select should have %d joins, but got %d", len(want), len(s.Joins))
+	}
+	for i, j := range s.Joins {
+		if j.Kind != want[i].Kind || j.TableName != want[i].TableName || j.Alias != want[i].Alias {
+			t.Errorf("join %d should be %#v, but got %#v", i, want[i], j)
+		}
+		if (j.On == nil) != (j.Kind == ast.JoinKindCross) {
+			t.Errorf("join %d should have ON clause only if it isn't CROSS JOIN", i)
+		}
+	}
+}
+
+func TestParseCreateTableConstraints(t *testing.T) {
+	// GIVEN
+	source := `CREATE TABLE users (
+		id INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		age INT DEFAULT 18 CHECK (age>0),
+		city_id INT REFERENCES cities ON DELETE SET NULL,
+		city TEXT,
+		CONSTRAINT users_name_age UNIQUE (name, age),
+		CONSTRAINT users_city_fkey FOREIGN KEY (city, city_id) REFERENCES cities (name, id) ON UPDATE CASCADE,
+		CHECK (city <> 'x' /* comment */ OR NOT (age>=18 AND "Age" < upper( name )))
+	);`
+
+	// WHEN
+	stmt, err := Parse(source)
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+
+	// THEN
+	want := ast.QueryStmtCreateTable{
+		Name: "users",
+		Columns: []ast.Column{
+			{Name: "id", Kind: ast.ColumnKindInt},
+			{Name: "name", Kind: ast.ColumnKindText, NotNull: true},
+			{Name: "age", Kind: ast.ColumnKindInt, Default: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "18"}},
+			{Name: "city_id", Kind: ast.ColumnKindInt},
+			{Name: "city", Kind: ast.ColumnKindText},
+		},
+		Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+			{Kind: ast.ConstraintKindCheck, Check: "age > 0"},
+			{Kind: ast.ConstraintKindForeignKey, Columns: []ast.ColumnName{"city_id"}, RefTable: "cities", OnDelete: ast.ReferentialActionSetNull},
+			{Name: "users_name_age", Kind: ast.ConstraintKindUnique, Columns: []ast.ColumnName{"name", "age"}},
+			{
+				Name: "users_city_fkey", Kind: ast.ConstraintKindForeignKey, Columns: []ast.ColumnName{"city", "city_id"},
+				RefTable: "cities", RefColumns: []ast.ColumnName{"name", "id"}, OnUpdate: ast.ReferentialActionCascade,
+			},
+			{Kind: ast.ConstraintKindCheck, Check: `city <> 'x' or not (age >= 18 and "Age" < upper(name))`},
+		},
+	}
+	if s := stmt.(*ast.QueryStmtCreateTable); !reflect.DeepEqual(*s, want) {
+		t.Errorf("parse %q should get %#v, but got %#v", source, want, *s)
+	}
+}
+
+func TestRenameColumn(t *testing.T) {
+	tests := []struct {
+		source string
+		c, n   string
+		want   string
+	}{
+		{"age > 0", "age", "years", "years > 0"},
+		{"age > 0 and users.age < 200", "age", "years", "years > 0 and users.years < 200"},
+		{"age(age) > 0 and age.name <> ''", "age", "years", "age(years) > 0 and age.name <> ''"},
+		{`"Age" > 0 and age > 1`, "Age", "select", `"select" > 0 and age > 1`},
+		{"name <> 'name'", "name", "Nick", `"Nick" <> 'name'`},
+	}
+
+	for _, tt := range tests {
+		got, err := RenameColumn(tt.source, tt.c, tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("rename %s in %q should get %q, but got %q, %v", tt.c, tt.source, tt.want, got, err)
+		}
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	tests := []struct {
+		source string
+		want   ast.QueryStmtAlterTable
+	}{
+		{
+			"ALTER TABLE users ADD city TEXT;",
+			ast.QueryStmtAlterTable{TableName: "users", Action: ast.AlterTableActionAddColumn, Column: ast.Column{Name: "city", Kind: ast.ColumnKindText}},
+		},
+		{
+			"ALTER TABLE users DROP COLUMN city;",
+			ast.QueryStmtAlterTable{TableName: "users", Action: ast.AlterTableActionDropColumn, ColumnName: "city"},
+		},
+		{
+			"ALTER TABLE users RENAME COLUMN city TO town;",
+			ast.QueryStmtAlterTable{TableName: "users", Action: ast.AlterTableActionRenameColumn, ColumnName: "city", NewName: "town"},
+		},
+		{
+			"ALTER TABLE users RENAME TO members;",
+			ast.QueryStmtAlterTable{TableName: "users", Action: ast.AlterTableActionRenameTable, NewName: "members"},
+		},
+		{
+			"ALTER TABLE users ADD CONSTRAINT users_age CHECK (age >= 0);",
+			ast.QueryStmtAlterTable{TableName: "users", Action: ast.AlterTableActionAddConstraint, Constraints: []ast.Constraint{
+				{Name: "users_age", Kind: ast.ConstraintKindCheck, Check: "age >= 0"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if s := stmt.(*ast.QueryStmtAlterTable); !reflect.DeepEqual(*s, tt.want) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.want, *s)
+		}
+	}
+}
+
+func TestParsePrepare(t *testing.T) {
+	tests := []struct {
+		source string
+		want   ast.QueryStmt
+	}{
+		{
+			"PREPARE older (INT, text) AS DELETE FROM users WHERE age > $1 AND name <> $2;",
+			&ast.QueryStmtPrepare{Name: "older", ParamKinds: []ast.ColumnKind{ast.ColumnKindInt, ast.ColumnKindText}, Stmt: &ast.QueryStmtDeleteValues{
+				TableName: "users",
+				Where: &ast.LogicExpr{
+					Op:    ast.LogicOpAnd,
+					Left:  &ast.CmpExpr{Cmp: ast.CmpKindGt, Left: &ast.ColumnRef{Name: "age"}, Right: &ast.Param{Index: 1}},
+					Right: &ast.CmpExpr{Cmp: ast.CmpKindNotEq, Left: &ast.ColumnRef{Name: "name"}, Right: &ast.Param{Index: 2}},
+				},
+			}},
+		},
+		{
+			"prepare add as insert into users values ($1, $1)",
+			&ast.QueryStmtPrepare{Name: "add", Stmt: &ast.QueryStmtInsertValues{TableName: "users", Rows: []ast.Row{{&ast.Param{Index: 1}, &ast.Param{Index: 1}}}, ContainsAllColumns: true}},
+		},
+		{
+			"EXECUTE older (18, 'O''Brien', NULL);",
+			&ast.QueryStmtExecute{Name: "older", Params: []*ast.Literal{
+				{Kind: ast.LiteralKindNumber, Value: "18"}, {Kind: ast.LiteralKindString, Value: "O'Brien"}, {Kind: ast.LiteralKindNull},
+			}},
+		},
+		{"execute all_users", &ast.QueryStmtExecute{Name: "all_users"}},
+		{"DEALLOCATE PREPARE older;", &ast.QueryStmtDeallocate{Name: "older"}},
+		{"deallocate all", &ast.QueryStmtDeallocate{All: true}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.want) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.want, stmt)
+		}
+	}
+}
+
+func TestParseSelectExprs(t *testing.T) {
+	col := func(n string) ast.Expr { return &ast.ColumnRef{Name: ast.ColumnName(n)} }
+	num := func(v string) ast.Expr { return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v} }
+	str := func(v string) ast.Expr { return &ast.Literal{Kind: ast.LiteralKindString, Value: v} }
+
+	tests := []struct {
+		source  string
+		columns []ast.SelectColumn
+	}{
+		{
+			"select (name, age) from t",
+			[]ast.SelectColumn{{Expr: col("name")}, {Expr: col("age")}},
+		},
+		{
+			"select a + b * 2 - -c, (a + 1) * 2 AS twice from t",
+			[]ast.SelectColumn{
+				{Expr: &ast.BinaryExpr{
+					Op:    ast.BinaryOpSub,
+					Left:  &ast.BinaryExpr{Op: ast.BinaryOpAdd, Left: col("a"), Right: &ast.BinaryExpr{Op: ast.BinaryOpMul, Left: col("b"), Right: num("2")}},
+					Right: &ast.NegExpr{Expr: col("c")},
+				}},
+				{Expr: &ast.BinaryExpr{Op: ast.BinaryOpMul, Left: &ast.BinaryExpr{Op: ast.BinaryOpAdd, Left: col("a"), Right: num("1")}, Right: num("2")}, Alias: "twice"},
+			},
+		},
+		{
+			`select name || ' ' || age "Full", upper(name) n from t`,
+			[]ast.SelectColumn{
+				{Expr: &ast.BinaryExpr{
+					Op:    ast.BinaryOpConcat,
+					Left:  &ast.BinaryExpr{Op: ast.BinaryOpConcat, Left: col("name"), Right: str(" ")},
+					Right: col("age"),
+				}, Alias: "Full"},
+				{Expr: &ast.FuncCall{Name: "upper", Args: []ast.Expr{col("name")}}, Alias: "n"},
+			},
+		},
+		{
+			"select case when a > 1 then 'x' else 'y' end, case a when 1 then 2 end from t",
+			[]ast.SelectColumn{
+				{Expr: &ast.CaseExpr{
+					Whens: []ast.CaseWhen{{Cond: &ast.CmpExpr{Cmp: ast.CmpKindGt, Left: col("a"), Right: num("1")}, Result: str("x")}},
+					Else:  str("y"),
+				}},
+				{Expr: &ast.CaseExpr{Operand: col("a"), Whens: []ast.CaseWhen{{Cond: num("1"), Result: num("2")}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if columns := stmt.(*ast.QueryStmtSelectValues).Columns; !reflect.DeepEqual(columns, tt.columns) {
+			t.Errorf("parse %q should get columns %#v, but got %#v", tt.source, tt.columns, columns)
+		}
+	}
+}
+
+func TestParsePredicates(t *testing.T) {
+	a := &ast.ColumnRef{Name: "a"}
+	num := func(v string) ast.Expr { return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v} }
+	str := func(v string) ast.Expr { return &ast.Literal{Kind: ast.LiteralKindString, Value: v} }
+
+	tests := []struct {
+		source string
+		where  ast.Expr
+	}{
+		{"select * from t where a like 'x%'", &ast.LikeExpr{Expr: a, Pattern: str("x%")}},
+		{"select * from t where a NOT ILIKE 'x' || '%'", &ast.LikeExpr{
+			Expr: a, Pattern: &ast.BinaryExpr{Op: ast.BinaryOpConcat, Left: str("x"), Right: str("%")}, Not: true, Insensitive: true,
+		}},
+		{"select * from t where a in (1, 2 + 1)", &ast.InExpr{Expr: a, List: []ast.Expr{num("1"), &ast.BinaryExpr{Op: ast.BinaryOpAdd, Left: num("2"), Right: num("1")}}}},
+		{"select * from t where a not in ('x')", &ast.InExpr{Expr: a, List: []ast.Expr{str("x")}, Not: true}},
+		{"select * from t where a between 1 and 2 and a not between -1 and 0", &ast.LogicExpr{
+			Op:    ast.LogicOpAnd,
+			Left:  &ast.BetweenExpr{Expr: a, Low: num("1"), High: num("2")},
+			Right: &ast.BetweenExpr{Expr: a, Low: num("-1"), High: num("0"), Not: true},
+		}},
+		{"select * from t where not a like 'x'", &ast.NotExpr{Expr: &ast.LikeExpr{Expr: a, Pattern: str("x")}}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if where := stmt.(*ast.QueryStmtSelectValues).Where; !reflect.DeepEqual(where, tt.where) {
+			t.Errorf("parse %q should get where %#v, but got %#v", tt.source, tt.where, where)
+		}
+	}
+}
+
+func TestParseUpdateFrom(t *testing.T) {
+	// GIVEN
+	source := "update users as u set age = u.age + o.count from orders o join items on o.id = items.oid where u.id = o.uid"
+
+	// WHEN
+	stmt, err := Parse(source)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("parse %q failed: %v", source, err)
+	}
+	s := stmt.(*ast.QueryStmtUpdateValues)
+	if s.TableName != "users" || s.Alias != "u" || s.Where == nil {
+		t.Errorf("update should be users u with where, but got %s %s %v", s.TableName, s.Alias, s.Where)
+	}
+	value := &ast.BinaryExpr{
+		Op:    ast.BinaryOpAdd,
+		Left:  &ast.ColumnRef{Table: "u", Name: "age"},
+		Right: &ast.ColumnRef{Table: "o", Name: "count"},
+	}
+	if len(s.Values) != 1 || s.Values[0].Name != "age" || !reflect.DeepEqual(s.Values[0].Value, value) {
+		t.Errorf("update should set age = u.age + o.count, but got %#v", s.Values)
+	}
+	want := []ast.Join{
+		{Kind: ast.JoinKindCross, TableName: "orders", Alias: "o"},
+		{Kind: ast.JoinKindInner, TableName: "items"},
+	}
+	if len(s.From) != len(want) {
+		t.Fatalf("update should have %d tables in FROM, but got %d", len(want), len(s.From))
+	}
+	for i, j := range s.From {
+		if j.Kind != want[i].Kind || j.TableName != want[i].TableName || j.Alias != want[i].Alias {
+			t.Errorf("table %d of FROM should be %#v, but got %#v", i, want[i], j)
+		}
+	}
+}
+
+func TestParseDistinct(t *testing.T) {
+	name := &ast.ColumnRef{Name: "name"}
+	tests := []struct {
+		source   string
+		distinct bool
+		on       []ast.Expr
+	}{
+		{"select name from t", false, nil},
+		{"select all name from t", false, nil},
+		{"select distinct * from t", true, nil},
+		{"select DISTINCT (name, age) from t", true, nil},
+		{"select distinct on (name) * from t", true, []ast.Expr{name}},
+		{"select distinct on (name, upper(city)) age from t order by name", true, []ast.Expr{
+			name, &ast.FuncCall{Name: "upper", Args: []ast.Expr{&ast.ColumnRef{Name: "city"}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		s := stmt.(*ast.QueryStmtSelectValues)
+		if s.Distinct != tt.distinct || !reflect.DeepEqual(s.DistinctOn, tt.on) {
+			t.Errorf("parse %q should get distinct %v on %v, but got %v on %v", tt.source, tt.distinct, tt.on, s.Distinct, s.DistinctOn)
+		}
+	}
+}
+
+func TestParseSetOperations(t *testing.T) {
+	selectFrom := func(table string) *ast.QueryStmtSelectValues {
+		return &ast.QueryStmtSelectValues{TableName: table, Joins: []ast.Join{}, Columns: []ast.SelectColumn{{Expr: &ast.ColumnRef{Name: "a"}}}}
+	}
+	tests := []struct {
+		source string
+		query  ast.Query
+	}{
+		{"select a from t union select a from u", &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, Left: selectFrom("t"), Right: selectFrom("u")}},
+		{"select a from t union all select a from u except distinct select a from v", &ast.QueryStmtSetOperation{
+			Op:    ast.SetOpExcept,
+			Left:  &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, All: true, Left: selectFrom("t"), Right: selectFrom("u")},
+			Right: selectFrom("v"),
+		}},
+		{"select a from t union select a from u intersect all select a from v", &ast.QueryStmtSetOperation{
+			Op:    ast.SetOpUnion,
+			Left:  selectFrom("t"),
+			Right: &ast.QueryStmtSetOperation{Op: ast.SetOpIntersect, All: true, Left: selectFrom("u"), Right: selectFrom("v")},
+		}},
+		{"(select a from t union select a from u) intersect select a from v limit 1", &ast.QueryStmtSetOperation{
+			Op:    ast.SetOpIntersect,
+			Left:  &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, Left: selectFrom("t"), Right: selectFrom("u")},
+			Right: selectFrom("v"),
+			Limit: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"},
+		}},
+		{"(select a from t) order by a", &ast.QueryStmtSelectValues{
+			TableName: "t",
+			Joins:     []ast.Join{},
+			Columns:   []ast.SelectColumn{{Expr: &ast.ColumnRef{Name: "a"}}},
+			OrderBy:   []ast.OrderBy{{Expr: &ast.ColumnRef{Name: "a"}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.query) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.query, stmt)
+		}
+	}
+}
+
+func TestParseSubqueries(t *testing.T) {
+	col := func(name string) *ast.ColumnRef { return &ast.ColumnRef{Name: ast.ColumnName(name)} }
+	selectFrom := func(table string, where ast.Expr) *ast.QueryStmtSelectValues {
+		return &ast.QueryStmtSelectValues{TableName: table, Joins: []ast.Join{}, Columns: []ast.SelectColumn{{Expr: col("b")}}, Where: where}
+	}
+	selectWhere := func(where ast.Expr) *ast.QueryStmtSelectValues {
+		return &ast.QueryStmtSelectValues{TableName: "t", Joins: []ast.Join{}, ContainsAllColumns: true, Where: where}
+	}
+	tests := []struct {
+		source string
+		query  ast.Query
+	}{
+		{"select * from t where a in (select b from u)", selectWhere(&ast.InExpr{Expr: col("a"), Query: selectFrom("u", nil)})},
+		{"select * from t where a not in (select b from u union select b from v)", selectWhere(&ast.InExpr{
+			Expr:  col("a"),
+			Query: &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, Left: selectFrom("u", nil), Right: selectFrom("v", nil)},
+			Not:   true,
+		})},
+		{"select * from t where not exists (select b from u where b = a)", selectWhere(&ast.NotExpr{
+			Expr: &ast.ExistsExpr{Query: selectFrom("u", &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: col("b"), Right: col("a")})},
+		})},
+		{"select * from t where a > (select b from u)", selectWhere(&ast.CmpExpr{Cmp: ast.CmpKindGt, Left: col("a"), Right: &ast.SubqueryExpr{Query: selectFrom("u", nil)}})},
+		{"select (select b from u) c from t", &ast.QueryStmtSelectValues{
+			TableName: "t",
+			Joins:     []ast.Join{},
+			Columns:   []ast.SelectColumn{{Expr: &ast.SubqueryExpr{Query: selectFrom("u", nil)}, Alias: "c"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.query) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.query, stmt)
+		}
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	selectFrom := func(table string) *ast.QueryStmtSelectValues {
+		return &ast.QueryStmtSelectValues{TableName: table, Joins: []ast.Join{}, Columns: []ast.SelectColumn{{Expr: &ast.ColumnRef{Name: "a"}}}}
+	}
+	tests := []struct {
+		source string
+		stmt   ast.QueryStmt
+	}{
+		{"with t as (select a from u) select a from t", &ast.QueryStmtWith{
+			CTEs: []ast.CommonTableExpr{{Name: "t", Query: selectFrom("u")}},
+			Stmt: selectFrom("t"),
+		}},
+		{"with recursive t (a) as (select a from u union all select a from t), v as (select a from t) select a from v union select a from t", &ast.QueryStmtWith{
+			Recursive: true,
+			CTEs: []ast.CommonTableExpr{
+				{Name: "t", Columns: []ast.ColumnName{"a"}, Query: &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, All: true, Left: selectFrom("u"), Right: selectFrom("t")}},
+				{Name: "v", Query: selectFrom("t")},
+			},
+			Stmt: &ast.QueryStmtSetOperation{Op: ast.SetOpUnion, Left: selectFrom("v"), Right: selectFrom("t")},
+		}},
+		{"with t as (select a from u) delete from v", &ast.QueryStmtWith{
+			CTEs: []ast.CommonTableExpr{{Name: "t", Query: selectFrom("u")}},
+			Stmt: &ast.QueryStmtDeleteValues{TableName: "v"},
+		}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.stmt) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.stmt, stmt)
+		}
+	}
+}
+
+func TestParseWindowFunctions(t *testing.T) {
+	col := func(name string) *ast.ColumnRef { return &ast.ColumnRef{Name: ast.ColumnName(name)} }
+	num := func(v string) *ast.Literal { return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v} }
+	tests := []struct {
+		source string
+		call   *ast.FuncCall
+	}{
+		{"select row_number() over () from t", &ast.FuncCall{Name: "row_number", Over: &ast.WindowSpec{}}},
+		{"select rank() over (partition by a, b order by c desc) from t", &ast.FuncCall{Name: "rank", Over: &ast.WindowSpec{
+			PartitionBy: []ast.Expr{col("a"), col("b")},
+			OrderBy:     []ast.OrderBy{{Expr: col("c"), Desc: true}},
+		}}},
+		{"select sum(a) over (order by b rows between 2 preceding and unbounded following) from t", &ast.FuncCall{Name: "sum", Args: []ast.Expr{col("a")}, Over: &ast.WindowSpec{
+			OrderBy: []ast.OrderBy{{Expr: col("b")}},
+			Frame: &ast.WindowFrame{
+				Start: ast.FrameBound{Kind: ast.FrameBoundPreceding, Offset: num("2")},
+				End:   ast.FrameBound{Kind: ast.FrameBoundUnboundedFollowing},
+			},
+		}}},
+		{"select count(*) over (rows unbounded preceding) from t", &ast.FuncCall{Name: "count", Star: true, Over: &ast.WindowSpec{
+			Frame: &ast.WindowFrame{Start: ast.FrameBound{Kind: ast.FrameBoundUnboundedPreceding}, End: ast.FrameBound{Kind: ast.FrameBoundCurrentRow}},
+		}}},
+		{"select lag(a, 1) over (rows between current row and 1 following) from t", &ast.FuncCall{Name: "lag", Args: []ast.Expr{col("a"), num("1")}, Over: &ast.WindowSpec{
+			Frame: &ast.WindowFrame{Start: ast.FrameBound{Kind: ast.FrameBoundCurrentRow}, End: ast.FrameBound{Kind: ast.FrameBoundFollowing, Offset: num("1")}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if got := stmt.(*ast.QueryStmtSelectValues).Columns[0].Expr; !reflect.DeepEqual(got, tt.call) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.call, got)
+		}
+	}
+}
+
+func TestParseInsertSelectAndReturning(t *testing.T) {
+	col := func(name string) ast.SelectColumn {
+		return ast.SelectColumn{Expr: &ast.ColumnRef{Name: ast.ColumnName(name)}}
+	}
+	selectFrom := &ast.QueryStmtSelectValues{TableName: "u", Joins: []ast.Join{}, Columns: []ast.SelectColumn{col("b"), col("a")}}
+	tests := []struct {
+		source string
+		stmt   ast.QueryStmt
+	}{
+		{"insert into t (a, b) select b, a from u", &ast.QueryStmtInsertValues{
+			TableName: "t", ColumnNames: []ast.ColumnName{"a", "b"}, Query: selectFrom,
+		}},
+		{"insert into t (select b, a from u) returning *", &ast.QueryStmtInsertValues{
+			TableName: "t", Query: selectFrom, ContainsAllColumns: true, Returning: &ast.Returning{ContainsAllColumns: true},
+		}},
+		{"insert into t values (1) returning a, b + 1 as c", &ast.QueryStmtInsertValues{
+			TableName: "t", Rows: []ast.Row{{&ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"}}}, ContainsAllColumns: true,
+			Returning: &ast.Returning{Columns: []ast.SelectColumn{col("a"), {
+				Expr:  &ast.BinaryExpr{Op: ast.BinaryOpAdd, Left: &ast.ColumnRef{Name: "b"}, Right: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"}},
+				Alias: "c",
+			}}},
+		}},
+		{"update t set a = b returning a", &ast.QueryStmtUpdateValues{
+			TableName: "t", Values: []ast.ColumnUpdatedValue{{Name: "a", Value: &ast.ColumnRef{Name: "b"}}},
+			Returning: &ast.Returning{Columns: []ast.SelectColumn{col("a")}},
+		}},
+		{"delete from t returning *", &ast.QueryStmtDeleteValues{TableName: "t", Returning: &ast.Returning{ContainsAllColumns: true}}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.stmt) {
+			t.Errorf("parse %q should get %#v, but got %#v", tt.source, tt.stmt, stmt)
+		}
+	}
+}
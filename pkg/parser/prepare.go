@@ -0,0 +1,91 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: PREPARE older (INT) AS SELECT * FROM users WHERE age > $1;
+// the types of parameters are optional, and only SELECT, INSERT, UPDATE and
+// DELETE could be prepared.
+func (p *Parser) parsePrepare() (*ast.QueryStmtPrepare, error) {
+	if err := p.expectKeyword("prepare"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtPrepare{Name: name}
+	if p.acceptSymbol("(") {
+		for {
+			kind, err := p.parseColumnKind()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ParamKinds = append(stmt.ParamKinds, kind)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("as"); err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"select", "insert", "update", "delete", "with"} {
+		if p.isKeyword(kw) {
+			stmt.Stmt, err = p.parseQuery()
+			if err != nil {
+				return nil, err
+			}
+			return stmt, nil
+		}
+	}
+	return nil, p.expected("SELECT, INSERT, UPDATE or DELETE")
+}
+
+// for this query: EXECUTE older (18); the parameters are literals.
+func (p *Parser) parseExecute() (*ast.QueryStmtExecute, error) {
+	if err := p.expectKeyword("execute"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtExecute{Name: name}
+	if !p.acceptSymbol("(") {
+		return stmt, nil
+	}
+	for {
+		v, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Params = append(stmt.Params, v)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// for this query: DEALLOCATE PREPARE older; PREPARE keyword is optional, and
+// all of the prepared statements are deallocated by DEALLOCATE ALL.
+func (p *Parser) parseDeallocate() (*ast.QueryStmtDeallocate, error) {
+	if err := p.expectKeyword("deallocate"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("prepare")
+	if p.acceptKeyword("all") {
+		return &ast.QueryStmtDeallocate{All: true}, nil
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.QueryStmtDeallocate{Name: name}, nil
+}
@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type TokenKind uint
+
+const (
+	TokenKindEOF TokenKind = iota
+	// TokenKindIdent is the unquoted identifier or keyword, which is folded
+	// to lower case.
+	TokenKindIdent
+	// TokenKindQuotedIdent is the identifier in double quotes, like "User".
+	TokenKindQuotedIdent
+	// TokenKindString is the string literal in single quotes, like 'walker'.
+	TokenKindString
+	// TokenKindNumber is the numeric literal, like 18, 3.14 or 1e10.
+	TokenKindNumber
+	// TokenKindSymbol is the operator or punctuation, like ( ) , ; * = <=.
+	TokenKindSymbol
+	// TokenKindParam is the positional parameter, like $1, value is the
+	// number without $.
+	TokenKindParam
+)
+
+// Token is the lexical unit of a query, pos is the byte offset of the token
+// in the source, which is used for reporting errors.
+type Token struct {
+	Kind  TokenKind
+	Value string
+	Pos   int
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case TokenKindEOF:
+		return "end of input"
+	case TokenKindString:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(t.Value, "'", "''"))
+	case TokenKindQuotedIdent:
+		return fmt.Sprintf(`"%s"`, strings.ReplaceAll(t.Value, `"`, `""`))
+	case TokenKindParam:
+		return "$" + t.Value
+	}
+	return t.Value
+}
+
+var (
+	ErrStringUnterminated     = errors.New("unterminated quoted string")
+	ErrIdentifierUnterminated = errors.New("unterminated quoted identifier")
+	ErrCommentUnterminated    = errors.New("unterminated /* comment")
+	ErrCharacterInvalid       = errors.New("invalid character")
+)
+
+// The operators composed with two characters, they are tested before single
+// character symbols.
+var doubleSymbols = []string{"<=", ">=", "<>", "!=", "==", "||"}
+
+const singleSymbols = "(),;*+-/%=<>."
+
+// Scanner splits the source of a query into tokens.
+type Scanner struct {
+	src string
+	pos int
+}
+
+func NewScanner(src string) *Scanner {
+	return &Scanner{src: src}
+}
+
+// Scan scans all tokens of source, the last token is always TokenKindEOF.
+func Scan(src string) ([]Token, error) {
+	s := NewScanner(src)
+	tokens := make([]Token, 0)
+	for {
+		t, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		if t.Kind == TokenKindEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// Next returns the next token of source, whitespaces and comments are skipped.
+func (s *Scanner) Next() (Token, error) {
+	if err := s.skip(); err != nil {
+		return Token{}, err
+	}
+	if s.pos >= len(s.src) {
+		return Token{Kind: TokenKindEOF, Pos: s.pos}, nil
+	}
+	start := s.pos
+	c := s.src[s.pos]
+	switch {
+	case c == '\'':
+		v, err := s.quoted('\'', ErrStringUnterminated)
+		return Token{Kind: TokenKindString, Value: v, Pos: start}, err
+	case c == '"':
+		v, err := s.quoted('"', ErrIdentifierUnterminated)
+		if err == nil && v == "" {
+			err = fmt.Errorf("%w: zero-length delimited identifier at position %d", ErrCharacterInvalid, start)
+		}
+		return Token{Kind: TokenKindQuotedIdent, Value: v, Pos: start}, err
+	case isDigit(c) || (c == '.' && s.pos+1 < len(s.src) && isDigit(s.src[s.pos+1])):
+		return Token{Kind: TokenKindNumber, Value: s.number(), Pos: start}, nil
+	case c == '$' && s.pos+1 < len(s.src) && isDigit(s.src[s.pos+1]):
+		s.pos++
+		for s.pos < len(s.src) && isDigit(s.src[s.pos]) {
+			s.pos++
+		}
+		return Token{Kind: TokenKindParam, Value: s.src[start+1 : s.pos], Pos: start}, nil
+	case isIdentStart(rune(c)) || c >= 0x80:
+		return Token{Kind: TokenKindIdent, Value: strings.ToLower(s.ident()), Pos: start}, nil
+	}
+	for _, sym := range doubleSymbols {
+		if strings.HasPrefix(s.src[s.pos:], sym) {
+			s.pos += len(sym)
+			return Token{Kind: TokenKindSymbol, Value: sym, Pos: start}, nil
+		}
+	}
+	if strings.IndexByte(singleSymbols, c) >= 0 {
+		s.pos++
+		return Token{Kind: TokenKindSymbol, Value: string(c), Pos: start}, nil
+	}
+	return Token{}, fmt.Errorf("%w: %q at position %d", ErrCharacterInvalid, c, start)
+}
+
+// skip skips whitespaces, -- line comments and /* */ block comments, block
+// comments could be nested like PostgreSQL.
+func (s *Scanner) skip() error {
+	for s.pos < len(s.src) {
+		rest := s.src[s.pos:]
+		switch {
+		case unicode.IsSpace(rune(rest[0])):
+			s.pos++
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				s.pos = len(s.src)
+			} else {
+				s.pos += end + 1
+			}
+		case strings.HasPrefix(rest, "/*"):
+			depth := 0
+			for {
+				rest = s.src[s.pos:]
+				if rest == "" {
+					return ErrCommentUnterminated
+				}
+				if strings.HasPrefix(rest, "/*") {
+					depth++
+					s.pos += 2
+				} else if strings.HasPrefix(rest, "*/") {
+					depth--
+					s.pos += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					s.pos++
+				}
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// quoted scans the content between quote q, two adjacent quotes inside is
+// the escaped quote itself.
+func (s *Scanner) quoted(q byte, unterminated error) (string, error) {
+	var sb strings.Builder
+	s.pos++
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		s.pos++
+		if c != q {
+			sb.WriteByte(c)
+			continue
+		}
+		if s.pos < len(s.src) && s.src[s.pos] == q {
+			sb.WriteByte(q)
+			s.pos++
+			continue
+		}
+		return sb.String(), nil
+	}
+	return "", unterminated
+}
+
+func (s *Scanner) number() string {
+	start := s.pos
+	for s.pos < len(s.src) && isDigit(s.src[s.pos]) {
+		s.pos++
+	}
+	if s.pos < len(s.src) && s.src[s.pos] == '.' {
+		s.pos++
+		for s.pos < len(s.src) && isDigit(s.src[s.pos]) {
+			s.pos++
+		}
+	}
+	// exponent part, like 1e10 or 2.5E-3
+	if s.pos < len(s.src) && (s.src[s.pos] == 'e' || s.src[s.pos] == 'E') {
+		p := s.pos + 1
+		if p < len(s.src) && (s.src[p] == '+' || s.src[p] == '-') {
+			p++
+		}
+		if p < len(s.src) && isDigit(s.src[p]) {
+			s.pos = p
+			for s.pos < len(s.src) && isDigit(s.src[s.pos]) {
+				s.pos++
+			}
+		}
+	}
+	return s.src[start:s.pos]
+}
+
+func (s *Scanner) ident() string {
+	start := s.pos
+	for s.pos < len(s.src) {
+		r := rune(s.src[s.pos])
+		if !isIdentStart(r) && !isDigit(s.src[s.pos]) && r != '$' && r < 0x80 {
+			break
+		}
+		s.pos++
+	}
+	return s.src[start:s.pos]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
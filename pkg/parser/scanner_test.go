@@ -0,0 +1,96 @@
+package parser
+
+import "testing"
+
+func TestScan(t *testing.T) {
+	scanTests := []struct {
+		source string
+		tokens []Token
+	}{
+		{"", nil},
+		{"SELECT * FROM Users;", []Token{
+			{Kind: TokenKindIdent, Value: "select"},
+			{Kind: TokenKindSymbol, Value: "*"},
+			{Kind: TokenKindIdent, Value: "from"},
+			{Kind: TokenKindIdent, Value: "users"},
+			{Kind: TokenKindSymbol, Value: ";"},
+		}},
+		{"'walker wang' 'O''Brien' ''", []Token{
+			{Kind: TokenKindString, Value: "walker wang"},
+			{Kind: TokenKindString, Value: "O'Brien"},
+			{Kind: TokenKindString, Value: ""},
+		}},
+		{`"MixedCase" "a ""b"""`, []Token{
+			{Kind: TokenKindQuotedIdent, Value: "MixedCase"},
+			{Kind: TokenKindQuotedIdent, Value: `a "b"`},
+		}},
+		{"18 3.14 .5 1e10 2.5E-3", []Token{
+			{Kind: TokenKindNumber, Value: "18"},
+			{Kind: TokenKindNumber, Value: "3.14"},
+			{Kind: TokenKindNumber, Value: ".5"},
+			{Kind: TokenKindNumber, Value: "1e10"},
+			{Kind: TokenKindNumber, Value: "2.5E-3"},
+		}},
+		{"a<=b<>c!=d==e>=f", []Token{
+			{Kind: TokenKindIdent, Value: "a"},
+			{Kind: TokenKindSymbol, Value: "<="},
+			{Kind: TokenKindIdent, Value: "b"},
+			{Kind: TokenKindSymbol, Value: "<>"},
+			{Kind: TokenKindIdent, Value: "c"},
+			{Kind: TokenKindSymbol, Value: "!="},
+			{Kind: TokenKindIdent, Value: "d"},
+			{Kind: TokenKindSymbol, Value: "=="},
+			{Kind: TokenKindIdent, Value: "e"},
+			{Kind: TokenKindSymbol, Value: ">="},
+			{Kind: TokenKindIdent, Value: "f"},
+		}},
+		{"age > $1 and name=$12", []Token{
+			{Kind: TokenKindIdent, Value: "age"},
+			{Kind: TokenKindSymbol, Value: ">"},
+			{Kind: TokenKindParam, Value: "1"},
+			{Kind: TokenKindIdent, Value: "and"},
+			{Kind: TokenKindIdent, Value: "name"},
+			{Kind: TokenKindSymbol, Value: "="},
+			{Kind: TokenKindParam, Value: "12"},
+		}},
+		{"a -- comment\n/* block /* nested */ comment */ b", []Token{
+			{Kind: TokenKindIdent, Value: "a"},
+			{Kind: TokenKindIdent, Value: "b"},
+		}},
+	}
+
+	for i, tt := range scanTests {
+		tokens, err := Scan(tt.source)
+		if err != nil {
+			t.Errorf("test %d: scan %q failed: %v", i, tt.source, err)
+			continue
+		}
+		// the last token is always EOF
+		if len(tokens) != len(tt.tokens)+1 || tokens[len(tokens)-1].Kind != TokenKindEOF {
+			t.Errorf("test %d: scan %q should get %d tokens, but got %v", i, tt.source, len(tt.tokens), tokens)
+			continue
+		}
+		for j, want := range tt.tokens {
+			if got := tokens[j]; got.Kind != want.Kind || got.Value != want.Value {
+				t.Errorf("test %d: token %d should be %v, but got %v", i, j, want, got)
+			}
+		}
+	}
+}
+
+func TestScanFailed(t *testing.T) {
+	scanTests := []string{
+		"'unterminated",
+		`"unterminated`,
+		`""`,
+		"/* unterminated",
+		"select ? from t",
+		"select $ from t",
+	}
+
+	for _, tt := range scanTests {
+		if _, err := Scan(tt); err == nil {
+			t.Errorf("scan %q should fail, but err is nil", tt)
+		}
+	}
+}
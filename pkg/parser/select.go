@@ -0,0 +1,370 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: SELECT ... UNION SELECT ... ORDER BY c1 LIMIT 10, SELECT
+// statements are combined by UNION, INTERSECT and EXCEPT, and INTERSECT binds
+// tighter than the others. ORDER BY, LIMIT and OFFSET after the last SELECT
+// are applied to the combined rows, the queries in brackets could have their
+// own ones.
+func (p *Parser) parseSelectQuery() (ast.Query, error) {
+	q, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := p.parseOrderBy()
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := p.parseLimit()
+	if err != nil {
+		return nil, err
+	}
+	if orderBy == nil && limit == nil && offset == nil {
+		return q, nil
+	}
+	switch q := q.(type) {
+	case *ast.QueryStmtSelectValues:
+		if q.OrderBy != nil || q.Limit != nil || q.Offset != nil {
+			return nil, ErrQuerySyntaxInvalid
+		}
+		q.OrderBy, q.Limit, q.Offset = orderBy, limit, offset
+	case *ast.QueryStmtSetOperation:
+		if q.OrderBy != nil || q.Limit != nil || q.Offset != nil {
+			return nil, ErrQuerySyntaxInvalid
+		}
+		q.OrderBy, q.Limit, q.Offset = orderBy, limit, offset
+	}
+	return q, nil
+}
+
+// parseUnion parses the queries combined by UNION or EXCEPT from left to
+// right, DISTINCT is the same as without ALL.
+func (p *Parser) parseUnion() (ast.Query, error) {
+	left, err := p.parseIntersect()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("union") || p.isKeyword("except") {
+		op := ast.SetOpUnion
+		if p.next().Value == "except" {
+			op = ast.SetOpExcept
+		}
+		all := p.acceptKeyword("all")
+		if !all {
+			p.acceptKeyword("distinct")
+		}
+		right, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.QueryStmtSetOperation{Op: op, All: all, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseIntersect parses the queries combined by INTERSECT from left to right.
+func (p *Parser) parseIntersect() (ast.Query, error) {
+	left, err := p.parseSelectTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("intersect") {
+		all := p.acceptKeyword("all")
+		if !all {
+			p.acceptKeyword("distinct")
+		}
+		right, err := p.parseSelectTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.QueryStmtSetOperation{Op: ast.SetOpIntersect, All: all, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseSelectTerm parses a SELECT statement or a query in brackets.
+func (p *Parser) parseSelectTerm() (ast.Query, error) {
+	if !p.acceptSymbol("(") {
+		return p.parseSelect()
+	}
+	q, err := p.parseSelectQuery()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// for this query: SELECT ... FROM fdt WHERE c1 > 5 GROUP BY c1 HAVING count(*) > 1,
+// the selected columns could be *, expressions or expressions in brackets, and
+// they could follow DISTINCT, DISTINCT ON (c1) or ALL. ORDER BY and LIMIT are
+// parsed by parseSelectQuery.
+func (p *Parser) parseSelect() (*ast.QueryStmtSelectValues, error) {
+	if err := p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtSelectValues{}
+	var err error
+	if stmt.Distinct, stmt.DistinctOn, err = p.parseDistinct(); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("*") {
+		stmt.ContainsAllColumns = true
+	} else {
+		columns, err := p.parseSelectColumns()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = columns
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	name, alias, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	stmt.TableName, stmt.Alias = name, alias
+	if stmt.Joins, err = p.parseJoins(); err != nil {
+		return nil, err
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Where = where
+	if stmt.GroupBy, err = p.parseGroupBy(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("having") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseDistinct parses the optional DISTINCT, DISTINCT ON (expressions) or
+// ALL, which is the same as without it.
+func (p *Parser) parseDistinct() (bool, []ast.Expr, error) {
+	if !p.acceptKeyword("distinct") {
+		p.acceptKeyword("all")
+		return false, nil, nil
+	}
+	if !p.acceptKeyword("on") {
+		return true, nil, nil
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return false, nil, err
+	}
+	on := make([]ast.Expr, 0)
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return false, nil, err
+		}
+		on = append(on, e)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return false, nil, err
+	}
+	return true, on, nil
+}
+
+// parseTableRef parses table name with optional alias, like users AS u or
+// users u.
+func (p *Parser) parseTableRef() (name, alias string, err error) {
+	if name, err = p.parseIdent(); err != nil {
+		return "", "", err
+	}
+	if p.acceptKeyword("as") {
+		alias, err = p.parseIdent()
+		return name, alias, err
+	}
+	if t := p.peek(); t.Kind == TokenKindQuotedIdent || (t.Kind == TokenKindIdent && !reservedKeywords[t.Value]) {
+		alias, err = p.parseIdent()
+	}
+	return name, alias, err
+}
+
+// parseJoins parses the joined tables after the first table of FROM clause,
+// a comma is the same as CROSS JOIN.
+func (p *Parser) parseJoins() ([]ast.Join, error) {
+	joins := make([]ast.Join, 0)
+	for {
+		var kind ast.JoinKind
+		switch {
+		case p.acceptSymbol(","):
+			kind = ast.JoinKindCross
+		case p.acceptKeyword("cross"):
+			kind = ast.JoinKindCross
+			if err := p.expectKeyword("join"); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("join"):
+			kind = ast.JoinKindInner
+		case p.acceptKeyword("inner"):
+			kind = ast.JoinKindInner
+			if err := p.expectKeyword("join"); err != nil {
+				return nil, err
+			}
+		case p.isKeyword("left") || p.isKeyword("right") || p.isKeyword("full"):
+			kinds := map[string]ast.JoinKind{
+				"left": ast.JoinKindLeft, "right": ast.JoinKindRight, "full": ast.JoinKindFull,
+			}
+			kind = kinds[p.next().Value]
+			p.acceptKeyword("outer")
+			if err := p.expectKeyword("join"); err != nil {
+				return nil, err
+			}
+		default:
+			return joins, nil
+		}
+		name, alias, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		join := ast.Join{Kind: kind, TableName: name, Alias: alias}
+		if kind != ast.JoinKindCross {
+			if err := p.expectKeyword("on"); err != nil {
+				return nil, err
+			}
+			if join.On, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		joins = append(joins, join)
+	}
+}
+
+// parseSelectColumns parses output columns separated by comma, the columns
+// could be in brackets like (name, age), which is tried first and parsed
+// again as expressions if it isn't followed by FROM, like (age + 1) * 2.
+func (p *Parser) parseSelectColumns() ([]ast.SelectColumn, error) {
+	start := p.pos
+	if p.acceptSymbol("(") {
+		columns, err := p.parseSelectList()
+		if err == nil && p.acceptSymbol(")") && p.isKeyword("from") {
+			return columns, nil
+		}
+		p.pos = start
+	}
+	return p.parseSelectList()
+}
+
+// parseSelectList parses expressions with optional aliases separated by
+// comma, like age + 1 AS next, name n.
+func (p *Parser) parseSelectList() ([]ast.SelectColumn, error) {
+	columns := make([]ast.SelectColumn, 0)
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c := ast.SelectColumn{Expr: e}
+		if p.acceptKeyword("as") {
+			if c.Alias, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		} else if t := p.peek(); t.Kind == TokenKindQuotedIdent || (t.Kind == TokenKindIdent && !reservedKeywords[t.Value]) {
+			c.Alias, _ = p.parseIdent()
+		}
+		columns = append(columns, c)
+		if !p.acceptSymbol(",") {
+			return columns, nil
+		}
+	}
+}
+
+// parseGroupBy parses the optional GROUP BY clause.
+func (p *Parser) parseGroupBy() ([]ast.Expr, error) {
+	if !p.acceptKeyword("group") {
+		return nil, nil
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return nil, err
+	}
+	groups := make([]ast.Expr, 0)
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, e)
+		if !p.acceptSymbol(",") {
+			return groups, nil
+		}
+	}
+}
+
+// parseOrderBy parses the optional ORDER BY clause, every key is followed by
+// optional ASC or DESC and NULLS FIRST or NULLS LAST.
+func (p *Parser) parseOrderBy() ([]ast.OrderBy, error) {
+	if !p.acceptKeyword("order") {
+		return nil, nil
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return nil, err
+	}
+	keys := make([]ast.OrderBy, 0)
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		key := ast.OrderBy{Expr: e}
+		if p.acceptKeyword("desc") {
+			key.Desc = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+		if p.acceptKeyword("nulls") {
+			switch {
+			case p.acceptKeyword("first"):
+				key.Nulls = ast.NullsOrderFirst
+			case p.acceptKeyword("last"):
+				key.Nulls = ast.NullsOrderLast
+			default:
+				return nil, p.expected("FIRST or LAST")
+			}
+		}
+		keys = append(keys, key)
+		if !p.acceptSymbol(",") {
+			return keys, nil
+		}
+	}
+}
+
+// parseLimit parses the optional LIMIT and OFFSET clauses, they could be in
+// any order, and LIMIT ALL is the same as without LIMIT.
+func (p *Parser) parseLimit() (limit, offset ast.Expr, err error) {
+	var hasLimit, hasOffset bool
+	for i := 0; i < 2; i++ {
+		switch {
+		case !hasLimit && p.acceptKeyword("limit"):
+			hasLimit = true
+			if p.acceptKeyword("all") {
+				continue
+			}
+			if limit, err = p.parsePrimary(); err != nil {
+				return nil, nil, err
+			}
+		case !hasOffset && p.acceptKeyword("offset"):
+			hasOffset = true
+			if offset, err = p.parsePrimary(); err != nil {
+				return nil, nil, err
+			}
+			// OFFSET n ROW or OFFSET n ROWS of SQL standard
+			if !p.acceptKeyword("rows") {
+				p.acceptKeyword("row")
+			}
+		}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,59 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: UPDATE mytable AS m SET a = a + 1, b = o.b FROM other o
+// WHERE m.id = o.id RETURNING m.a; the values are expressions, and the tables of optional
+// FROM clause are joined like SELECT.
+func (p *Parser) parseUpdate() (*ast.QueryStmtUpdateValues, error) {
+	if err := p.expectKeyword("update"); err != nil {
+		return nil, err
+	}
+	name, alias, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtUpdateValues{TableName: name, Alias: alias}
+	for {
+		column, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		cnv := ast.ColumnUpdatedValue{Name: ast.ColumnName(column), Value: value}
+		stmt.Values = append(stmt.Values, cnv)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("from") {
+		name, alias, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		joins, err := p.parseJoins()
+		if err != nil {
+			return nil, err
+		}
+		first := ast.Join{Kind: ast.JoinKindCross, TableName: name, Alias: alias}
+		stmt.From = append([]ast.Join{first}, joins...)
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Where = where
+	if stmt.Returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
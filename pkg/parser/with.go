@@ -0,0 +1,52 @@
+package parser
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// for this query: WITH RECURSIVE t (n) AS (SELECT ... UNION SELECT ...) SELECT
+// * FROM t; the queries are separated by comma, and the statement after them
+// is SELECT, INSERT, UPDATE or DELETE.
+func (p *Parser) parseWith() (*ast.QueryStmtWith, error) {
+	if err := p.expectKeyword("with"); err != nil {
+		return nil, err
+	}
+	stmt := &ast.QueryStmtWith{Recursive: p.acceptKeyword("recursive")}
+	for {
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		cte := ast.CommonTableExpr{Name: name}
+		if p.isSymbol("(") {
+			if cte.Columns, err = p.parseColumnNames(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectKeyword("as"); err != nil {
+			return nil, err
+		}
+		if cte.Query, err = p.parseSubquery(); err != nil {
+			return nil, err
+		}
+		stmt.CTEs = append(stmt.CTEs, cte)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	var err error
+	switch {
+	case p.isKeyword("select") || p.isSymbol("("):
+		stmt.Stmt, err = p.parseSelectQuery()
+	case p.isKeyword("insert"):
+		stmt.Stmt, err = p.parseInsert()
+	case p.isKeyword("update"):
+		stmt.Stmt, err = p.parseUpdate()
+	case p.isKeyword("delete"):
+		stmt.Stmt, err = p.parseDelete()
+	default:
+		return nil, p.expected("SELECT, INSERT, UPDATE or DELETE")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrColumnNotGrouped = errors.New("column must appear in the GROUP BY clause or be used in an aggregate function")
+	ErrFuncArgsInvalid  = errors.New("function arguments are invalid")
+)
+
+// The aggregate functions which compute one result from the rows of a group.
+var aggregates = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+}
+
+// CheckFunc checks if function could be called when evaluating a row, which
+// must be a scalar function with right number of arguments.
+func checkFunc(f *ast.FuncCall) error {
+	if f.Over != nil {
+		return fmt.Errorf("%w: %s", ErrWindowMisplaced, f.Name)
+	}
+	if aggregates[f.Name] {
+		return fmt.Errorf("%w: %s", ErrAggregateMisplaced, f.Name)
+	}
+	if _, ok := windowFuncs[f.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrOverRequired, f.Name)
+	}
+	fn, ok := scalars[f.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrFuncNotExisted, f.Name)
+	}
+	if f.Star || len(f.Args) < fn.minArgs || (fn.maxArgs >= 0 && len(f.Args) > fn.maxArgs) {
+		return fmt.Errorf("%w: %s", ErrFuncArgsInvalid, f.Name)
+	}
+	return nil
+}
+
+// HasAggregate returns true if expression calls any aggregate function, the
+// aggregate functions called with OVER clause are window functions.
+func hasAggregate(e ast.Expr) bool {
+	found := false
+	ast.Walk(e, func(e ast.Expr) bool {
+		if f, ok := e.(*ast.FuncCall); ok && aggregates[f.Name] && f.Over == nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Aggregated returns true if select statement groups rows, which is written
+// with GROUP BY, HAVING or aggregate functions.
+func aggregated(stmt *ast.QueryStmtSelectValues) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return true
+	}
+	for _, c := range stmt.Columns {
+		if hasAggregate(c.Expr) {
+			return true
+		}
+	}
+	for _, k := range stmt.OrderBy {
+		if hasAggregate(k.Expr) {
+			return true
+		}
+	}
+	for _, e := range stmt.DistinctOn {
+		if hasAggregate(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregation is the hash aggregation of rows. Rows are put into groups by
+// the values of group keys, then every group is computed to one row which
+// is composed with the values of group keys and the results of aggregates.
+//
+// The expressions after grouping, like output columns, HAVING and ORDER BY
+// are rewritten to refer to the columns of grouped rows, so they can be
+// evaluated by scope as well.
+type aggregation struct {
+	scope  scope
+	groups []ast.Expr
+	calls  []*ast.FuncCall
+}
+
+type group struct {
+	values      []Field
+	aggregators []aggregator
+}
+
+// Aggregate runs select statement with grouping on the rows of relation.
+func (r relation) aggregate(stmt *ast.QueryStmtSelectValues) (*Result, error) {
+	s := r.scope
+	if hasAggregate(stmt.Where) {
+		return nil, fmt.Errorf("%w: WHERE", ErrAggregateMisplaced)
+	}
+	for _, g := range stmt.GroupBy {
+		if hasAggregate(g) {
+			return nil, fmt.Errorf("%w: GROUP BY", ErrAggregateMisplaced)
+		}
+		if err := s.check(g); err != nil {
+			return nil, err
+		}
+	}
+	a := &aggregation{scope: s, groups: stmt.GroupBy}
+	selected := stmt.Columns
+	if stmt.ContainsAllColumns {
+		selected = s.selectAll()
+	}
+	columns := make([]ast.Column, 0, len(selected))
+	outputs := make([]ast.SelectColumn, 0, len(selected))
+	for _, c := range selected {
+		e, err := a.rewrite(c.Expr)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, ast.Column{Name: columnName(c), Kind: s.kind(c.Expr)})
+		outputs = append(outputs, ast.SelectColumn{Expr: e})
+	}
+	having, err := a.rewrite(stmt.Having)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]ast.OrderBy, 0, len(stmt.OrderBy))
+	for _, k := range stmt.OrderBy {
+		e, err := a.rewrite(k.Expr)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ast.OrderBy{Expr: e, Desc: k.Desc, Nulls: k.Nulls})
+	}
+	on := make([]ast.Expr, 0, len(stmt.DistinctOn))
+	for _, e := range stmt.DistinctOn {
+		e, err := a.rewrite(e)
+		if err != nil {
+			return nil, err
+		}
+		on = append(on, e)
+	}
+	gs := a.groupScope()
+	if err := gs.check(having); err != nil {
+		return nil, err
+	}
+	// window functions are computed for grouped rows
+	w, err := gs.windowing(outputs, keys, on)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered, _, err := s.filter(stmt.Where, r.rows)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.run(filtered)
+	if err != nil {
+		return nil, err
+	}
+	grouped := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		ok, err := gs.test(having, r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			grouped = append(grouped, r)
+		}
+	}
+	return w.output(stmt, columns, grouped)
+}
+
+// Rewrite replaces aggregate calls and group keys in expression with the
+// columns of grouped rows, other columns out of aggregates are not allowed.
+func (a *aggregation) rewrite(e ast.Expr) (ast.Expr, error) {
+	var err error
+	r := ast.Transform(e, func(e ast.Expr) (ast.Expr, bool) {
+		if err != nil {
+			return e, true
+		}
+		if f, ok := e.(*ast.FuncCall); ok && aggregates[f.Name] && f.Over == nil {
+			err = a.checkCall(f)
+			a.calls = append(a.calls, f)
+			return &ast.ColumnRef{Name: ast.ColumnName(fmt.Sprintf("#aggregate%d", len(a.calls)-1))}, true
+		}
+		if i := a.groupOf(e); i >= 0 {
+			return &ast.ColumnRef{Name: ast.ColumnName(fmt.Sprintf("#group%d", i))}, true
+		}
+		if c, ok := e.(*ast.ColumnRef); ok {
+			if _, err = a.scope.resolve(c); err == nil {
+				err = fmt.Errorf("%w: %s", ErrColumnNotGrouped, c.Name)
+			}
+			return e, true
+		}
+		// the arguments and windows of window functions are rewritten, as they
+		// are computed after grouping
+		if f, ok := e.(*ast.FuncCall); ok && f.Over != nil {
+			return e, false
+		}
+		// the arguments of scalar functions are rewritten too
+		if f, ok := e.(*ast.FuncCall); ok {
+			err = checkFunc(f)
+			return e, err != nil
+		}
+		return e, false
+	})
+	return r, err
+}
+
+// CheckCall checks the arguments of aggregate call, only count accepts *,
+// and aggregates can't be nested.
+func (a *aggregation) checkCall(f *ast.FuncCall) error {
+	if (f.Star && f.Name != "count") || (!f.Star && len(f.Args) != 1) {
+		return fmt.Errorf("%w: %s", ErrFuncArgsInvalid, f.Name)
+	}
+	for _, arg := range f.Args {
+		if hasAggregate(arg) {
+			return fmt.Errorf("%w: %s", ErrAggregateMisplaced, f.Name)
+		}
+		if err := a.scope.check(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GroupOf returns the position of group key which is the same as expression,
+// or -1 if not found.
+func (a *aggregation) groupOf(e ast.Expr) int {
+	for i, g := range a.groups {
+		c1, ok1 := e.(*ast.ColumnRef)
+		c2, ok2 := g.(*ast.ColumnRef)
+		if ok1 && ok2 {
+			i1, err1 := a.scope.resolve(c1)
+			i2, err2 := a.scope.resolve(c2)
+			if err1 == nil && err2 == nil && i1 == i2 {
+				return i
+			}
+			continue
+		}
+		if reflect.DeepEqual(e, g) {
+			return i
+		}
+	}
+	return -1
+}
+
+// GroupScope returns the scope of grouped rows, the group keys are followed
+// by the results of aggregates.
+func (a *aggregation) groupScope() scope {
+	s := scope{}
+	for i, g := range a.groups {
+		s.tables = append(s.tables, "")
+		s.columns = append(s.columns, ast.ColumnName(fmt.Sprintf("#group%d", i)))
+		s.kinds = append(s.kinds, a.scope.kind(g))
+	}
+	for i, f := range a.calls {
+		s.tables = append(s.tables, "")
+		s.columns = append(s.columns, ast.ColumnName(fmt.Sprintf("#aggregate%d", i)))
+		s.kinds = append(s.kinds, a.scope.kind(f))
+	}
+	return s
+}
+
+// Run puts rows into groups by hashing the values of group keys, and returns
+// one row for every group in the order of their first rows. Without GROUP BY
+// all rows are in one group, even if there isn't any row.
+func (a *aggregation) run(rows []Row) ([]Row, error) {
+	groups := make([]*group, 0)
+	hashed := make(map[string]*group)
+	if len(a.groups) == 0 {
+		g := a.newGroup(nil)
+		groups = append(groups, g)
+		hashed[""] = g
+	}
+	for _, r := range rows {
+		values := make([]Field, 0, len(a.groups))
+		for _, e := range a.groups {
+			v, err := a.scope.eval(e, r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		key := hashKey(values)
+		g, ok := hashed[key]
+		if !ok {
+			g = a.newGroup(values)
+			groups = append(groups, g)
+			hashed[key] = g
+		}
+		for i, f := range a.calls {
+			var v Field = true
+			if !f.Star {
+				var err error
+				if v, err = a.scope.eval(f.Args[0], r); err != nil {
+					return nil, err
+				}
+			}
+			if err := g.aggregators[i].add(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	grouped := make([]Row, 0, len(groups))
+	for _, g := range groups {
+		r := make(Row, 0, len(g.values)+len(g.aggregators))
+		r = append(r, g.values...)
+		for _, agg := range g.aggregators {
+			r = append(r, agg.result())
+		}
+		grouped = append(grouped, r)
+	}
+	return grouped, nil
+}
+
+func (a *aggregation) newGroup(values []Field) *group {
+	g := &group{values: values}
+	for _, f := range a.calls {
+		g.aggregators = append(g.aggregators, newAggregator(f.Name))
+	}
+	return g
+}
+
+// HashKey returns the key of values for hashing, the types are included so
+// that values like 1 and '1' are different.
+func hashKey(values []Field) string {
+	var sb strings.Builder
+	for _, v := range values {
+		sb.WriteString(fmt.Sprintf("%T:%v|", v, v))
+	}
+	return sb.String()
+}
+
+// Aggregator computes the result of an aggregate function, NULLs are ignored
+// by all aggregates except count(*).
+type aggregator interface {
+	add(v Field) error
+	result() Field
+}
+
+func newAggregator(name string) aggregator {
+	switch name {
+	case "count":
+		return &countAggregator{}
+	case "sum":
+		return &sumAggregator{name: name}
+	case "avg":
+		return &sumAggregator{name: name, avg: true}
+	case "min":
+		return &extremeAggregator{}
+	}
+	return &extremeAggregator{max: true}
+}
+
+type countAggregator struct {
+	n int64
+}
+
+func (a *countAggregator) add(v Field) error {
+	if v != nil {
+		a.n++
+	}
+	return nil
+}
+
+func (a *countAggregator) result() Field {
+	return a.n
+}
+
+// SumAggregator computes sum and avg, sum of integers is integer, and avg is
+// always float, so avg of INT 1 and 2 is 1.5 rather than truncated to 1.
+type sumAggregator struct {
+	name  string
+	avg   bool
+	n     int64
+	isum  int64
+	fsum  float64
+	float bool
+}
+
+func (a *sumAggregator) add(v Field) error {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		sum, err := intArithmetic(ast.BinaryOpAdd, a.isum, v)
+		switch {
+		case err == nil:
+			a.isum = sum
+		case a.avg:
+			// avg is float, so the integers overflowing are summed as floats
+			a.fsum += float64(v)
+		default:
+			return fmt.Errorf("%w: %s", err, a.name)
+		}
+	case float64:
+		a.fsum += v
+		a.float = true
+	default:
+		return fmt.Errorf("%w: %s(%T)", ErrFuncArgsInvalid, a.name, v)
+	}
+	a.n++
+	return nil
+}
+
+func (a *sumAggregator) result() Field {
+	if a.n == 0 {
+		return nil
+	}
+	if a.avg {
+		return (float64(a.isum) + a.fsum) / float64(a.n)
+	}
+	if a.float {
+		return float64(a.isum) + a.fsum
+	}
+	return a.isum
+}
+
+// ExtremeAggregator computes min or max.
+type extremeAggregator struct {
+	max   bool
+	value Field
+}
+
+func (a *extremeAggregator) add(v Field) error {
+	if v == nil {
+		return nil
+	}
+	if a.value == nil {
+		a.value = v
+		return nil
+	}
+	c, err := compare(v, a.value)
+	if err != nil {
+		return err
+	}
+	if (a.max && c > 0) || (!a.max && c < 0) {
+		a.value = v
+	}
+	return nil
+}
+
+func (a *extremeAggregator) result() Field {
+	return a.value
+}
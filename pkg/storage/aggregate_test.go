@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func newAggregateRelation() relation {
+	table := Table{
+		Name: "testaggregate1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "city", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+		Rows: []Row{
+			{"wang", "bj", int64(18)},
+			{"li", "sh", int64(20)},
+			{"zhao", "bj", int64(30)},
+			{"qian", "gz", nil},
+			{"sun", "bj", int64(13)},
+		},
+		Len: 5,
+	}
+	table.setColumnNames()
+	return relation{scope: newScope(table), rows: table.Rows, table: &table}
+}
+
+func TestAggregateWithGroupBy(t *testing.T) {
+	// GIVEN
+	rel := newAggregateRelation()
+	city := &ast.ColumnRef{Name: "city"}
+	age := &ast.ColumnRef{Name: "age"}
+	call := func(name string, args ...ast.Expr) *ast.FuncCall {
+		return &ast.FuncCall{Name: name, Args: args}
+	}
+	stmt := &ast.QueryStmtSelectValues{
+		Columns: []ast.SelectColumn{
+			{Expr: city},
+			{Expr: &ast.FuncCall{Name: "count", Star: true}},
+			{Expr: call("count", age)},
+			{Expr: call("sum", age)},
+			{Expr: call("avg", age)},
+			{Expr: call("min", &ast.ColumnRef{Name: "name"})},
+			{Expr: call("max", age)},
+		},
+		GroupBy: []ast.Expr{city},
+		OrderBy: []ast.OrderBy{{Expr: call("sum", age), Desc: true}},
+	}
+
+	// WHEN
+	r, err := rel.aggregate(stmt)
+
+	// THEN
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	names := []ast.ColumnName{"city", "count", "count", "sum", "avg", "min", "max"}
+	kinds := []ast.ColumnKind{
+		ast.ColumnKindText, ast.ColumnKindInt, ast.ColumnKindInt, ast.ColumnKindInt,
+		ast.ColumnKindFloat, ast.ColumnKindText, ast.ColumnKindInt,
+	}
+	for i, c := range r.Columns {
+		if c.Name != names[i] || c.Kind != kinds[i] {
+			t.Errorf("column %d should be %s %v, but got %s %v", i, names[i], kinds[i], c.Name, c.Kind)
+		}
+	}
+	// NULLs are first in descending order
+	want := []Row{
+		{"gz", int64(1), int64(0), nil, nil, "qian", nil},
+		{"bj", int64(3), int64(3), int64(61), float64(61) / 3, "sun", int64(30)},
+		{"sh", int64(1), int64(1), int64(20), float64(20), "li", int64(20)},
+	}
+	if len(r.Rows) != len(want) {
+		t.Fatalf("should get %d groups, but got %d", len(want), len(r.Rows))
+	}
+	for i, row := range r.Rows {
+		for j, f := range row {
+			if f != want[i][j] {
+				t.Errorf("group %d column %d should be %v, but got %v", i, j, want[i][j], f)
+			}
+		}
+	}
+}
+
+func TestAggregateWithHaving(t *testing.T) {
+	// GIVEN
+	rel := newAggregateRelation()
+	city := &ast.ColumnRef{Name: "city"}
+	count := &ast.FuncCall{Name: "count", Star: true}
+
+	tests := []struct {
+		stmt *ast.QueryStmtSelectValues
+		rows int
+	}{
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: count}},
+		}, 1},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: count}},
+			Where:   &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: city, Right: &ast.Literal{Kind: ast.LiteralKindString, Value: "tj"}},
+		}, 1},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: city}},
+			GroupBy: []ast.Expr{city},
+			Having:  &ast.CmpExpr{Cmp: ast.CmpKindGt, Left: count, Right: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"}},
+		}, 1},
+		{&ast.QueryStmtSelectValues{
+			ContainsAllColumns: true,
+			GroupBy:            []ast.Expr{city, &ast.ColumnRef{Name: "name"}, &ast.ColumnRef{Name: "age"}},
+		}, 5},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		r, err := rel.aggregate(tt.stmt)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+			continue
+		}
+		if len(r.Rows) != tt.rows {
+			t.Errorf("test %d should get %d rows, but got %d", i, tt.rows, len(r.Rows))
+		}
+	}
+}
+
+func TestAggregateFailed(t *testing.T) {
+	// GIVEN
+	rel := newAggregateRelation()
+	name := &ast.ColumnRef{Name: "name"}
+	city := &ast.ColumnRef{Name: "city"}
+	count := &ast.FuncCall{Name: "count", Star: true}
+
+	tests := []struct {
+		stmt *ast.QueryStmtSelectValues
+		err  error
+	}{
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: name}, {Expr: count}},
+			GroupBy: []ast.Expr{city},
+		}, ErrColumnNotGrouped},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: city}},
+			Where:   &ast.CmpExpr{Cmp: ast.CmpKindGt, Left: count, Right: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"}},
+			GroupBy: []ast.Expr{city},
+		}, ErrAggregateMisplaced},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: &ast.FuncCall{Name: "sum", Star: true}}},
+		}, ErrFuncArgsInvalid},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: &ast.FuncCall{Name: "sum", Args: []ast.Expr{name}}}},
+		}, ErrFuncArgsInvalid},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: &ast.FuncCall{Name: "max", Args: []ast.Expr{count}}}},
+		}, ErrAggregateMisplaced},
+		{&ast.QueryStmtSelectValues{
+			Columns: []ast.SelectColumn{{Expr: &ast.FuncCall{Name: "median", Args: []ast.Expr{name}}}},
+			GroupBy: []ast.Expr{city},
+		}, ErrFuncNotExisted},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		_, err := rel.aggregate(tt.stmt)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should fail with %v, but got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestSumAggregatorOverflow(t *testing.T) {
+	values := []Field{int64(math.MaxInt64), int64(1), int64(1)}
+
+	// WHEN
+	sum, avg := newAggregator("sum"), newAggregator("avg")
+	var err error
+	for _, v := range values {
+		if err == nil {
+			err = sum.add(v)
+		}
+		if e := avg.add(v); e != nil {
+			t.Fatalf("avg shouldn't fail, but got %v", e)
+		}
+	}
+
+	// THEN
+	if !errors.Is(err, ErrIntOutOfRange) {
+		t.Errorf("sum should fail with %v, but got %v", ErrIntOutOfRange, err)
+	}
+	if want := (float64(math.MaxInt64) + 2) / 3; avg.result() != want {
+		t.Errorf("avg should be %v, but got %v", want, avg.result())
+	}
+}
+
+func TestAvgOfIntegers(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testaggregate2 (a int, g text)",
+		"insert into testaggregate2 values (1, 'x'), (2, 'x'), (4, 'y')",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		values []Field
+	}{
+		{"select avg(a) from testaggregate2 where g = 'x'", []Field{1.5}},
+		{"select avg(a) from testaggregate2 group by g order by g", []Field{1.5, float64(4)}},
+		{"select avg(a) over (order by a) from testaggregate2", []Field{float64(1), 1.5, float64(7) / 3}},
+	}
+
+	// THEN, avg is never truncated to integer
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := Select(stmt.(*ast.QueryStmtSelectValues))
+		if err != nil {
+			t.Fatalf("test %d failed: %v", i, err)
+		}
+		if r.Columns[0].Kind != ast.ColumnKindFloat {
+			t.Errorf("test %d should get FLOAT column, but got %v", i, r.Columns[0].Kind)
+		}
+		values := make([]Field, 0, len(r.Rows))
+		for _, row := range r.Rows {
+			values = append(values, row[0])
+		}
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("test %d should get %v, but got %v", i, tt.values, values)
+		}
+	}
+	if f := formatField(1.5); f != "1.5" {
+		t.Errorf("avg should be shown as 1.5, but got %s", f)
+	}
+}
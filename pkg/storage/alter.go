@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrColumnExisted    = errors.New("column already existed")
+	ErrColumnNotExisted = errors.New("column not existed")
+	ErrColumnsEmpty     = errors.New("table must have at least one column")
+)
+
+// DropTable drops tables with their scheme, data and index files. None of the
+// tables is dropped if any of them doesn't exist, unless IF EXISTS is used,
+// or any of them is referenced by the tables not dropped.
+func DropTable(stmt *ast.QueryStmtDropTable) (*Result, error) {
+	for _, n := range stmt.TableNames {
+		t, ok := tables[n]
+		if !ok && stmt.IfExists {
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTableNotExisted, n)
+		}
+		if err := t.checkReferenced(stmt.TableNames); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range stmt.TableNames {
+		t, ok := tables[n]
+		if !ok {
+			continue
+		}
+		if err := t.removeFiles(); err != nil {
+			return nil, err
+		}
+		delete(tables, n)
+	}
+	return commandResult("DROP TABLE"), nil
+}
+
+// Truncate removes all rows of tables, the data files are emptied and the
+// indexes are rebuilt. The tables referenced by the tables not truncated
+// can't be truncated.
+func Truncate(stmt *ast.QueryStmtTruncateTable) (*Result, error) {
+	for _, n := range stmt.TableNames {
+		t, ok := tables[n]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTableNotExisted, n)
+		}
+		if err := t.checkReferenced(stmt.TableNames); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range stmt.TableNames {
+		t := tables[n]
+		if err := os.Truncate(t.dataPath(), 0); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		t.Rows = make([]Row, 0, tableRowDefaultCount)
+		t.locations = nil
+		t.Versions = nil
+		t.Len = 0
+		t.reindex()
+		if err := t.saveScheme(); err != nil {
+			return nil, err
+		}
+		tables[n] = t
+	}
+	return commandResult("TRUNCATE TABLE"), nil
+}
+
+// AlterTable changes the columns, constraints or name of a table. The rows in memory are
+// changed at once, but the data file isn't rewritten, the old writer schema
+// is kept to resolve the saved rows when loading them.
+func AlterTable(stmt *ast.QueryStmtAlterTable) (*Result, error) {
+	t, ok := tables[stmt.TableName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotExisted, stmt.TableName)
+	}
+	var err error
+	switch stmt.Action {
+	case ast.AlterTableActionAddColumn:
+		err = t.addColumn(stmt.Column, stmt.Constraints)
+	case ast.AlterTableActionDropColumn:
+		err = t.dropColumn(stmt.ColumnName)
+	case ast.AlterTableActionRenameColumn:
+		err = t.renameColumn(stmt.ColumnName, ast.ColumnName(stmt.NewName))
+	case ast.AlterTableActionRenameTable:
+		err = t.rename(stmt.NewName)
+	case ast.AlterTableActionAddConstraint:
+		err = t.addTableConstraints(stmt.Constraints)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.setColumnNames()
+	t.reindex()
+	if err := t.saveScheme(); err != nil {
+		return nil, err
+	}
+	tables[t.Name] = t
+	return commandResult("ALTER TABLE"), nil
+}
+
+// AddColumn appends column c with its constraints to the table, the existing
+// rows get the default value of c, which must meet the constraints.
+func (t *Table) addColumn(c ast.Column, constraints []ast.Constraint) error {
+	if t.columnIndex(c.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrColumnExisted, c.Name)
+	}
+	if c.Default != nil {
+		if _, err := valueField(c.Kind, c.Default); err != nil {
+			return fmt.Errorf("%w, column %s", err, c.Name)
+		}
+	}
+	added := *t
+	added.Columns = append(slices.Clone(t.Columns), c)
+	added.Constraints = slices.Clone(t.Constraints)
+	added.Rows = make([]Row, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		added.Rows = append(added.Rows, append(slices.Clone(r), defaultField(c)))
+	}
+	added.setColumnNames()
+	if err := added.addConstraints(constraints); err != nil {
+		return err
+	}
+	if err := added.checkRows(len(t.Constraints)); err != nil {
+		return err
+	}
+	t.keepVersion()
+	t.Columns, t.Rows, t.Constraints = added.Columns, added.Rows, added.Constraints
+	return nil
+}
+
+// AddTableConstraints adds table constraints to the table, which must be met
+// by the existing rows.
+func (t *Table) addTableConstraints(constraints []ast.Constraint) error {
+	added := *t
+	added.Constraints = slices.Clone(t.Constraints)
+	if err := added.addConstraints(constraints); err != nil {
+		return err
+	}
+	if err := added.checkRows(len(t.Constraints)); err != nil {
+		return err
+	}
+	t.Columns, t.Constraints = added.Columns, added.Constraints
+	return nil
+}
+
+// CheckRows checks if the rows meet the constraints added after the first n
+// ones, the rows are only compared with each other for the keys.
+func (t Table) checkRows(n int) error {
+	check := Table{Name: t.Name, Columns: t.Columns, Constraints: t.Constraints[n:]}
+	check.setColumnNames()
+	return check.validate(t.Rows, nil)
+}
+
+// DropColumn removes column c from the table and the rows, c is left with
+// empty name in old writer schemas.
+func (t *Table) dropColumn(c ast.ColumnName) error {
+	i := t.columnIndex(c)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrColumnNotExisted, c)
+	}
+	if len(t.Columns) == 1 {
+		return fmt.Errorf("%w: %s", ErrColumnsEmpty, t.Name)
+	}
+	for _, ref := range t.references() {
+		if ref.table != t.Name && slices.Contains(ref.constraint.RefColumns, c) {
+			return fmt.Errorf("%w: %s on table %s", ErrTableReferenced, ref.constraint.Name, ref.table)
+		}
+	}
+	t.keepVersion()
+	t.renameVersions(c, "")
+	t.dropConstraints(c)
+	t.Columns = slices.Delete(slices.Clone(t.Columns), i, i+1)
+	for j, r := range t.Rows {
+		t.Rows[j] = slices.Delete(slices.Clone(r), i, i+1)
+	}
+	return nil
+}
+
+// RenameColumn renames column c to n in the table and old writer schemas,
+// so that the saved rows are still resolved to c by name.
+func (t *Table) renameColumn(c, n ast.ColumnName) error {
+	i := t.columnIndex(c)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrColumnNotExisted, c)
+	}
+	if t.columnIndex(n) >= 0 {
+		return fmt.Errorf("%w: %s", ErrColumnExisted, n)
+	}
+	t.renameVersions(c, n)
+	t.renameConstraints(c, n)
+	if err := t.alterReferences(func(r *ast.Constraint) { r.RefColumns = renameColumns(r.RefColumns, c, n) }); err != nil {
+		return err
+	}
+	t.Columns = slices.Clone(t.Columns)
+	t.Columns[i].Name = n
+	return nil
+}
+
+// Rename renames the table to n, the scheme and index files of old name are
+// removed and the data file is moved.
+func (t *Table) rename(n string) error {
+	if _, ok := tables[n]; ok {
+		return fmt.Errorf("%w: %s", ErrTableExisted, n)
+	}
+	if err := checkTableName(n); err != nil {
+		return err
+	}
+	old := *t
+	t.Name = n
+	if err := old.alterReferences(func(r *ast.Constraint) { r.RefTable = n }); err != nil {
+		return err
+	}
+	constraints := make([]ast.Constraint, 0, len(t.Constraints))
+	for _, c := range t.Constraints {
+		if c.RefTable == old.Name {
+			c.RefTable = n
+		}
+		constraints = append(constraints, c)
+	}
+	t.Constraints = constraints
+	if err := os.Rename(old.dataPath(), t.dataPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	old.removeIndex()
+	if err := os.Remove(old.schemePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(tables, old.Name)
+	return nil
+}
+
+// KeepVersion keeps current columns as the writer schema of the rows saved
+// so far, it's called before the columns are added or dropped.
+func (t *Table) keepVersion() {
+	var end int64
+	if fi, err := os.Stat(t.dataPath()); err == nil {
+		end = fi.Size()
+	}
+	if n := len(t.Versions); end == 0 || (n > 0 && t.Versions[n-1].End >= end) {
+		return
+	}
+	t.Versions = append(t.Versions, schemaVersion{End: end, Columns: slices.Clone(t.Columns), Nullable: t.Nullable})
+}
+
+// RenameVersions renames column c to n in all old writer schemas.
+func (t *Table) renameVersions(c, n ast.ColumnName) {
+	versions := make([]schemaVersion, 0, len(t.Versions))
+	for _, v := range t.Versions {
+		columns := slices.Clone(v.Columns)
+		for i := range columns {
+			if columns[i].Name == c {
+				columns[i].Name = n
+			}
+		}
+		versions = append(versions, schemaVersion{End: v.End, Columns: columns, Nullable: v.Nullable})
+	}
+	t.Versions = versions
+}
+
+// ColumnIndex returns the position of column c, or -1 if not found.
+func (t Table) columnIndex(c ast.ColumnName) int {
+	return slices.IndexFunc(t.Columns, func(col ast.Column) bool { return col.Name == c })
+}
+
+// RemoveFiles removes the scheme, data and index files of the table.
+func (t Table) removeFiles() error {
+	for _, p := range []string{t.schemePath(), t.dataPath()} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.removeIndex()
+	return nil
+}
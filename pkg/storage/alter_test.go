@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+func TestAlterTableResolvesSavedRows(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testalter1 (name text, age int)", "insert into testalter1 values ('wang', 18), ('li', 20)")
+
+	// WHEN
+	alters := []*ast.QueryStmtAlterTable{
+		{TableName: "testalter1", Action: ast.AlterTableActionAddColumn, Column: ast.Column{Name: "city", Kind: ast.ColumnKindText}},
+		{TableName: "testalter1", Action: ast.AlterTableActionDropColumn, ColumnName: "age"},
+		{TableName: "testalter1", Action: ast.AlterTableActionRenameColumn, ColumnName: "name", NewName: "nick"},
+	}
+	for i, a := range alters {
+		if _, err := AlterTable(a); err != nil {
+			t.Fatalf("%s: when: alter %d should ok, but got err: %v", t.Name(), i, err)
+		}
+		if i == 0 {
+			insert := &ast.QueryStmtInsertValues{TableName: "testalter1", Rows: []ast.Row{values("'zhao'", "30", "'bj'")}, ContainsAllColumns: true}
+			if _, err := Insert(insert); err != nil {
+				t.Fatalf("%s: when: failed to insert rows: %v", t.Name(), err)
+			}
+		}
+	}
+
+	// THEN, rows in memory are altered
+	want := []Row{{"wang", nil}, {"li", nil}, {"zhao", "bj"}}
+	table := tables["testalter1"]
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("%s: then: rows should be %v, but got %v", t.Name(), want, table.Rows)
+	}
+
+	// THEN, rows saved with old schemas are resolved to current columns
+	loadScheme("testalter1.json")
+	loaded := tables["testalter1"]
+	rows, err := loaded.loadRows()
+	if err != nil {
+		t.Fatalf("%s: then: failed to load rows: %v", t.Name(), err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s: then: loaded rows should be %v, but got %v", t.Name(), want, rows)
+	}
+	if r, err := loaded.search("nick", "zhao"); err != nil || !reflect.DeepEqual(r, Row{"zhao", "bj"}) {
+		t.Errorf("%s: then: index of renamed column should find row, but got %v, %v", t.Name(), r, err)
+	}
+}
+
+func TestAlterTableFailed(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testalter2 (name text, age int)", "insert into testalter2 values ('wang', 18)")
+
+	// WHEN
+	tests := []struct {
+		stmt *ast.QueryStmtAlterTable
+		err  error
+	}{
+		{&ast.QueryStmtAlterTable{TableName: "testalterx", Action: ast.AlterTableActionDropColumn, ColumnName: "age"}, ErrTableNotExisted},
+		{&ast.QueryStmtAlterTable{TableName: "testalter2", Action: ast.AlterTableActionAddColumn, Column: ast.Column{Name: "age", Kind: ast.ColumnKindInt}}, ErrColumnExisted},
+		{&ast.QueryStmtAlterTable{TableName: "testalter2", Action: ast.AlterTableActionDropColumn, ColumnName: "city"}, ErrColumnNotExisted},
+		{&ast.QueryStmtAlterTable{TableName: "testalter2", Action: ast.AlterTableActionRenameColumn, ColumnName: "name", NewName: "age"}, ErrColumnExisted},
+		{&ast.QueryStmtAlterTable{TableName: "testalter2", Action: ast.AlterTableActionRenameTable, NewName: "testalter2"}, ErrTableExisted},
+		{&ast.QueryStmtAlterTable{TableName: "testalter2", Action: ast.AlterTableActionRenameTable, NewName: "../testalter5"}, ErrTableNameInvalid},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		if _, err := AlterTable(tt.stmt); !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: test %d should fail with %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+}
+
+func TestRenameTruncateAndDropTable(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testalter3 (name text, age int)", "insert into testalter3 values ('wang', 18), ('li', 20)")
+
+	// WHEN, renames table
+	rename := &ast.QueryStmtAlterTable{TableName: "testalter3", Action: ast.AlterTableActionRenameTable, NewName: "testalter4"}
+	if _, err := AlterTable(rename); err != nil {
+		t.Fatalf("%s: when: rename should ok, but got err: %v", t.Name(), err)
+	}
+
+	// THEN
+	if _, ok := tables["testalter3"]; ok {
+		t.Errorf("%s: then: table of old name should be removed", t.Name())
+	}
+	table := tables["testalter4"]
+	if _, err := os.Stat(table.dataPath()); err != nil {
+		t.Errorf("%s: then: data file should be moved, but got err: %v", t.Name(), err)
+	}
+	if r, err := table.search("name", "li"); err != nil || !reflect.DeepEqual(r, Row{"li", int64(20)}) {
+		t.Errorf("%s: then: index should be rebuilt, but got %v, %v", t.Name(), r, err)
+	}
+
+	// WHEN, truncates table
+	if _, err := Truncate(&ast.QueryStmtTruncateTable{TableNames: []string{"testalter4"}}); err != nil {
+		t.Fatalf("%s: when: truncate should ok, but got err: %v", t.Name(), err)
+	}
+
+	// THEN
+	table = tables["testalter4"]
+	rows, _ := table.loadRows()
+	if len(table.Rows) != 0 || len(rows) != 0 {
+		t.Errorf("%s: then: rows should be removed, but got %v and %v", t.Name(), table.Rows, rows)
+	}
+
+	// WHEN, drops table
+	drop := &ast.QueryStmtDropTable{TableNames: []string{"testalter4"}}
+	if _, err := DropTable(drop); err != nil {
+		t.Fatalf("%s: when: drop should ok, but got err: %v", t.Name(), err)
+	}
+
+	// THEN
+	if _, ok := tables["testalter4"]; ok {
+		t.Errorf("%s: then: table should be dropped", t.Name())
+	}
+	if _, err := os.Stat(table.schemePath()); !os.IsNotExist(err) {
+		t.Errorf("%s: then: scheme file should be removed, but got err: %v", t.Name(), err)
+	}
+	if _, err := DropTable(drop); !errors.Is(err, ErrTableNotExisted) {
+		t.Errorf("%s: then: dropping again should fail, but got err: %v", t.Name(), err)
+	}
+	drop.IfExists = true
+	if _, err := DropTable(drop); err != nil {
+		t.Errorf("%s: then: dropping with IF EXISTS should ok, but got err: %v", t.Name(), err)
+	}
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrNotNullViolated    = errors.New("null value violates not-null constraint")
+	ErrUniqueViolated     = errors.New("duplicate key value violates unique constraint")
+	ErrPrimaryKeyMultiple = errors.New("multiple primary keys for table are not allowed")
+	ErrConstraintExisted  = errors.New("constraint already existed")
+	ErrCheckViolated      = errors.New("new row violates check constraint")
+)
+
+// AddConstraints adds constraints to the table, the constraints without name
+// are named like PostgreSQL, such as users_pkey and users_name_key. Columns
+// of primary key are not null. FOREIGN KEYs are added after the keys, so
+// that they can reference the keys of the table itself.
+func (t *Table) addConstraints(constraints []ast.Constraint) error {
+	keys := make([]ast.Constraint, 0, len(constraints))
+	foreigns := make([]ast.Constraint, 0, len(constraints))
+	for _, c := range constraints {
+		if c.Kind == ast.ConstraintKindForeignKey {
+			foreigns = append(foreigns, c)
+		} else {
+			keys = append(keys, c)
+		}
+	}
+	for _, c := range append(keys, foreigns...) {
+		if err := t.addConstraint(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) addConstraint(c ast.Constraint) error {
+	for _, n := range c.Columns {
+		if t.columnIndex(n) < 0 {
+			return fmt.Errorf("%w: %s", ErrColumnNotExisted, n)
+		}
+	}
+	if c.Kind == ast.ConstraintKindCheck {
+		columns, err := t.checkColumns(c.Check)
+		if err != nil {
+			return err
+		}
+		c.Columns = columns
+	}
+	if c.Name == "" {
+		c.Name = t.constraintName(c)
+	}
+	for _, o := range t.Constraints {
+		if o.Name == c.Name {
+			return fmt.Errorf("%w: %s", ErrConstraintExisted, c.Name)
+		}
+		if o.Kind == ast.ConstraintKindPrimaryKey && c.Kind == ast.ConstraintKindPrimaryKey {
+			return fmt.Errorf("%w: %s", ErrPrimaryKeyMultiple, t.Name)
+		}
+	}
+	switch c.Kind {
+	case ast.ConstraintKindPrimaryKey:
+		t.Columns = slices.Clone(t.Columns)
+		for _, n := range c.Columns {
+			t.Columns[t.columnIndex(n)].NotNull = true
+		}
+	case ast.ConstraintKindForeignKey:
+		refColumns, err := t.referencedColumns(c)
+		if err != nil {
+			return err
+		}
+		c.RefColumns = refColumns
+	}
+	t.Constraints = append(t.Constraints, c)
+	return nil
+}
+
+// ConstraintName returns the default name of constraint c, which is suffixed
+// by a number if the name is used by other constraints of the table.
+func (t Table) constraintName(c ast.Constraint) string {
+	names := []string{t.Name}
+	switch c.Kind {
+	case ast.ConstraintKindPrimaryKey:
+		names = append(names, "pkey")
+	case ast.ConstraintKindCheck:
+		// CHECK is named by its column only if it refers to one column
+		if len(c.Columns) == 1 {
+			names = append(names, string(c.Columns[0]))
+		}
+		names = append(names, "check")
+	default:
+		for _, n := range c.Columns {
+			names = append(names, string(n))
+		}
+		if c.Kind == ast.ConstraintKindForeignKey {
+			names = append(names, "fkey")
+		} else {
+			names = append(names, "key")
+		}
+	}
+	name := strings.Join(names, "_")
+	for i := 1; slices.ContainsFunc(t.Constraints, func(o ast.Constraint) bool { return o.Name == name }); i++ {
+		name = fmt.Sprintf("%s%d", strings.Join(names, "_"), i)
+	}
+	return name
+}
+
+// CheckColumns parses the expression of CHECK, and returns the columns it
+// refers to, which must be columns of the table.
+func (t Table) checkColumns(source string) ([]ast.ColumnName, error) {
+	e, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := newScope(t).check(e); err != nil {
+		return nil, err
+	}
+	columns := make([]ast.ColumnName, 0)
+	ast.Walk(e, func(e ast.Expr) bool {
+		if c, ok := e.(*ast.ColumnRef); ok && !slices.Contains(columns, c.Name) {
+			columns = append(columns, c.Name)
+		}
+		return true
+	})
+	return columns, nil
+}
+
+// Validate checks if rows meet the constraints of table before saving them.
+// The rows at skip are replaced by rows, so they are ignored when checking
+// if keys are duplicated.
+func (t Table) validate(rows []Row, skip []int) error {
+	for _, r := range rows {
+		for i, c := range t.Columns {
+			if c.NotNull && r[i] == nil {
+				return fmt.Errorf("%w, column %s", ErrNotNullViolated, c.Name)
+			}
+		}
+	}
+	for _, c := range t.Constraints {
+		var err error
+		switch c.Kind {
+		case ast.ConstraintKindPrimaryKey, ast.ConstraintKindUnique:
+			err = t.checkUnique(c, rows, skip)
+		case ast.ConstraintKindForeignKey:
+			err = t.checkForeignKey(c, rows, skip)
+		case ast.ConstraintKindCheck:
+			err = t.evalCheck(c, rows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EvalCheck evaluates the expression of CHECK c for rows, it's violated if
+// the result is false, but not if the result is unknown.
+func (t Table) evalCheck(c ast.Constraint, rows []Row) error {
+	e, err := parser.ParseExpr(c.Check)
+	if err != nil {
+		return err
+	}
+	s := newScope(t)
+	for _, r := range rows {
+		v, err := s.evalBool(e, r, "CHECK")
+		if err != nil {
+			return err
+		}
+		if b, ok := v.(bool); ok && !b {
+			return fmt.Errorf("%w: %s", ErrCheckViolated, c.Name)
+		}
+	}
+	return nil
+}
+
+// CheckUnique checks if the keys of rows are unique for constraint c, which
+// are compared with each other and the keys of existing rows. As NULLs are
+// never equal, the keys containing NULL are always unique.
+func (t Table) checkUnique(c ast.Constraint, rows []Row, skip []int) error {
+	columns := t.columnIndexes(c.Columns)
+	positions, indexed := t.positions()
+	seen := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		values := r.key(columns)
+		if slices.Contains(values, nil) {
+			continue
+		}
+		key := hashKey(values)
+		if seen[key] {
+			return fmt.Errorf("%w: %s", ErrUniqueViolated, c.Name)
+		}
+		seen[key] = true
+		found, err := t.findKey(columns, values, positions, indexed)
+		if err != nil {
+			return err
+		}
+		for _, i := range found {
+			if !slices.Contains(skip, i) {
+				return fmt.Errorf("%w: %s", ErrUniqueViolated, c.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// FindKey returns the positions of rows whose fields of columns are values.
+// The rows are searched by the B-tree index of the first column if rows are
+// indexed, otherwise all rows are compared.
+func (t Table) findKey(columns []int, values []Field, positions map[location]int, indexed bool) ([]int, error) {
+	candidates := make([]int, 0)
+	first := t.Columns[columns[0]].Name
+	if indexed && t.index != nil && t.index.getBtree(string(first)) != nil {
+		var err error
+		if candidates, err = t.searchAll(first, values[0], positions); err != nil {
+			return nil, err
+		}
+	} else {
+		for i := range t.Rows {
+			candidates = append(candidates, i)
+		}
+	}
+	found := make([]int, 0, len(candidates))
+	for _, i := range candidates {
+		equal := true
+		for j, c := range columns {
+			if cmp, err := compare(t.Rows[i][c], values[j]); t.Rows[i][c] == nil || err != nil || cmp != 0 {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			found = append(found, i)
+		}
+	}
+	return found, nil
+}
+
+// ColumnIndexes returns the positions of columns.
+func (t Table) columnIndexes(columns []ast.ColumnName) []int {
+	indexes := make([]int, 0, len(columns))
+	for _, n := range columns {
+		indexes = append(indexes, t.columnIndex(n))
+	}
+	return indexes
+}
+
+// Key returns the fields of row r at columns.
+func (r Row) key(columns []int) []Field {
+	values := make([]Field, 0, len(columns))
+	for _, i := range columns {
+		values = append(values, r[i])
+	}
+	return values
+}
+
+// DropConstraints removes the constraints over column c, including CHECKs
+// referring to c and the FOREIGN KEYs of the table itself referencing c.
+func (t *Table) dropConstraints(c ast.ColumnName) {
+	constraints := make([]ast.Constraint, 0, len(t.Constraints))
+	for _, o := range t.Constraints {
+		if slices.Contains(o.Columns, c) || (o.RefTable == t.Name && slices.Contains(o.RefColumns, c)) {
+			continue
+		}
+		constraints = append(constraints, o)
+	}
+	t.Constraints = constraints
+}
+
+// RenameConstraints renames column c to n in the constraints.
+func (t *Table) renameConstraints(c, n ast.ColumnName) {
+	constraints := make([]ast.Constraint, 0, len(t.Constraints))
+	for _, o := range t.Constraints {
+		o.Columns = renameColumns(o.Columns, c, n)
+		if o.Kind == ast.ConstraintKindCheck {
+			if source, err := parser.RenameColumn(o.Check, string(c), string(n)); err == nil {
+				o.Check = source
+			}
+		}
+		if o.RefTable == t.Name {
+			o.RefColumns = renameColumns(o.RefColumns, c, n)
+		}
+		constraints = append(constraints, o)
+	}
+	t.Constraints = constraints
+}
+
+// RenameColumns returns a copy of columns with c renamed to n.
+func renameColumns(columns []ast.ColumnName, c, n ast.ColumnName) []ast.ColumnName {
+	renamed := slices.Clone(columns)
+	for i := range renamed {
+		if renamed[i] == c {
+			renamed[i] = n
+		}
+	}
+	return renamed
+}
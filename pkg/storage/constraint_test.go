@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+func TestInsertWithConstraints(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testconstraint1 (id int primary key, name text unique, age int default 18)")
+
+	// WHEN
+	insert := &ast.QueryStmtInsertValues{
+		TableName:   "testconstraint1",
+		ColumnNames: []ast.ColumnName{"name", "id"},
+		Rows:        []ast.Row{values("'wang'", "1"), values("NULL", "2"), values("NULL", "3")},
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("%s: when: insert should ok, but got err: %v", t.Name(), err)
+	}
+
+	// THEN, omitted columns get default values and NULLs are unique
+	want := []Row{{int64(1), "wang", int64(18)}, {int64(2), nil, int64(18)}, {int64(3), nil, int64(18)}}
+	if rows := tables["testconstraint1"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s: then: rows should be %v, but got %v", t.Name(), want, rows)
+	}
+
+	// THEN, rows violating constraints are rejected
+	tests := []struct {
+		columns []ast.ColumnName
+		rows    []ast.Row
+		err     error
+	}{
+		{nil, []ast.Row{values("1", "'li'", "20")}, ErrUniqueViolated},
+		{nil, []ast.Row{values("NULL", "'li'", "20")}, ErrNotNullViolated},
+		{nil, []ast.Row{values("4", "'wang'", "20")}, ErrUniqueViolated},
+		{nil, []ast.Row{values("4", "'li'", "20"), values("6", "'li'", "20")}, ErrUniqueViolated},
+		{[]ast.ColumnName{"name"}, []ast.Row{values("'li'")}, ErrNotNullViolated},
+		{[]ast.ColumnName{"id", "city"}, []ast.Row{values("4", "'bj'")}, ErrColumnNamesNotMatched},
+		{[]ast.ColumnName{"id", "id"}, []ast.Row{values("4", "6")}, ErrColumnDuplicated},
+	}
+	for i, tt := range tests {
+		insert := &ast.QueryStmtInsertValues{TableName: "testconstraint1", ColumnNames: tt.columns, Rows: tt.rows, ContainsAllColumns: tt.columns == nil}
+		if _, err := Insert(insert); !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: insert %d should fail with %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+	if n := len(tables["testconstraint1"].Rows); n != 3 {
+		t.Errorf("%s: then: rejected rows shouldn't be inserted, but got %d rows", t.Name(), n)
+	}
+
+	// THEN, constraints are saved in scheme
+	loadScheme("testconstraint1.json")
+	loaded := tables["testconstraint1"]
+	constraints := []ast.Constraint{
+		{Name: "testconstraint1_pkey", Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+		{Name: "testconstraint1_name_key", Kind: ast.ConstraintKindUnique, Columns: []ast.ColumnName{"name"}},
+	}
+	if !reflect.DeepEqual(loaded.Constraints, constraints) || !loaded.Columns[0].NotNull {
+		t.Errorf("%s: then: constraints should be %v, but got %v", t.Name(), constraints, loaded.Constraints)
+	}
+}
+
+func TestUpdateWithConstraints(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testconstraint2 (id int primary key, name text unique, age int default 18)")
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testconstraint2",
+		Rows:               []ast.Row{values("1", "'wang'", "20"), values("2", "'li'", "30")},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+
+	// WHEN
+	tests := []struct {
+		values []ast.ColumnUpdatedValue
+		where  ast.Expr
+		err    error
+	}{
+		{[]ast.ColumnUpdatedValue{{Name: "name", Value: value("'li'")}}, nil, ErrUniqueViolated},
+		{[]ast.ColumnUpdatedValue{{Name: "id", Value: value("2")}}, &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: &ast.ColumnRef{Name: "id"}, Right: value("1")}, ErrUniqueViolated},
+		{[]ast.ColumnUpdatedValue{{Name: "id", Value: value("NULL")}}, nil, ErrNotNullViolated},
+		{[]ast.ColumnUpdatedValue{{Name: "name", Value: value("'wang'")}}, &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: &ast.ColumnRef{Name: "id"}, Right: value("1")}, nil},
+		{[]ast.ColumnUpdatedValue{{Name: "name", Value: value("NULL")}}, nil, nil},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		update := &ast.QueryStmtUpdateValues{TableName: "testconstraint2", Values: tt.values, Where: tt.where}
+		if _, err := Update(update); !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: update %d should get err %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+	want := []Row{{int64(1), nil, int64(20)}, {int64(2), nil, int64(30)}}
+	if rows := tables["testconstraint2"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s: then: rows should be %v, but got %v", t.Name(), want, rows)
+	}
+}
+
+func TestConstraintsFailed(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testconstraint3 (id int primary key, name text unique, age int default 18)")
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testconstraint3",
+		Rows:               []ast.Row{values("1", "'wang'", "20"), values("2", "'li'", "30")},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+
+	// WHEN
+	columns := []ast.Column{{Name: "id", Kind: ast.ColumnKindInt}}
+	tests := []struct {
+		stmt ast.QueryStmt
+		err  error
+	}{
+		{&ast.QueryStmtCreateTable{Name: "testconstraint4", Columns: columns, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindUnique, Columns: []ast.ColumnName{"age"}},
+		}}, ErrColumnNotExisted},
+		{&ast.QueryStmtCreateTable{Name: "testconstraint4", Columns: columns, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+			{Name: "testconstraint4_pkey", Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+		}}, ErrConstraintExisted},
+		{&ast.QueryStmtCreateTable{Name: "testconstraint4", Columns: columns, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+			{Name: "testconstraint4_id", Kind: ast.ConstraintKindPrimaryKey, Columns: []ast.ColumnName{"id"}},
+		}}, ErrPrimaryKeyMultiple},
+		{&ast.QueryStmtCreateTable{Name: "testconstraint4", Columns: []ast.Column{
+			{Name: "id", Kind: ast.ColumnKindInt, Default: &ast.Literal{Kind: ast.LiteralKindString, Value: "x"}},
+		}}, ErrIntInvalid},
+		{&ast.QueryStmtAlterTable{TableName: "testconstraint3", Action: ast.AlterTableActionAddColumn,
+			Column: ast.Column{Name: "city", Kind: ast.ColumnKindText, NotNull: true},
+		}, ErrNotNullViolated},
+		{&ast.QueryStmtAlterTable{TableName: "testconstraint3", Action: ast.AlterTableActionAddColumn,
+			Column:      ast.Column{Name: "city", Kind: ast.ColumnKindText, Default: &ast.Literal{Kind: ast.LiteralKindString, Value: "bj"}},
+			Constraints: []ast.Constraint{{Kind: ast.ConstraintKindUnique, Columns: []ast.ColumnName{"city"}}},
+		}, ErrUniqueViolated},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		var err error
+		switch s := tt.stmt.(type) {
+		case *ast.QueryStmtCreateTable:
+			_, err = CreateTable(s)
+		case *ast.QueryStmtAlterTable:
+			_, err = AlterTable(s)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: test %d should fail with %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+	if _, ok := tables["testconstraint4"]; ok {
+		t.Errorf("%s: then: table with invalid constraints shouldn't be created", t.Name())
+	}
+	if table := tables["testconstraint3"]; len(table.Columns) != 3 || len(table.Rows[0]) != 3 {
+		t.Errorf("%s: then: table shouldn't be altered, but got %v", t.Name(), table.Columns)
+	}
+
+	// WHEN, renames and drops column of constraint
+	rename := &ast.QueryStmtAlterTable{TableName: "testconstraint3", Action: ast.AlterTableActionRenameColumn, ColumnName: "name", NewName: "nick"}
+	drop := &ast.QueryStmtAlterTable{TableName: "testconstraint3", Action: ast.AlterTableActionDropColumn, ColumnName: "id"}
+	for _, a := range []*ast.QueryStmtAlterTable{rename, drop} {
+		if _, err := AlterTable(a); err != nil {
+			t.Fatalf("%s: when: alter should ok, but got err: %v", t.Name(), err)
+		}
+	}
+
+	// THEN
+	constraints := []ast.Constraint{{Name: "testconstraint3_name_key", Kind: ast.ConstraintKindUnique, Columns: []ast.ColumnName{"nick"}}}
+	if c := tables["testconstraint3"].Constraints; !reflect.DeepEqual(c, constraints) {
+		t.Errorf("%s: then: constraints should be %v, but got %v", t.Name(), constraints, c)
+	}
+}
+
+func TestCheckConstraints(t *testing.T) {
+	// GIVEN
+	create := &ast.QueryStmtCreateTable{
+		Name:    "testcheck1",
+		Columns: []ast.Column{{Name: "name", Kind: ast.ColumnKindText}, {Name: "age", Kind: ast.ColumnKindInt}},
+		Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindCheck, Check: "age > 0"},
+			{Kind: ast.ConstraintKindCheck, Check: "name <> 'x' or age > 20"},
+		},
+	}
+	if _, err := CreateTable(create); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+
+	// WHEN
+	tests := []struct {
+		stmt ast.QueryStmt
+		err  error
+	}{
+		{&ast.QueryStmtInsertValues{TableName: "testcheck1", Rows: []ast.Row{values("'wang'", "18"), values("'x'", "30"), values("'li'", "NULL")}, ContainsAllColumns: true}, nil},
+		{&ast.QueryStmtInsertValues{TableName: "testcheck1", Rows: []ast.Row{values("'zhao'", "18"), values("'qian'", "0")}, ContainsAllColumns: true}, ErrCheckViolated},
+		{&ast.QueryStmtInsertValues{TableName: "testcheck1", Rows: []ast.Row{values("'x'", "18")}, ContainsAllColumns: true}, ErrCheckViolated},
+		{&ast.QueryStmtUpdateValues{TableName: "testcheck1", Values: []ast.ColumnUpdatedValue{{Name: "age", Value: value("-1")}}}, ErrCheckViolated},
+		{&ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionAddConstraint, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindCheck, Check: "age < 20"},
+		}}, ErrCheckViolated},
+		{&ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionAddConstraint, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindCheck, Check: "city <> ''"},
+		}}, ErrColumnNamesNotMatched},
+		{&ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionAddConstraint, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindCheck, Check: "count(age) > 0"},
+		}}, ErrAggregateMisplaced},
+		{&ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionAddConstraint, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindCheck, Check: "age < 200"},
+		}}, nil},
+		{&ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionRenameColumn, ColumnName: "age", NewName: "years"}, nil},
+		{&ast.QueryStmtInsertValues{TableName: "testcheck1", Rows: []ast.Row{values("'zhao'", "200")}, ContainsAllColumns: true}, ErrCheckViolated},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		var err error
+		switch s := tt.stmt.(type) {
+		case *ast.QueryStmtInsertValues:
+			_, err = Insert(s)
+		case *ast.QueryStmtUpdateValues:
+			_, err = Update(s)
+		case *ast.QueryStmtAlterTable:
+			_, err = AlterTable(s)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: test %d should get err %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+	if n := len(tables["testcheck1"].Rows); n != 3 {
+		t.Errorf("%s: then: rows violating checks shouldn't be saved, but got %d rows", t.Name(), n)
+	}
+
+	// THEN, checks keep their names, but the columns are renamed
+	loadScheme("testcheck1.json")
+	want := []ast.Constraint{
+		{Name: "testcheck1_age_check", Kind: ast.ConstraintKindCheck, Columns: []ast.ColumnName{"years"}, Check: "years > 0"},
+		{Name: "testcheck1_check", Kind: ast.ConstraintKindCheck, Columns: []ast.ColumnName{"name", "years"}, Check: "name <> 'x' or years > 20"},
+		{Name: "testcheck1_age_check1", Kind: ast.ConstraintKindCheck, Columns: []ast.ColumnName{"years"}, Check: "years < 200"},
+	}
+	if c := tables["testcheck1"].Constraints; !reflect.DeepEqual(c, want) {
+		t.Errorf("%s: then: constraints should be %v, but got %v", t.Name(), want, c)
+	}
+
+	// THEN, checks are dropped with their columns
+	drop := &ast.QueryStmtAlterTable{TableName: "testcheck1", Action: ast.AlterTableActionDropColumn, ColumnName: "years"}
+	if _, err := AlterTable(drop); err != nil || len(tables["testcheck1"].Constraints) != 0 {
+		t.Errorf("%s: then: checks should be dropped, but got %v, %v", t.Name(), tables["testcheck1"].Constraints, err)
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"golang.org/x/exp/slices"
+)
+
+var ErrDistinctOnNotMatched = errors.New("SELECT DISTINCT ON expressions must match initial ORDER BY expressions")
+
+// CheckDistinctOn checks if the initial keys of ORDER BY are the expressions
+// of DISTINCT ON in any order, so the first row of every distinct rows is
+// determined by the rest of keys.
+func checkDistinctOn(stmt *ast.QueryStmtSelectValues) error {
+	for i, k := range stmt.OrderBy {
+		if i >= len(stmt.DistinctOn) {
+			break
+		}
+		matched := slices.IndexFunc(stmt.DistinctOn, func(e ast.Expr) bool {
+			return reflect.DeepEqual(e, k.Expr)
+		})
+		if matched < 0 {
+			return ErrDistinctOnNotMatched
+		}
+	}
+	return nil
+}
+
+// Output returns the result of rows projected to the selected columns which
+// are described by columns, the rows are returned as they are if selected is
+// nil. The duplicated rows of DISTINCT, or the rows whose values of DISTINCT
+// ON expressions on are the same as the rows before them, are removed before
+// OFFSET and LIMIT.
+func (s scope) output(stmt *ast.QueryStmtSelectValues, columns []ast.Column, selected []ast.SelectColumn, on []ast.Expr, rows []Row) (*Result, error) {
+	project := func(rows []Row) (*Result, error) {
+		if selected == nil {
+			return selectedResult(columns, rows), nil
+		}
+		return s.project(columns, selected, rows)
+	}
+	var err error
+	if stmt.Distinct && len(on) == 0 {
+		r, err := project(rows)
+		if err != nil {
+			return nil, err
+		}
+		if rows, err = s.distinct(r.Rows, nil); err != nil {
+			return nil, err
+		}
+		if rows, err = slice(rows, stmt.Limit, stmt.Offset); err != nil {
+			return nil, err
+		}
+		return selectedResult(columns, rows), nil
+	}
+	if len(on) > 0 {
+		if rows, err = s.distinct(rows, on); err != nil {
+			return nil, err
+		}
+	}
+	if rows, err = slice(rows, stmt.Limit, stmt.Offset); err != nil {
+		return nil, err
+	}
+	return project(rows)
+}
+
+// Distinct keeps the first one of rows whose values of exprs are the same by
+// hashing the values, the rows are compared by all fields if exprs is empty.
+// NULLs are the same as each other here like PostgreSQL.
+func (s scope) distinct(rows []Row, exprs []ast.Expr) ([]Row, error) {
+	seen := make(map[string]bool, len(rows))
+	distinct := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		values := r
+		if len(exprs) > 0 {
+			values = make(Row, 0, len(exprs))
+			for _, e := range exprs {
+				v, err := s.eval(e, r)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+		}
+		key := hashKey(values)
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, r)
+		}
+	}
+	return distinct, nil
+}
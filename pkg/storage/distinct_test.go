@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestSelectDistinct(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testdistinct1 (name text, age int, city text)",
+		"insert into testdistinct1 values ('wang', 18, 'bj'), ('li', 20, 'sh'), ('wang', 18, 'sh'), ('zhao', null, 'bj'), ('qian', null, 'bj'), ('li', 20, 'sh')",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"select distinct * from testdistinct1", []Row{{"wang", int64(18), "bj"}, {"li", int64(20), "sh"}, {"wang", int64(18), "sh"}, {"zhao", nil, "bj"}, {"qian", nil, "bj"}}, nil},
+		{"select all name from testdistinct1 where age = 20", []Row{{"li"}, {"li"}}, nil},
+		{"select distinct name, age from testdistinct1 order by name", []Row{{"li", int64(20)}, {"qian", nil}, {"wang", int64(18)}, {"zhao", nil}}, nil},
+		// NULLs are not distinct from each other
+		{"select distinct age from testdistinct1 order by age", []Row{{int64(18)}, {int64(20)}, {nil}}, nil},
+		{"select distinct age + 1 as next from testdistinct1 where age is not null", []Row{{int64(19)}, {int64(21)}}, nil},
+		{"select distinct city from testdistinct1 order by city desc limit 1 offset 1", []Row{{"bj"}}, nil},
+		{"select distinct on (city) name, city from testdistinct1 order by city, name desc", []Row{{"zhao", "bj"}, {"wang", "sh"}}, nil},
+		{"select distinct on (city, age) city, age, name from testdistinct1 order by age, city, name", []Row{{"bj", int64(18), "wang"}, {"sh", int64(18), "wang"}, {"sh", int64(20), "li"}, {"bj", nil, "qian"}}, nil},
+		{"select distinct on (upper(city)) * from testdistinct1", []Row{{"wang", int64(18), "bj"}, {"li", int64(20), "sh"}}, nil},
+		{"select distinct city, count(*) from testdistinct1 group by city, age order by city, count(*)", []Row{{"bj", int64(1)}, {"bj", int64(2)}, {"sh", int64(1)}, {"sh", int64(2)}}, nil},
+		{"select distinct on (count(*)) count(*), city from testdistinct1 group by city order by count(*)", []Row{{int64(3), "bj"}}, nil},
+		{"select distinct on (city) name from testdistinct1 order by name", nil, ErrDistinctOnNotMatched},
+		{"select distinct on (nothing) name from testdistinct1", nil, ErrColumnNamesNotMatched},
+		{"select distinct on (age) city from testdistinct1 group by city", nil, ErrColumnNotGrouped},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := Select(stmt.(*ast.QueryStmtSelectValues))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+	}
+}
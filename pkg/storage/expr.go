@@ -0,0 +1,612 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrColumnAmbiguous    = errors.New("column reference is ambiguous")
+	ErrExprNotBoolean     = errors.New("argument must be type boolean")
+	ErrExprTypesMismatch  = errors.New("operator does not exist for the types")
+	ErrFuncNotExisted     = errors.New("function does not exist")
+	ErrAggregateMisplaced = errors.New("aggregate functions are not allowed here")
+	ErrParamNotBound      = errors.New("there is no value bound to parameter")
+	ErrDivisionByZero     = errors.New("division by zero")
+)
+
+// Scope binds the column references of expressions to the fields of rows,
+// every column is qualified by the name of table it belongs to.
+type scope struct {
+	tables  []string
+	columns []ast.ColumnName
+	kinds   []ast.ColumnKind
+	// cache of subqueries evaluated with the rows of scope, it's shared by
+	// the scopes derived from the scope, and nothing is cached if it's nil.
+	cache *subqueryCache
+}
+
+func newScope(t Table) scope {
+	s := scope{
+		tables:  make([]string, 0, len(t.ColumnNames)),
+		columns: make([]ast.ColumnName, 0, len(t.ColumnNames)),
+		kinds:   make([]ast.ColumnKind, 0, len(t.ColumnNames)),
+		cache:   newSubqueryCache(),
+	}
+	for i, c := range t.ColumnNames {
+		s.tables = append(s.tables, t.Name)
+		s.columns = append(s.columns, c)
+		if i < len(t.Columns) {
+			s.kinds = append(s.kinds, t.Columns[i].Kind)
+		} else {
+			s.kinds = append(s.kinds, ast.ColumnKindUnknown)
+		}
+	}
+	return s
+}
+
+// As returns the scope whose columns are qualified by name, which is the
+// alias of table.
+func (s scope) as(name string) scope {
+	tables := make([]string, 0, len(s.tables))
+	for range s.tables {
+		tables = append(tables, name)
+	}
+	return scope{tables: tables, columns: s.columns, kinds: s.kinds, cache: s.cache}
+}
+
+// Join returns the scope of rows concatenated by rows of s and o.
+func (s scope) join(o scope) scope {
+	return scope{
+		tables:  append(append([]string{}, s.tables...), o.tables...),
+		columns: append(append([]ast.ColumnName{}, s.columns...), o.columns...),
+		kinds:   append(append([]ast.ColumnKind{}, s.kinds...), o.kinds...),
+		cache:   s.cache,
+	}
+}
+
+// SelectAll returns the output columns of *, which are all columns of scope.
+func (s scope) selectAll() []ast.SelectColumn {
+	selected := make([]ast.SelectColumn, 0, len(s.columns))
+	for i, c := range s.columns {
+		selected = append(selected, ast.SelectColumn{Expr: &ast.ColumnRef{Table: s.tables[i], Name: c}})
+	}
+	return selected
+}
+
+// Resolve returns the position of the referred column in rows.
+func (s scope) resolve(c *ast.ColumnRef) (int, error) {
+	found := -1
+	for i, n := range s.columns {
+		if n != c.Name || (c.Table != "" && c.Table != s.tables[i]) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("%w: %s", ErrColumnAmbiguous, c.Name)
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("%w: %s", ErrColumnNamesNotMatched, c.Name)
+	}
+	return found, nil
+}
+
+// Check checks if all columns referred by expression are in the scope and
+// all functions are callable, so the errors can be reported even if there
+// isn't any row to evaluate.
+func (s scope) check(e ast.Expr) error {
+	var err error
+	ast.Walk(e, func(e ast.Expr) bool {
+		switch e := e.(type) {
+		case *ast.ColumnRef:
+			_, err = s.resolve(e)
+		case *ast.FuncCall:
+			err = checkFunc(e)
+		case *ast.Param:
+			err = fmt.Errorf("%w: $%d", ErrParamNotBound, e.Index)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// Kind returns the column kind of the value of expression.
+func (s scope) kind(e ast.Expr) ast.ColumnKind {
+	switch e := e.(type) {
+	case *ast.ColumnRef:
+		if i, err := s.resolve(e); err == nil {
+			return s.kinds[i]
+		}
+	case *ast.Literal:
+		switch v, _ := literal(e); v.(type) {
+		case int64:
+			return ast.ColumnKindInt
+		case float64:
+			return ast.ColumnKindFloat
+		case string:
+			return ast.ColumnKindText
+		}
+	case *ast.FuncCall:
+		switch e.Name {
+		case "count", "row_number", "rank", "dense_rank":
+			return ast.ColumnKindInt
+		case "avg":
+			return ast.ColumnKindFloat
+		case "sum", "min", "max", "lag", "lead", "first_value":
+			if len(e.Args) > 0 {
+				return s.kind(e.Args[0])
+			}
+		}
+		if fn, ok := scalars[e.Name]; ok {
+			return fn.kind(s.argKinds(e.Args))
+		}
+	case *ast.BinaryExpr:
+		if e.Op == ast.BinaryOpConcat {
+			return ast.ColumnKindText
+		}
+		left, right := s.kind(e.Left), s.kind(e.Right)
+		switch {
+		case left == ast.ColumnKindFloat || right == ast.ColumnKindFloat:
+			return ast.ColumnKindFloat
+		case left == ast.ColumnKindInt && right == ast.ColumnKindInt:
+			return ast.ColumnKindInt
+		}
+	case *ast.NegExpr:
+		return s.kind(e.Expr)
+	case *ast.SubqueryExpr:
+		return subqueryKind(e.Query)
+	case *ast.CaseExpr:
+		results := make([]ast.Expr, 0, len(e.Whens)+1)
+		for _, w := range e.Whens {
+			results = append(results, w.Result)
+		}
+		return firstKind(s.argKinds(append(results, e.Else)))
+	}
+	return ast.ColumnKindUnknown
+}
+
+// ArgKinds returns the column kinds of the values of expressions.
+func (s scope) argKinds(exprs []ast.Expr) []ast.ColumnKind {
+	kinds := make([]ast.ColumnKind, 0, len(exprs))
+	for _, e := range exprs {
+		kinds = append(kinds, s.kind(e))
+	}
+	return kinds
+}
+
+// ColumnName returns the name of output column c, it's the alias of c, or
+// the name of column or function, otherwise ?column? like PostgreSQL.
+func columnName(c ast.SelectColumn) ast.ColumnName {
+	if c.Alias != "" {
+		return ast.ColumnName(c.Alias)
+	}
+	switch e := c.Expr.(type) {
+	case *ast.ColumnRef:
+		return e.Name
+	case *ast.FuncCall:
+		return ast.ColumnName(e.Name)
+	case *ast.CaseExpr:
+		return "case"
+	case *ast.ExistsExpr:
+		return "exists"
+	case *ast.SubqueryExpr:
+		return subqueryColumnName(e.Query)
+	}
+	return "?column?"
+}
+
+// Test tests if row r meets condition, nil condition is always met, and the
+// condition is not met if its result is unknown.
+func (s scope) test(cond ast.Expr, r Row) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+	v, err := s.evalBool(cond, r, "WHERE")
+	if err != nil {
+		return false, err
+	}
+	// unknown is not met
+	b, _ := v.(bool)
+	return b, nil
+}
+
+// Eval evaluates expression with fields of row r, the result is Field for
+// columns and literals, or bool for conditions.
+func (s scope) eval(e ast.Expr, r Row) (interface{}, error) {
+	switch e := e.(type) {
+	case *ast.ColumnRef:
+		i, err := s.resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		return r[i], nil
+	case *ast.Literal:
+		return literal(e)
+	case *ast.Param:
+		// parameters are replaced with their values before evaluating
+		return nil, fmt.Errorf("%w: $%d", ErrParamNotBound, e.Index)
+	case *ast.CmpExpr:
+		return s.evalCmp(e, r)
+	case *ast.LogicExpr:
+		return s.evalLogic(e, r)
+	case *ast.NotExpr:
+		v, err := s.evalBool(e.Expr, r, "NOT")
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return !v.(bool), nil
+	case *ast.IsNullExpr:
+		v, err := s.eval(e.Expr, r)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.Not, nil
+	case *ast.FuncCall:
+		// aggregates and window functions are replaced with their results
+		// before evaluating
+		return s.evalFunc(e, r)
+	case *ast.BinaryExpr:
+		return s.evalBinary(e, r)
+	case *ast.NegExpr:
+		v, err := s.eval(e.Expr, r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		v, err = arithmetic(ast.BinaryOpSub, int64(0), v)
+		if err != nil || !s.isInt32(e) {
+			return v, err
+		}
+		return checkInt32(v)
+	case *ast.CaseExpr:
+		return s.evalCase(e, r)
+	case *ast.LikeExpr:
+		return s.evalLike(e, r)
+	case *ast.InExpr:
+		return s.evalIn(e, r)
+	case *ast.BetweenExpr:
+		return s.evalBetween(e, r)
+	case *ast.SubqueryExpr:
+		return s.evalSubquery(e, r)
+	case *ast.ExistsExpr:
+		return s.evalExists(e, r)
+	}
+	return nil, fmt.Errorf("%w: %T", ErrExprTypesMismatch, e)
+}
+
+// EvalBool evaluates condition, the result is bool or nil if it's unknown,
+// like comparing with NULL.
+func (s scope) evalBool(e ast.Expr, r Row, op string) (interface{}, error) {
+	v, err := s.eval(e, r)
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case bool, nil:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrExprNotBoolean, op)
+}
+
+// EvalLogic evaluates AND and OR with three-valued logic, false AND unknown
+// is false, true OR unknown is true, otherwise the result with unknown is
+// unknown.
+func (s scope) evalLogic(e *ast.LogicExpr, r Row) (interface{}, error) {
+	op := "AND"
+	if e.Op == ast.LogicOpOr {
+		op = "OR"
+	}
+	// the result is decided by false for AND and true for OR
+	decided := e.Op == ast.LogicOpOr
+	left, err := s.evalBool(e.Left, r, op)
+	if err != nil {
+		return nil, err
+	}
+	if left == decided {
+		return left, nil
+	}
+	right, err := s.evalBool(e.Right, r, op)
+	if err != nil {
+		return nil, err
+	}
+	if right == decided {
+		return right, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return right, nil
+}
+
+func (s scope) evalCmp(e *ast.CmpExpr, r Row) (interface{}, error) {
+	left, err := s.eval(e.Left, r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.eval(e.Right, r)
+	if err != nil {
+		return nil, err
+	}
+	// comparing with NULL is unknown
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	c, err := compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Cmp {
+	case ast.CmpKindEq:
+		return c == 0, nil
+	case ast.CmpKindNotEq:
+		return c != 0, nil
+	case ast.CmpKindGt:
+		return c > 0, nil
+	case ast.CmpKindGte:
+		return c >= 0, nil
+	case ast.CmpKindLt:
+		return c < 0, nil
+	case ast.CmpKindLte:
+		return c <= 0, nil
+	}
+	return false, nil
+}
+
+// EvalBinary evaluates arithmetic operators and concatenation, the result is
+// NULL if any operand is NULL.
+func (s scope) evalBinary(e *ast.BinaryExpr, r Row) (interface{}, error) {
+	left, err := s.eval(e.Left, r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.eval(e.Right, r)
+	if err != nil || left == nil || right == nil {
+		return nil, err
+	}
+	if e.Op == ast.BinaryOpConcat {
+		return formatField(left) + formatField(right), nil
+	}
+	v, err := arithmetic(e.Op, left, right)
+	if err != nil || !s.isInt32(e) {
+		return v, err
+	}
+	return checkInt32(v)
+}
+
+// IsInt32 tests if the value of expression e is 32-bit integer like values
+// of INT columns, whose arithmetic fails out of int32 range as PostgreSQL
+// integer does. Integer literals out of the range and the results of
+// functions like count are wider, their arithmetic only fails out of int64.
+func (s scope) isInt32(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.ColumnRef:
+		return s.kind(e) == ast.ColumnKindInt
+	case *ast.Literal:
+		v, _ := literal(e)
+		i, ok := v.(int64)
+		return ok && i >= math.MinInt32 && i <= math.MaxInt32
+	case *ast.NegExpr:
+		return s.isInt32(e.Expr)
+	case *ast.BinaryExpr:
+		return e.Op != ast.BinaryOpConcat && s.isInt32(e.Left) && s.isInt32(e.Right)
+	}
+	return false
+}
+
+// CheckInt32 checks if the integer v is in int32 range, other values are
+// returned as is.
+func checkInt32(v interface{}) (interface{}, error) {
+	if i, ok := v.(int64); ok && (i < math.MinInt32 || i > math.MaxInt32) {
+		return nil, ErrIntOutOfRange
+	}
+	return v, nil
+}
+
+// Arithmetic computes a op b, the result is integer if both are integers,
+// otherwise float. Strings are converted to numbers like comparing.
+func arithmetic(op ast.BinaryOp, a, b interface{}) (interface{}, error) {
+	x, err := numeric(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := numeric(b)
+	if err != nil {
+		return nil, err
+	}
+	if (op == ast.BinaryOpDiv || op == ast.BinaryOpMod) && (y == int64(0) || y == float64(0)) {
+		return nil, ErrDivisionByZero
+	}
+	i, ok1 := x.(int64)
+	j, ok2 := y.(int64)
+	if ok1 && ok2 {
+		r, err := intArithmetic(op, i, j)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	m, _ := number(x)
+	n, _ := number(y)
+	switch op {
+	case ast.BinaryOpAdd:
+		return m + n, nil
+	case ast.BinaryOpSub:
+		return m - n, nil
+	case ast.BinaryOpMul:
+		return m * n, nil
+	case ast.BinaryOpDiv:
+		return m / n, nil
+	}
+	return math.Mod(m, n), nil
+}
+
+// IntArithmetic computes i op j of integers, it fails instead of wrapping
+// around if the result overflows int64.
+func intArithmetic(op ast.BinaryOp, i, j int64) (int64, error) {
+	var r int64
+	overflowed := false
+	switch op {
+	case ast.BinaryOpAdd:
+		r = i + j
+		overflowed = (j > 0 && r < i) || (j < 0 && r > i)
+	case ast.BinaryOpSub:
+		r = i - j
+		overflowed = (j > 0 && r > i) || (j < 0 && r < i)
+	case ast.BinaryOpMul:
+		r = i * j
+		overflowed = i != 0 && (r/i != j || (i == -1 && j == math.MinInt64))
+	case ast.BinaryOpDiv:
+		r = i / j
+		overflowed = i == math.MinInt64 && j == -1
+	default:
+		r = i % j
+	}
+	if overflowed {
+		return 0, ErrIntOutOfRange
+	}
+	return r, nil
+}
+
+// Numeric converts v to int64 or float64, strings are integers if they can
+// be parsed as integers.
+func numeric(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int64, float64:
+		return v, nil
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return number(v)
+}
+
+// EvalCase evaluates the result of the first met WHEN clause, WHEN clause of
+// simple CASE is met if its value equals to operand.
+func (s scope) evalCase(e *ast.CaseExpr, r Row) (interface{}, error) {
+	var operand interface{}
+	if e.Operand != nil {
+		var err error
+		if operand, err = s.eval(e.Operand, r); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range e.Whens {
+		met := false
+		if e.Operand == nil {
+			v, err := s.evalBool(w.Cond, r, "CASE")
+			if err != nil {
+				return nil, err
+			}
+			met = v == true
+		} else {
+			v, err := s.eval(w.Cond, r)
+			if err != nil {
+				return nil, err
+			}
+			if operand != nil && v != nil {
+				c, err := compare(operand, v)
+				if err != nil {
+					return nil, err
+				}
+				met = c == 0
+			}
+		}
+		if met {
+			return s.eval(w.Result, r)
+		}
+	}
+	if e.Else == nil {
+		return nil, nil
+	}
+	return s.eval(e.Else, r)
+}
+
+// Literal returns the typed value of literal, numbers are int64 if they are
+// integers, otherwise float64, and NULL is nil.
+func literal(e *ast.Literal) (Field, error) {
+	switch e.Kind {
+	case ast.LiteralKindNull:
+		return nil, nil
+	case ast.LiteralKindString:
+		return e.Value, nil
+	}
+	if i, err := strconv.ParseInt(e.Value, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(e.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: \"%s\"", ErrIntInvalid, e.Value)
+	}
+	return f, nil
+}
+
+// Compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// Numbers are compared numerically and strings lexicographically, a string
+// compared with number must be a valid number too, like '18' and 18.
+func compare(a, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case int64, float64:
+		n, err := number(b)
+		if err != nil {
+			return 0, err
+		}
+		m, _ := number(a)
+		return compareNumber(m, n), nil
+	case string:
+		switch b := b.(type) {
+		case string:
+			return strings.Compare(a, b), nil
+		case int64, float64:
+			m, err := number(a)
+			if err != nil {
+				return 0, err
+			}
+			n, _ := number(b)
+			return compareNumber(m, n), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case !a:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %T and %T", ErrExprTypesMismatch, a, b)
+}
+
+// Number converts v to float64 for comparing numerically.
+func number(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: \"%s\"", ErrIntInvalid, v)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("%w: %T and number", ErrExprTypesMismatch, v)
+}
+
+func compareNumber(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
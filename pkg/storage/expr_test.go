@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestScopeTest(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testexpr1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "city", Kind: ast.ColumnKindText},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", "beijing"}
+	name := &ast.ColumnRef{Name: "name"}
+	city := &ast.ColumnRef{Table: "testexpr1", Name: "city"}
+	wang := &ast.Literal{Kind: ast.LiteralKindString, Value: "wang"}
+	eq := &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: name, Right: wang}
+	lt := &ast.CmpExpr{Cmp: ast.CmpKindLt, Left: city, Right: name}
+
+	tests := []struct {
+		cond ast.Expr
+		ok   bool
+	}{
+		{nil, true},
+		{eq, true},
+		{&ast.CmpExpr{Cmp: ast.CmpKindEq, Left: wang, Right: name}, true},
+		{lt, true},
+		{&ast.NotExpr{Expr: eq}, false},
+		{&ast.LogicExpr{Op: ast.LogicOpAnd, Left: eq, Right: &ast.NotExpr{Expr: lt}}, false},
+		{&ast.LogicExpr{Op: ast.LogicOpOr, Left: &ast.NotExpr{Expr: eq}, Right: lt}, true},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		ok, err := s.test(tt.cond, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("test %d should be %v, but got %v", i, tt.ok, ok)
+		}
+	}
+}
+
+func TestScopeTestFailed(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name:    "testexpr2",
+		Columns: []ast.Column{{Name: "name", Kind: ast.ColumnKindText}},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang"}
+	name := &ast.ColumnRef{Name: "name"}
+
+	tests := []ast.Expr{
+		name,
+		&ast.ColumnRef{Name: "age"},
+		&ast.ColumnRef{Table: "other", Name: "name"},
+		&ast.NotExpr{Expr: name},
+		&ast.LogicExpr{Op: ast.LogicOpAnd, Left: name, Right: name},
+	}
+
+	// WHEN
+	for i, cond := range tests {
+		_, err := s.test(cond, row)
+
+		// THEN
+		if err == nil {
+			t.Errorf("test %d should fail, but err is nil", i)
+		}
+	}
+}
+
+func TestScopeTestNumeric(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testexpr3",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", int64(10)}
+	age := &ast.ColumnRef{Name: "age"}
+	number := func(v string) ast.Expr {
+		return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v}
+	}
+	str := func(v string) ast.Expr {
+		return &ast.Literal{Kind: ast.LiteralKindString, Value: v}
+	}
+
+	tests := []struct {
+		cond ast.Expr
+		ok   bool
+	}{
+		{&ast.CmpExpr{Cmp: ast.CmpKindGt, Left: age, Right: number("9")}, true},
+		{&ast.CmpExpr{Cmp: ast.CmpKindLt, Left: age, Right: number("100")}, true},
+		{&ast.CmpExpr{Cmp: ast.CmpKindEq, Left: age, Right: number("10.0")}, true},
+		{&ast.CmpExpr{Cmp: ast.CmpKindGte, Left: age, Right: number("10.5")}, false},
+		{&ast.CmpExpr{Cmp: ast.CmpKindEq, Left: age, Right: str("10")}, true},
+		{&ast.CmpExpr{Cmp: ast.CmpKindLt, Left: number("-1"), Right: age}, true},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		ok, err := s.test(tt.cond, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("test %d should be %v, but got %v", i, tt.ok, ok)
+		}
+	}
+
+	// WHEN, compares integer with text which isn't a number
+	cond := &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: age, Right: str("ten")}
+	_, err := s.test(cond, row)
+
+	// THEN
+	if !errors.Is(err, ErrIntInvalid) {
+		t.Errorf("comparing integer with text should fail, but got %v", err)
+	}
+}
+
+func TestScopeEvalNull(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testexpr4",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", nil}
+	age := &ast.ColumnRef{Name: "age"}
+	null := &ast.Literal{Kind: ast.LiteralKindNull}
+	unknown := &ast.CmpExpr{Cmp: ast.CmpKindGt, Left: age, Right: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "1"}}
+	named := &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: &ast.ColumnRef{Name: "name"}, Right: &ast.Literal{Kind: ast.LiteralKindString, Value: "wang"}}
+
+	tests := []struct {
+		e     ast.Expr
+		value interface{}
+	}{
+		{null, nil},
+		{unknown, nil},
+		{&ast.CmpExpr{Cmp: ast.CmpKindEq, Left: null, Right: null}, nil},
+		{&ast.NotExpr{Expr: unknown}, nil},
+		{&ast.LogicExpr{Op: ast.LogicOpAnd, Left: unknown, Right: named}, nil},
+		{&ast.LogicExpr{Op: ast.LogicOpAnd, Left: unknown, Right: &ast.NotExpr{Expr: named}}, false},
+		{&ast.LogicExpr{Op: ast.LogicOpOr, Left: unknown, Right: named}, true},
+		{&ast.IsNullExpr{Expr: age}, true},
+		{&ast.IsNullExpr{Expr: age, Not: true}, false},
+		{&ast.IsNullExpr{Expr: unknown}, true},
+		{&ast.IsNullExpr{Expr: named, Not: true}, true},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		v, err := s.eval(tt.e, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+		}
+		if v != tt.value {
+			t.Errorf("test %d should be %v, but got %v", i, tt.value, v)
+		}
+	}
+}
+
+func TestScopeEvalExprs(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testexpr5",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+			{Name: "city", Kind: ast.ColumnKindText},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", int64(18), nil}
+
+	tests := []struct {
+		source string
+		value  interface{}
+		kind   ast.ColumnKind
+	}{
+		{"age + 2 * 3", int64(24), ast.ColumnKindInt},
+		{"(age + 2) * 3", int64(60), ast.ColumnKindInt},
+		{"age / 4 + age % 4", int64(6), ast.ColumnKindInt},
+		{"age / 4.0", 4.5, ast.ColumnKindFloat},
+		{"-age - -1", int64(-17), ast.ColumnKindInt},
+		{"'1' + age", int64(19), ast.ColumnKindUnknown},
+		{"age + city", nil, ast.ColumnKindUnknown},
+		{"name || ' ' || age", "wang 18", ast.ColumnKindText},
+		{"name || city", nil, ast.ColumnKindText},
+		{"age + 1 > 18 and name || 'x' = 'wangx'", true, ast.ColumnKindUnknown},
+		{"case when age < 18 then 'minor' when age < 60 then 'adult' else 'senior' end", "adult", ast.ColumnKindText},
+		{"case age when 17 then 'a' when 18 then 'b' end", "b", ast.ColumnKindText},
+		{"case city when 'x' then 'a' end", nil, ast.ColumnKindText},
+		{"case when city = 'x' then 1 else age end", int64(18), ast.ColumnKindInt},
+		// integer literals out of int32 range are wider than INT
+		{"age + 2147483648", int64(2147483666), ast.ColumnKindInt},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		e, err := parser.ParseExpr(tt.source)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.source, err)
+		}
+		v, err := s.eval(e, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d: eval %q failed: %v", i, tt.source, err)
+		}
+		if v != tt.value {
+			t.Errorf("test %d: %q should be %v, but got %v", i, tt.source, tt.value, v)
+		}
+		if k := s.kind(e); k != tt.kind {
+			t.Errorf("test %d: kind of %q should be %v, but got %v", i, tt.source, tt.kind, k)
+		}
+	}
+}
+
+func TestScopeEvalExprsFailed(t *testing.T) {
+	// GIVEN
+	table := Table{Name: "testexpr6", Columns: []ast.Column{{Name: "name", Kind: ast.ColumnKindText}, {Name: "age", Kind: ast.ColumnKindInt}}}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", int64(18)}
+
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{"age / 0", ErrDivisionByZero},
+		{"age % (age - 18)", ErrDivisionByZero},
+		{"name + 1", ErrIntInvalid},
+		{"-name", ErrIntInvalid},
+		{"case when age then 1 end", ErrExprNotBoolean},
+		// integers never wrap around on overflow
+		{"age * 9223372036854775807", ErrIntOutOfRange},
+		{"9223372036854775807 + age", ErrIntOutOfRange},
+		{"-9223372036854775807 - age", ErrIntOutOfRange},
+		{"(-9223372036854775807 - 1) / -1", ErrIntOutOfRange},
+		{"-(-9223372036854775807 - 1)", ErrIntOutOfRange},
+		// INT is 32-bit
+		{"age + 2147483647", ErrIntOutOfRange},
+		{"age * 200000000", ErrIntOutOfRange},
+		{"-(-age - 2147483630)", ErrIntOutOfRange},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		e, err := parser.ParseExpr(tt.source)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.source, err)
+		}
+		_, err = s.eval(e, row)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d: %q should fail with %v, but got %v", i, tt.source, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrIntInvalid    = errors.New("invalid input syntax for type integer")
+	ErrIntOutOfRange = errors.New("integer out of range")
+)
+
+// Field is the typed value of a column in row, it's int64 for INT column and
+// string for TEXT column, and nil for NULL.
+type Field interface{}
+
+// ParseField parses the literal value v to field for column with kind k, the
+// value is validated by kind, so INT column only accepts integers. The text
+// is kept as it is, including its case and quotes.
+func parseField(k ast.ColumnKind, v string) (Field, error) {
+	if k != ast.ColumnKindInt {
+		return v, nil
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%w: %s", ErrIntOutOfRange, v)
+		}
+		return nil, fmt.Errorf("%w: \"%s\"", ErrIntInvalid, v)
+	}
+	// INT column is stored as Avro int which has 32 bits
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %s", ErrIntOutOfRange, v)
+	}
+	return i, nil
+}
+
+// DefaultField returns the DEFAULT value of column c, or NULL if c has no
+// default. It's used for the columns omitted by INSERT and the rows saved
+// before c is added.
+func defaultField(c ast.Column) Field {
+	if c.Default == nil {
+		return nil
+	}
+	f, err := valueField(c.Kind, c.Default)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// FieldLiteral returns the literal of field f, which is used to set values
+// of the rows referencing f.
+func fieldLiteral(f Field) ast.Expr {
+	switch f := f.(type) {
+	case nil:
+		return &ast.Literal{Kind: ast.LiteralKindNull}
+	case string:
+		return &ast.Literal{Kind: ast.LiteralKindString, Value: f}
+	}
+	return &ast.Literal{Kind: ast.LiteralKindNumber, Value: formatField(f)}
+}
+
+// ValueField evaluates the value expression of INSERT or DEFAULT, which
+// doesn't refer to any column, and converts it to the field of kind k.
+func valueField(k ast.ColumnKind, e ast.Expr) (Field, error) {
+	return scope{}.field(k, e, nil)
+}
+
+// Field evaluates the value expression with row r and converts it to the
+// field of column with kind k. The literals are parsed by kind, so '18' is
+// accepted by INT column as PostgreSQL does.
+func (s scope) field(k ast.ColumnKind, e ast.Expr, r Row) (Field, error) {
+	if l, ok := e.(*ast.Literal); ok && l.Kind != ast.LiteralKindNull {
+		return parseField(k, l.Value)
+	}
+	v, err := s.eval(e, r)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return parseField(k, v)
+	case int64, float64:
+		return parseField(k, formatField(v))
+	}
+	return nil, fmt.Errorf("%w: %T", ErrExprTypesMismatch, v)
+}
+
+// IndexKey returns the key of field in indexes. As keys are compared as
+// strings, integers are shifted to be non-negative and padded with zeros,
+// so that the order of keys is the same as the order of numbers.
+func indexKey(f Field) string {
+	switch f := f.(type) {
+	case int64:
+		return fmt.Sprintf("%020d", uint64(f)^(1<<63))
+	case string:
+		return f
+	}
+	return fmt.Sprint(f)
+}
+
+// FormatField returns the text of field for showing, NULL is shown as empty
+// like psql.
+func formatField(f Field) string {
+	if f == nil {
+		return ""
+	}
+	return fmt.Sprint(f)
+}
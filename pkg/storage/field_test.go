@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		kind  ast.ColumnKind
+		value string
+		field Field
+		err   error
+	}{
+		{ast.ColumnKindText, "Walker", "Walker", nil},
+		{ast.ColumnKindText, "O'Brien", "O'Brien", nil},
+		{ast.ColumnKindText, "\"wang\"", "\"wang\"", nil},
+		{ast.ColumnKindText, "18", "18", nil},
+		{ast.ColumnKindInt, "18", int64(18), nil},
+		{ast.ColumnKindInt, "-2147483648", int64(-2147483648), nil},
+		{ast.ColumnKindInt, "2147483648", nil, ErrIntOutOfRange},
+		{ast.ColumnKindInt, "99999999999999999999", nil, ErrIntOutOfRange},
+		{ast.ColumnKindInt, "'wang'", nil, ErrIntInvalid},
+		{ast.ColumnKindInt, "1.5", nil, ErrIntInvalid},
+		{ast.ColumnKindInt, "", nil, ErrIntInvalid},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		f, err := parseField(tt.kind, tt.value)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should fail with %v, but got %v", i, tt.err, err)
+		}
+		if f != tt.field {
+			t.Errorf("test %d should be %v, but got %v", i, tt.field, f)
+		}
+	}
+}
+
+func TestIndexKeyKeepsOrder(t *testing.T) {
+	// GIVEN
+	numbers := []int64{-2147483648, -100, -9, 0, 9, 10, 100, 2147483647}
+
+	// WHEN
+	for i := 1; i < len(numbers); i++ {
+		a, b := indexKey(numbers[i-1]), indexKey(numbers[i])
+
+		// THEN
+		if a >= b {
+			t.Errorf("key of %d should be less than key of %d, but got %s and %s", numbers[i-1], numbers[i], a, b)
+		}
+	}
+}
+
+func TestValueField(t *testing.T) {
+	tests := []struct {
+		kind  ast.ColumnKind
+		value ast.Expr
+		field Field
+		err   error
+	}{
+		{ast.ColumnKindInt, &ast.Literal{Kind: ast.LiteralKindNull}, nil, nil},
+		{ast.ColumnKindText, &ast.Literal{Kind: ast.LiteralKindNull}, nil, nil},
+		{ast.ColumnKindInt, &ast.Literal{Kind: ast.LiteralKindString, Value: "18"}, int64(18), nil},
+		{ast.ColumnKindText, &ast.Literal{Kind: ast.LiteralKindNumber, Value: "18"}, "18", nil},
+		{ast.ColumnKindInt, &ast.Literal{Kind: ast.LiteralKindNumber, Value: "2147483648"}, nil, ErrIntOutOfRange},
+		{ast.ColumnKindInt, &ast.ColumnRef{Name: "age"}, nil, ErrColumnNamesNotMatched},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		f, err := valueField(tt.kind, tt.value)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should fail with %v, but got %v", i, tt.err, err)
+		}
+		if f != tt.field {
+			t.Errorf("test %d should get %v, but got %v", i, tt.field, f)
+		}
+	}
+	if s := formatField(nil); s != "" {
+		t.Errorf("NULL should be shown as empty, but got %q", s)
+	}
+}
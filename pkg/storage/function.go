@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var ErrSubstringNegative = errors.New("negative substring length not allowed")
+
+// ScalarFunc is the built-in function which computes one value from the
+// arguments of a row, it accepts minArgs to maxArgs arguments, and maxArgs
+// is -1 if the arguments are unlimited. The result of a strict function is
+// NULL if any argument is NULL, and call is never called with NULLs.
+type scalarFunc struct {
+	minArgs int
+	maxArgs int
+	strict  bool
+	call    func(args []Field) (Field, error)
+	// kind returns the kind of result by the kinds of arguments
+	kind func(kinds []ast.ColumnKind) ast.ColumnKind
+}
+
+// The built-in scalar functions by name.
+var scalars = map[string]scalarFunc{
+	"upper":    {minArgs: 1, maxArgs: 1, strict: true, call: upper, kind: textKind},
+	"lower":    {minArgs: 1, maxArgs: 1, strict: true, call: lower, kind: textKind},
+	"length":   {minArgs: 1, maxArgs: 1, strict: true, call: length, kind: intKind},
+	"substr":   {minArgs: 2, maxArgs: 3, strict: true, call: substr, kind: textKind},
+	"abs":      {minArgs: 1, maxArgs: 1, strict: true, call: abs, kind: firstKind},
+	"coalesce": {minArgs: 1, maxArgs: -1, call: coalesce, kind: firstKind},
+	"nullif":   {minArgs: 2, maxArgs: 2, call: nullif, kind: firstKind},
+}
+
+// EvalFunc evaluates the arguments of scalar function f with row r, and
+// calls f with their values.
+func (s scope) evalFunc(f *ast.FuncCall, r Row) (interface{}, error) {
+	if err := checkFunc(f); err != nil {
+		return nil, err
+	}
+	fn := scalars[f.Name]
+	args := make([]Field, 0, len(f.Args))
+	for _, a := range f.Args {
+		v, err := s.eval(a, r)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && fn.strict {
+			return nil, nil
+		}
+		args = append(args, v)
+	}
+	v, err := fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, f.Name)
+	}
+	return v, nil
+}
+
+func textKind([]ast.ColumnKind) ast.ColumnKind { return ast.ColumnKindText }
+
+func intKind([]ast.ColumnKind) ast.ColumnKind { return ast.ColumnKindInt }
+
+// FirstKind returns the first known kind of arguments.
+func firstKind(kinds []ast.ColumnKind) ast.ColumnKind {
+	for _, k := range kinds {
+		if k != ast.ColumnKindUnknown {
+			return k
+		}
+	}
+	return ast.ColumnKindUnknown
+}
+
+// Text returns the string of v, which must be text.
+func text(v Field) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %T", ErrFuncArgsInvalid, v)
+	}
+	return s, nil
+}
+
+// Integer returns the integer of v, which must be integer.
+func integer(v Field) (int64, error) {
+	i, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: %T", ErrFuncArgsInvalid, v)
+	}
+	return i, nil
+}
+
+func upper(args []Field) (Field, error) {
+	s, err := text(args[0])
+	return strings.ToUpper(s), err
+}
+
+func lower(args []Field) (Field, error) {
+	s, err := text(args[0])
+	return strings.ToLower(s), err
+}
+
+// Length returns the number of characters instead of bytes.
+func length(args []Field) (Field, error) {
+	s, err := text(args[0])
+	return int64(utf8.RuneCountInString(s)), err
+}
+
+// Substr returns count characters of string from start, which starts from 1
+// and could be out of the string. All characters after start are returned if
+// count is omitted.
+func substr(args []Field) (Field, error) {
+	s, err := text(args[0])
+	if err != nil {
+		return nil, err
+	}
+	start, err := integer(args[1])
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	begin, end := start-1, int64(len(runes))
+	if len(args) == 3 {
+		count, err := integer(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, ErrSubstringNegative
+		}
+		end = begin + count
+	}
+	begin = clamp(begin, 0, int64(len(runes)))
+	end = clamp(end, begin, int64(len(runes)))
+	return string(runes[begin:end]), nil
+}
+
+func clamp(v, min, max int64) int64 {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	}
+	return v
+}
+
+func abs(args []Field) (Field, error) {
+	switch v := args[0].(type) {
+	case int64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case float64:
+		return math.Abs(v), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrFuncArgsInvalid, args[0])
+}
+
+// Coalesce returns the first argument which isn't NULL.
+func coalesce(args []Field) (Field, error) {
+	for _, v := range args {
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// Nullif returns NULL if the arguments are equal, otherwise the first one.
+func nullif(args []Field) (Field, error) {
+	if args[0] == nil || args[1] == nil {
+		return args[0], nil
+	}
+	c, err := compare(args[0], args[1])
+	if err != nil || c == 0 {
+		return nil, err
+	}
+	return args[0], nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestScalarFunctions(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testfunc1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+			{Name: "city", Kind: ast.ColumnKindText},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"Wang Walker", int64(-18), nil}
+
+	tests := []struct {
+		source string
+		value  interface{}
+		kind   ast.ColumnKind
+	}{
+		{"upper(name)", "WANG WALKER", ast.ColumnKindText},
+		{"lower(name)", "wang walker", ast.ColumnKindText},
+		{"upper(city)", nil, ast.ColumnKindText},
+		{"length(name)", int64(11), ast.ColumnKindInt},
+		{"length('北京')", int64(2), ast.ColumnKindInt},
+		{"substr(name, 6)", "Walker", ast.ColumnKindText},
+		{"substr(name, 1, 4)", "Wang", ast.ColumnKindText},
+		{"substr(name, -1, 3)", "W", ast.ColumnKindText},
+		{"substr(name, 20)", "", ast.ColumnKindText},
+		{"substr(name, age)", "Wang Walker", ast.ColumnKindText},
+		{"abs(age)", int64(18), ast.ColumnKindInt},
+		{"abs(-1.5)", 1.5, ast.ColumnKindFloat},
+		{"coalesce(city, name)", "Wang Walker", ast.ColumnKindText},
+		{"coalesce(city, NULL)", nil, ast.ColumnKindText},
+		{"nullif(age, -18)", nil, ast.ColumnKindInt},
+		{"nullif(age, 18)", int64(-18), ast.ColumnKindInt},
+		{"upper(substr(name, 1, 1)) || lower(substr(name, 2))", "Wang walker", ast.ColumnKindText},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		e, err := parser.ParseExpr(tt.source)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.source, err)
+		}
+		v, err := s.eval(e, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d: eval %q failed: %v", i, tt.source, err)
+		}
+		if v != tt.value {
+			t.Errorf("test %d: %q should be %v, but got %v", i, tt.source, tt.value, v)
+		}
+		if k := s.kind(e); k != tt.kind {
+			t.Errorf("test %d: kind of %q should be %v, but got %v", i, tt.source, tt.kind, k)
+		}
+	}
+}
+
+func TestScalarFunctionsFailed(t *testing.T) {
+	// GIVEN
+	table := Table{Name: "testfunc2", Columns: []ast.Column{{Name: "name", Kind: ast.ColumnKindText}, {Name: "age", Kind: ast.ColumnKindInt}}}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"wang", int64(18)}
+
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{"upper(age)", ErrFuncArgsInvalid},
+		{"upper(name, name)", ErrFuncArgsInvalid},
+		{"upper(*)", ErrFuncArgsInvalid},
+		{"substr(name)", ErrFuncArgsInvalid},
+		{"substr(name, '1')", ErrFuncArgsInvalid},
+		{"substr(name, 1, -1)", ErrSubstringNegative},
+		{"abs(name)", ErrFuncArgsInvalid},
+		{"reverse(name)", ErrFuncNotExisted},
+		{"upper(count(*))", ErrAggregateMisplaced},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		e, err := parser.ParseExpr(tt.source)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.source, err)
+		}
+		_, err = s.eval(e, row)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d: %q should fail with %v, but got %v", i, tt.source, tt.err, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 
 	"github.com/wangwalker/gpostgres/pkg/ds"
@@ -58,14 +59,15 @@ func dir(t indexType, tn string) string {
 }
 
 // path returns the path of the index file for c column of tn table, t is the
-// index type, could be btree or lsmtree.
+// index type, could be btree or lsmtree. The column name is escaped as quoted
+// names could contain path separators.
 func path(t indexType, tn, cn string) string {
 	dir := dir(t, tn)
 	_, err := os.Stat(dir)
 	if os.IsNotExist(err) {
 		os.MkdirAll(dir, 0755)
 	}
-	return fmt.Sprintf("%s/%s.index", dir, cn)
+	return fmt.Sprintf("%s/%s.index", dir, url.PathEscape(cn))
 }
 
 // getBtree gets the btree index of a column with the column name.
@@ -99,16 +101,37 @@ func (index *Index) insert(c, n string, offset, length, p, b uint16) {
 	}
 }
 
+// Delete deletes a key from the B-tree and lsmtree, the parameters have the
+// same meaning with insert. As lsmtree keeps only one data for a key, if
+// there are other rows with the same value, the key is pointed to one of them.
+func (index *Index) delete(c, n string, offset, length, p, b uint16) {
+	d := ds.IndexData{Offset: offset, Length: length, Page: p, Block: b}
+	btree := index.getBtree(c)
+	if btree != nil {
+		btree.Delete(ds.BtreeKey{Name: n, Data: d})
+	}
+	lsmtree := index.getLsmTree(c)
+	if lsmtree != nil && lsmtree.Search(n) == d {
+		lsmtree.Delete(n)
+		if btree == nil {
+			return
+		}
+		if k := btree.Search(n); !k.IsEmpty() {
+			lsmtree.Insert(n, k.Data)
+		}
+	}
+}
+
 // Search searches a key in the B-tree index, f is the indexed field of a row.
 // If the key is not found, it returns empty, otherwise it returns index data.
 func (index *Index) search(c string, f Field) ds.IndexData {
 	btree := index.getBtree(c)
 	if btree != nil {
-		return btree.Search(string(f)).Data
+		return btree.Search(indexKey(f)).Data
 	}
 	lsmt := index.getLsmTree(c)
 	if lsmt != nil {
-		return lsmt.Search(string(f))
+		return lsmt.Search(indexKey(f))
 	}
 	return ds.IndexData{}
 }
@@ -133,3 +156,33 @@ func (t *Table) loadIndex() {
 		}
 	}
 }
+
+// Reindex rebuilds the indexes of all columns from the saved rows, the old
+// index files of the table are removed first.
+func (t *Table) reindex() {
+	t.removeIndex()
+	t.createIndex()
+	for i, r := range t.Rows {
+		// rows which haven't been saved have no location
+		if i >= len(t.locations) {
+			break
+		}
+		l := t.locations[i]
+		record := t.convert(r)
+		for j, c := range t.Columns {
+			// NULLs aren't indexed
+			if r[j] == nil {
+				continue
+			}
+			var p, b uint16
+			n := get(record, fieldName(t.Columns, j))
+			t.index.insert(string(c.Name), n, uint16(l.offset), uint16(l.length), p, b)
+		}
+	}
+}
+
+// RemoveIndex removes the index directories of the table.
+func (t Table) removeIndex() {
+	os.RemoveAll(dir(indexTypeBtree, t.Name))
+	os.RemoveAll(dir(indexTypeLsmTree, t.Name))
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var ErrTableDuplicated = errors.New("table name specified more than once")
+
+// Relation is the rows produced by FROM clause, the fields of rows are bound
+// to columns by scope. Rows of joined tables are concatenated, and the fields
+// of the missing side of outer joins are NULLs.
+type relation struct {
+	scope scope
+	rows  []Row
+	// table is the only table of relation, it's nil if tables are joined.
+	table *Table
+}
+
+// From returns the relation of FROM clause of select statement, tables are
+// joined from left to right.
+func from(stmt *ast.QueryStmtSelectValues) (relation, error) {
+	return joinTables(stmt.TableName, stmt.Alias, stmt.Joins)
+}
+
+// JoinTables returns the relation of table name whose alias is alias joined
+// with the tables of joins from left to right.
+func joinTables(name, alias string, joins []ast.Join) (relation, error) {
+	t, ok := queryTable(name)
+	if !ok {
+		return relation{}, fmt.Errorf("%w: %s", ErrTableNotExisted, name)
+	}
+	name = aliasOr(alias, t.Name)
+	r := relation{scope: newScope(t).as(name), rows: t.Rows, table: &t}
+	names := map[string]bool{name: true}
+	for _, j := range joins {
+		t, ok := queryTable(j.TableName)
+		if !ok {
+			return relation{}, fmt.Errorf("%w: %s", ErrTableNotExisted, j.TableName)
+		}
+		name := aliasOr(j.Alias, t.Name)
+		if names[name] {
+			return relation{}, fmt.Errorf("%w: %s", ErrTableDuplicated, name)
+		}
+		names[name] = true
+		s := newScope(t).as(name)
+		var err error
+		if r, err = r.join(j, t, s); err != nil {
+			return relation{}, err
+		}
+	}
+	return r, nil
+}
+
+// Columns returns the descriptors of all columns of relation.
+func (r relation) columns() []ast.Column {
+	if r.table != nil {
+		return r.table.Columns
+	}
+	columns := make([]ast.Column, 0, len(r.scope.columns))
+	for i, c := range r.scope.columns {
+		columns = append(columns, ast.Column{Name: c, Kind: r.scope.kinds[i]})
+	}
+	return columns
+}
+
+// Join joins table t whose scope is s to the relation. If ON clause can be
+// looked up by the index of t, index nested-loop join is used, otherwise
+// every pair of rows is tested by nested-loop join.
+func (r relation) join(j ast.Join, t Table, s scope) (relation, error) {
+	joined := relation{scope: r.scope.join(s)}
+	if err := joined.scope.check(j.On); err != nil {
+		return relation{}, err
+	}
+	if hasAggregate(j.On) {
+		return relation{}, fmt.Errorf("%w: JOIN", ErrAggregateMisplaced)
+	}
+	lookup := r.indexLookup(j.On, t, s)
+	// matched rows of t for RIGHT and FULL joins
+	matched := make([]bool, len(t.Rows))
+	for _, left := range r.rows {
+		candidates, err := lookup(left)
+		if err != nil {
+			return relation{}, err
+		}
+		found := false
+		for _, i := range candidates {
+			row := concat(left, t.Rows[i])
+			ok, err := joined.scope.test(j.On, row)
+			if err != nil {
+				return relation{}, err
+			}
+			if ok {
+				joined.rows = append(joined.rows, row)
+				matched[i] = true
+				found = true
+			}
+		}
+		if !found && (j.Kind == ast.JoinKindLeft || j.Kind == ast.JoinKindFull) {
+			joined.rows = append(joined.rows, concat(left, make(Row, len(s.columns))))
+		}
+	}
+	if j.Kind == ast.JoinKindRight || j.Kind == ast.JoinKindFull {
+		for i, right := range t.Rows {
+			if !matched[i] {
+				joined.rows = append(joined.rows, concat(make(Row, len(r.scope.columns)), right))
+			}
+		}
+	}
+	return joined, nil
+}
+
+// IndexLookup returns the function to find the rows of t which could be
+// joined with a row of relation. If ON clause is an equality between a
+// column of t and an expression of the relation, like a.x = b.y, the rows
+// are searched by the B-tree index of the column, otherwise all rows of t
+// are returned.
+func (r relation) indexLookup(on ast.Expr, t Table, s scope) func(Row) ([]int, error) {
+	all := make([]int, len(t.Rows))
+	for i := range all {
+		all[i] = i
+	}
+	scan := func(Row) ([]int, error) { return all, nil }
+	cmp, ok := on.(*ast.CmpExpr)
+	if !ok || cmp.Cmp != ast.CmpKindEq || t.index == nil {
+		return scan
+	}
+	for _, sides := range [][2]ast.Expr{{cmp.Left, cmp.Right}, {cmp.Right, cmp.Left}} {
+		c, ok := sides[0].(*ast.ColumnRef)
+		if !ok || r.scope.check(c) == nil || s.check(c) != nil || r.scope.check(sides[1]) != nil {
+			continue
+		}
+		if s.kind(c) != r.scope.kind(sides[1]) {
+			continue
+		}
+		positions, ok := t.positions()
+		if !ok || t.index.getBtree(string(c.Name)) == nil {
+			continue
+		}
+		e := sides[1]
+		return func(row Row) ([]int, error) {
+			v, err := r.scope.eval(e, row)
+			if err != nil || v == nil {
+				return nil, err
+			}
+			return t.searchAll(c.Name, v, positions)
+		}
+	}
+	return scan
+}
+
+// AliasOr returns alias if it's not empty, otherwise name.
+func aliasOr(alias, name string) string {
+	if alias != "" {
+		return alias
+	}
+	return name
+}
+
+// Concat concatenates the fields of two rows to a new row.
+func concat(left, right Row) Row {
+	row := make(Row, 0, len(left)+len(right))
+	row = append(row, left...)
+	return append(row, right...)
+}
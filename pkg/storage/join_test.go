@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// Creates tables for joining once, they are shared by tests.
+func createJoinTables(t *testing.T) {
+	if _, ok := tables["testjoinu"]; ok {
+		return
+	}
+	execAll(t,
+		"create table testjoinu (id int, name text)",
+		"insert into testjoinu values (1, 'wang'), (2, 'li'), (3, 'zhao')",
+		"create table testjoino (uid int, item text)",
+		"insert into testjoino values (1, 'book'), (3, 'pen'), (1, 'cup'), (4, 'bag')",
+	)
+}
+
+func TestSelectWithJoins(t *testing.T) {
+	// GIVEN
+	createJoinTables(t)
+	on := &ast.CmpExpr{
+		Cmp:   ast.CmpKindEq,
+		Left:  &ast.ColumnRef{Table: "u", Name: "id"},
+		Right: &ast.ColumnRef{Table: "o", Name: "uid"},
+	}
+	join := func(kind ast.JoinKind) []ast.Join {
+		if kind == ast.JoinKindCross {
+			return []ast.Join{{Kind: kind, TableName: "testjoino", Alias: "o"}}
+		}
+		return []ast.Join{{Kind: kind, TableName: "testjoino", Alias: "o", On: on}}
+	}
+
+	tests := []struct {
+		kind  ast.JoinKind
+		items []string // name:item
+	}{
+		{ast.JoinKindInner, []string{"wang:book", "wang:cup", "zhao:pen"}},
+		{ast.JoinKindLeft, []string{"wang:book", "wang:cup", "li:", "zhao:pen"}},
+		{ast.JoinKindRight, []string{"wang:book", "wang:cup", "zhao:pen", ":bag"}},
+		{ast.JoinKindFull, []string{"wang:book", "wang:cup", "li:", "zhao:pen", ":bag"}},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		r, err := Select(&ast.QueryStmtSelectValues{
+			TableName: "testjoinu",
+			Alias:     "u",
+			Joins:     join(tt.kind),
+			Columns: []ast.SelectColumn{
+				{Expr: &ast.ColumnRef{Name: "name"}},
+				{Expr: &ast.ColumnRef{Table: "o", Name: "item"}},
+			},
+		})
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+			continue
+		}
+		if len(r.Rows) != len(tt.items) {
+			t.Errorf("test %d should get %d rows, but got %d", i, len(tt.items), len(r.Rows))
+			continue
+		}
+		for j, row := range r.Rows {
+			if got := formatField(row[0]) + ":" + formatField(row[1]); got != tt.items[j] {
+				t.Errorf("test %d row %d should be %s, but got %s", i, j, tt.items[j], got)
+			}
+		}
+	}
+
+	// WHEN
+	r, err := Select(&ast.QueryStmtSelectValues{
+		TableName:          "testjoinu",
+		Joins:              join(ast.JoinKindCross),
+		ContainsAllColumns: true,
+	})
+
+	// THEN
+	if err != nil {
+		t.Fatalf("cross join failed: %v", err)
+	}
+	if len(r.Rows) != 12 || len(r.Columns) != 4 {
+		t.Errorf("cross join should get 12 rows with 4 columns, but got %d rows with %d columns", len(r.Rows), len(r.Columns))
+	}
+}
+
+func TestJoinWithIndexLookup(t *testing.T) {
+	// GIVEN
+	createJoinTables(t)
+	u, o := tables["testjoinu"], tables["testjoino"]
+	left := newScope(u)
+	right := newScope(o)
+	rel := relation{scope: left, rows: u.Rows, table: &u}
+	on := &ast.CmpExpr{
+		Cmp:   ast.CmpKindEq,
+		Left:  &ast.ColumnRef{Name: "uid"},
+		Right: &ast.ColumnRef{Name: "id"},
+	}
+
+	// WHEN
+	lookup := rel.indexLookup(on, o, right)
+	found, err := lookup(u.Rows[0])
+
+	// THEN
+	if err != nil {
+		t.Fatalf("failed to look up rows: %v", err)
+	}
+	if len(found) != 2 || found[0] != 0 || found[1] != 2 {
+		t.Errorf("rows 0 and 2 should be found by index, but got %v", found)
+	}
+
+	// WHEN, ON clause isn't an equality of column
+	lookup = rel.indexLookup(&ast.CmpExpr{Cmp: ast.CmpKindLt, Left: on.Left, Right: on.Right}, o, right)
+	found, _ = lookup(u.Rows[0])
+
+	// THEN
+	if len(found) != len(o.Rows) {
+		t.Errorf("all rows should be scanned, but got %v", found)
+	}
+}
+
+func TestSelectWithJoinsFailed(t *testing.T) {
+	// GIVEN
+	createJoinTables(t)
+
+	tests := []struct {
+		stmt *ast.QueryStmtSelectValues
+		err  error
+	}{
+		{&ast.QueryStmtSelectValues{
+			TableName:          "testjoinu",
+			Joins:              []ast.Join{{Kind: ast.JoinKindCross, TableName: "testjoinu"}},
+			ContainsAllColumns: true,
+		}, ErrTableDuplicated},
+		{&ast.QueryStmtSelectValues{
+			TableName:          "testjoinu",
+			Joins:              []ast.Join{{Kind: ast.JoinKindCross, TableName: "testjoinx"}},
+			ContainsAllColumns: true,
+		}, ErrTableNotExisted},
+		{&ast.QueryStmtSelectValues{
+			TableName: "testjoinu",
+			Alias:     "u",
+			Joins:     []ast.Join{{Kind: ast.JoinKindCross, TableName: "testjoinu", Alias: "v"}},
+			Columns:   []ast.SelectColumn{{Expr: &ast.ColumnRef{Name: "name"}}},
+		}, ErrColumnAmbiguous},
+		{&ast.QueryStmtSelectValues{
+			TableName: "testjoinu",
+			Alias:     "u",
+			Joins:     []ast.Join{{Kind: ast.JoinKindCross, TableName: "testjoino"}},
+			Columns:   []ast.SelectColumn{{Expr: &ast.ColumnRef{Table: "testjoinu", Name: "name"}}},
+		}, ErrColumnNamesNotMatched},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		_, err := Select(tt.stmt)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should fail with %v, but got %v", i, tt.err, err)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/wangwalker/gpostgres/pkg/ast"
 	"github.com/wangwalker/gpostgres/pkg/ds"
@@ -12,126 +15,329 @@ import (
 var (
 	ErrTableExisted          = errors.New("table already existed")
 	ErrTableNotExisted       = errors.New("table not existed")
+	ErrTableNameInvalid      = errors.New("table name can't be used as file name")
 	ErrValuesIncomplete      = errors.New("inserted values isn't complete")
 	ErrColumnNamesNotMatched = errors.New("table column names aren't matched")
+	ErrColumnDuplicated      = errors.New("column specified more than once")
 	ErrIndexNotExisted       = errors.New("table index not existed")
 	ErrRowNotExisted         = errors.New("table row not existed")
 )
 
-func CreateTable(stmt *ast.QueryStmtCreateTable) error {
+func CreateTable(stmt *ast.QueryStmtCreateTable) (*Result, error) {
 	tableName := stmt.Name
 	if _, ok := tables[tableName]; ok {
-		return ErrTableExisted
+		return nil, ErrTableExisted
+	}
+	if err := checkTableName(tableName); err != nil {
+		return nil, err
+	}
+	for _, c := range stmt.Columns {
+		if c.Default == nil {
+			continue
+		}
+		if _, err := valueField(c.Kind, c.Default); err != nil {
+			return nil, fmt.Errorf("%w, column %s", err, c.Name)
+		}
 	}
 	table := NewTable(*stmt)
 	table.setColumnNames()
-	table.saveScheme()
+	if err := table.addConstraints(stmt.Constraints); err != nil {
+		table.removeIndex()
+		return nil, err
+	}
+	if err := table.saveScheme(); err != nil {
+		table.removeIndex()
+		return nil, err
+	}
 	tables[tableName] = *table
+	return commandResult("CREATE TABLE"), nil
+}
+
+// CheckTableName checks if table name n can be used in the paths of scheme,
+// data and index files, which are named by it in the configured directories.
+func checkTableName(n string) error {
+	if n == "" || n == "." || n == ".." || strings.ContainsAny(n, "/\\\x00") {
+		return fmt.Errorf("%w: %q", ErrTableNameInvalid, n)
+	}
 	return nil
 }
 
-func Insert(stmt *ast.QueryStmtInsertValues) (int, error) {
-	if len(stmt.Rows) < 1 {
-		return 0, ErrValuesIncomplete
+func Insert(stmt *ast.QueryStmtInsertValues) (*Result, error) {
+	if len(stmt.Rows) < 1 && stmt.Query == nil {
+		return nil, ErrValuesIncomplete
 	}
 	table, ok := tables[stmt.TableName]
 	if !ok {
-		return 0, ErrTableNotExisted
+		return nil, ErrTableNotExisted
 	}
-	if len(stmt.ColumnNames) > 0 {
-		for i, c := range table.Columns {
-			if c.Name != stmt.ColumnNames[i] {
-				return 0, ErrColumnNamesNotMatched
-			}
-		}
+	columns, err := table.insertedColumns(stmt)
+	if err != nil {
+		return nil, err
 	}
-	columns := len(stmt.ColumnNames)
-	if stmt.ContainsAllColumns {
-		columns = len(table.Columns)
+	rt, err := newScope(table).returning(stmt.Returning)
+	if err != nil {
+		return nil, err
+	}
+	values := stmt.Rows
+	if stmt.Query != nil {
+		if values, err = queriedValues(stmt.Query, len(columns)); err != nil {
+			return nil, err
+		}
 	}
-	// TODO: support default value for column when inserts partial columns
-	rows := make([]Row, 0, len(stmt.Rows))
-	for _, r := range stmt.Rows {
-		row := make([]Field, 0, len(r))
-		for _, v := range r {
-			row = append(row, Field(v).purify())
+	rows := make([]Row, 0, len(values))
+	for _, r := range values {
+		if len(r) != len(columns) {
+			return nil, ErrValuesIncomplete
+		}
+		// the columns not inserted get their default values
+		row := make(Row, len(table.Columns))
+		for i, c := range table.Columns {
+			row[i] = defaultField(c)
 		}
-		if len(row) != columns {
-			return 0, ErrValuesIncomplete
+		for j, v := range r {
+			i := columns[j]
+			f, err := valueField(table.Columns[i].Kind, v)
+			if err != nil {
+				return nil, fmt.Errorf("%w, column %s", err, table.Columns[i].Name)
+			}
+			row[i] = f
 		}
 		rows = append(rows, row)
 	}
+	if err := table.validate(rows, nil); err != nil {
+		return nil, err
+	}
+	// write rows binary data to local file
+	if _, err := table.save(rows); err != nil {
+		return nil, err
+	}
 	table.Rows = append(table.Rows, rows...)
 	table.Len = len(table.Rows)
 	tables[table.Name] = table
-	// write rows binary data to local file
-	table.save(rows)
-	return len(rows), nil
+	return rt.result("INSERT", rows)
 }
 
-func Select(stmt *ast.QueryStmtSelectValues) ([]Row, error) {
-	table, ok := tables[stmt.TableName]
-	if !ok {
+// QueriedValues runs the query of INSERT and returns its rows as literals, so
+// they are converted to the fields of inserted columns like VALUES. The query
+// must return n columns, which is the number of inserted columns.
+func queriedValues(q ast.Query, n int) ([]ast.Row, error) {
+	res, err := query(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Columns) != n {
+		return nil, fmt.Errorf("%w: %d columns returned for %d columns", ErrValuesIncomplete, len(res.Columns), n)
+	}
+	values := make([]ast.Row, 0, len(res.Rows))
+	for _, r := range res.Rows {
+		row := make(ast.Row, 0, len(r))
+		for _, f := range r {
+			row = append(row, fieldLiteral(f))
+		}
+		values = append(values, row)
+	}
+	return values, nil
+}
+
+// InsertedColumns returns the positions of the columns inserted by stmt in
+// table, the columns can be listed in any order.
+func (t Table) insertedColumns(stmt *ast.QueryStmtInsertValues) ([]int, error) {
+	columns := make([]int, 0, len(t.Columns))
+	if stmt.ContainsAllColumns {
+		for i := range t.Columns {
+			columns = append(columns, i)
+		}
+		return columns, nil
+	}
+	for _, n := range stmt.ColumnNames {
+		i := t.columnIndex(n)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrColumnNamesNotMatched, n)
+		}
+		if slices.Contains(columns, i) {
+			return nil, fmt.Errorf("%w: %s", ErrColumnDuplicated, n)
+		}
+		columns = append(columns, i)
+	}
+	return columns, nil
+}
+
+func Select(stmt *ast.QueryStmtSelectValues) (*Result, error) {
+	if _, ok := queryTable(stmt.TableName); !ok {
 		return nil, ErrTableNotExisted
 	}
+	r, err := from(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if stmt, err = r.scope.ordered(stmt); err != nil {
+		return nil, err
+	}
+	if err := checkDistinctOn(stmt); err != nil {
+		return nil, err
+	}
+	if aggregated(stmt) {
+		return r.aggregate(stmt)
+	}
+	if windowed(stmt) {
+		return r.window(stmt)
+	}
+	s := r.scope
 	// check if the selected columns have been defined
-	for _, sc := range stmt.ColumnNames {
-		if !slices.Contains(table.ColumnNames, sc) {
-			return nil, ErrColumnNamesNotMatched
+	columns := make([]ast.Column, 0, len(stmt.Columns))
+	for _, c := range stmt.Columns {
+		if err := s.check(c.Expr); err != nil {
+			return nil, err
 		}
+		columns = append(columns, ast.Column{Name: columnName(c), Kind: s.kind(c.Expr)})
 	}
-	// check if the column from where clause has been defined
-	if !stmt.Where.IsEmpty() && !slices.Contains(table.ColumnNames, stmt.Where.Column) {
-		return nil, ErrColumnNamesNotMatched
+	for _, e := range stmt.DistinctOn {
+		if err := s.check(e); err != nil {
+			return nil, err
+		}
 	}
-
-	filtered := table.Rows
-	// if where cluase is not empty, filter rows
-	if !stmt.Where.IsEmpty() {
-		filtered, _ = table.filter(stmt.Where)
+	filtered, err := r.scan(stmt.Where, stmt.OrderBy)
+	if err != nil {
+		return nil, err
 	}
-	rows := make([]Row, 0)
 	if stmt.ContainsAllColumns {
-		return filtered, nil
-	}
-
-	selectedIndexes := indexesOf(stmt.ColumnNames, table.ColumnNames)
-	for _, r := range filtered {
-		row := make([]Field, 0, len(stmt.ColumnNames))
-		for _, si := range selectedIndexes {
-			for i, f := range r {
-				if si == i {
-					f := f
-					row = append(row, f)
-				}
+		return s.output(stmt, r.columns(), nil, stmt.DistinctOn, filtered)
+	}
+	return s.output(stmt, columns, stmt.Columns, stmt.DistinctOn, filtered)
+}
+
+// Project evaluates the selected columns for every row, columns describe the
+// values of selected columns.
+func (s scope) project(columns []ast.Column, selected []ast.SelectColumn, rows []Row) (*Result, error) {
+	projected := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		row := make(Row, 0, len(selected))
+		for _, c := range selected {
+			v, err := s.eval(c.Expr, r)
+			if err != nil {
+				return nil, err
 			}
+			row = append(row, v)
 		}
-		rows = append(rows, row)
+		projected = append(projected, row)
 	}
-	return rows, nil
+	return selectedResult(columns, projected), nil
 }
 
-func Update(stmt *ast.QueryStmtUpdateValues) (int, error) {
+func Update(stmt *ast.QueryStmtUpdateValues) (*Result, error) {
 	table, ok := tables[stmt.TableName]
 	if !ok {
-		return 0, ErrTableNotExisted
+		return nil, ErrTableNotExisted
 	}
-	// check if the selected columns have been defined
+	// check if the updated columns have been defined and set only once
+	columns := make([]ast.ColumnName, 0, len(stmt.Values))
 	for _, c := range stmt.Values {
 		if !slices.Contains(table.ColumnNames, c.Name) {
-			return 0, ErrColumnNamesNotMatched
+			return nil, ErrColumnNamesNotMatched
+		}
+		if slices.Contains(columns, c.Name) {
+			return nil, fmt.Errorf("%w: %s", ErrColumnDuplicated, c.Name)
+		}
+		columns = append(columns, c.Name)
+	}
+	s, indexes, sources, err := table.updating(stmt)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range stmt.Values {
+		if err := s.check(c.Value); err != nil {
+			return nil, err
 		}
 	}
-	// check if the column from where clause has been defined
-	if !stmt.Where.IsEmpty() && !slices.Contains(table.ColumnNames, stmt.Where.Column) {
-		return 0, ErrColumnNamesNotMatched
+	rt, err := s.returning(stmt.Returning)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return rt.result("UPDATE", nil)
+	}
+	updated, err := table.updated(indexes, stmt.Values, s, sources)
+	if err != nil {
+		return nil, err
+	}
+	replace := func(t *Table) error { return t.replace(indexes, updated) }
+	if err := table.rehearse(replace); err != nil {
+		return nil, err
+	}
+	tables[table.Name] = table
+	// the new versions are returned with the rows of FROM clause joined
+	returned := make([]Row, 0, len(updated))
+	for j, r := range updated {
+		returned = append(returned, append(append(Row{}, r...), sources[j][len(r):]...))
 	}
+	return rt.result("UPDATE", returned)
+}
 
-	filtered, _ := table.filter(stmt.Where)
-	for _, r := range filtered {
-		r.update(stmt.Values, table)
+// Updating returns the positions of rows updated by stmt, and the source rows
+// which the values are evaluated with by scope s. Without FROM clause, the
+// sources are the updated rows, otherwise they are the updated rows joined
+// with the first matched rows of FROM clause, the other matched rows are
+// ignored like PostgreSQL.
+func (t Table) updating(stmt *ast.QueryStmtUpdateValues) (scope, []int, []Row, error) {
+	name := aliasOr(stmt.Alias, t.Name)
+	s := newScope(t).as(name)
+	if len(stmt.From) == 0 {
+		sources, indexes, err := s.filter(stmt.Where, t.Rows)
+		return s, indexes, sources, err
+	}
+	from := stmt.From[0]
+	r, err := joinTables(from.TableName, from.Alias, stmt.From[1:])
+	if err != nil {
+		return scope{}, nil, nil, err
+	}
+	if slices.Contains(r.scope.tables, name) {
+		return scope{}, nil, nil, fmt.Errorf("%w: %s", ErrTableDuplicated, name)
+	}
+	s = s.join(r.scope)
+	if err := s.check(stmt.Where); err != nil {
+		return scope{}, nil, nil, err
+	}
+	indexes := make([]int, 0)
+	sources := make([]Row, 0)
+	for i, row := range t.Rows {
+		for _, o := range r.rows {
+			source := concat(row, o)
+			ok, err := s.test(stmt.Where, source)
+			if err != nil {
+				return scope{}, nil, nil, err
+			}
+			if ok {
+				indexes = append(indexes, i)
+				sources = append(sources, source)
+				break
+			}
+		}
 	}
-	return len(filtered), nil
+	return s, indexes, sources, nil
+}
+
+func Delete(stmt *ast.QueryStmtDeleteValues) (*Result, error) {
+	table, ok := tables[stmt.TableName]
+	if !ok {
+		return nil, ErrTableNotExisted
+	}
+	deleted, indexes, err := table.filter(stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	rt, err := newScope(table).returning(stmt.Returning)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return rt.result("DELETE", nil)
+	}
+	remove := func(t *Table) error { return t.remove(indexes) }
+	if err := table.rehearse(remove); err != nil {
+		return nil, err
+	}
+	tables[table.Name] = table
+	return rt.result("DELETE", deleted)
 }
 
 // Returns the indexes of sub slice from a slice. For expample:
@@ -150,59 +356,148 @@ func indexesOf(sub, columns []ast.ColumnName) []int {
 	return selectedIndexes
 }
 
-// Returns all the rows and indexes meeting where clause for one table.
-func (t Table) filter(where ast.WhereClause) ([]Row, []int) {
-	filtered := make([]Row, 0, t.Len)
-	indexes := make([]int, 0, t.Len)
-	columnIndex := slices.Index(t.ColumnNames, where.Column)
-OUTER:
-	for _, cn := range t.ColumnNames {
-		for i, r := range t.Rows {
-			if cn != where.Column {
-				continue OUTER
-			}
-			if r.matched(where, columnIndex) {
-				filtered = append(filtered, r)
-				indexes = append(indexes, i)
+// Returns all the rows and indexes meeting where clause for one table, if
+// where clause is nil, all rows are returned.
+func (t Table) filter(where ast.Expr) ([]Row, []int, error) {
+	return newScope(t).filter(where, t.Rows)
+}
+
+// Returns the rows and their indexes meeting where clause in rows, if where
+// clause is nil, all rows are returned.
+func (s scope) filter(where ast.Expr, rows []Row) ([]Row, []int, error) {
+	filtered := make([]Row, 0, len(rows))
+	indexes := make([]int, 0, len(rows))
+	if err := s.check(where); err != nil {
+		return nil, nil, err
+	}
+	for i, r := range rows {
+		ok, err := s.test(where, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			filtered = append(filtered, r)
+			indexes = append(indexes, i)
+		}
+	}
+	return filtered, indexes, nil
+}
+
+// Updated returns the new versions of rows at indexes changed by values,
+// which are evaluated with sources by scope s, the sources are the old
+// versions of rows if it's nil.
+func (t Table) updated(indexes []int, values []ast.ColumnUpdatedValue, s scope, sources []Row) ([]Row, error) {
+	updated := make([]Row, 0, len(indexes))
+	for j, i := range indexes {
+		source := t.Rows[i]
+		if sources != nil {
+			source = sources[j]
+		}
+		r := make(Row, len(t.Rows[i]))
+		copy(r, t.Rows[i])
+		for _, v := range values {
+			k := slices.Index(t.ColumnNames, v.Name)
+			f, err := s.field(t.Columns[k].Kind, v.Value, source)
+			if err != nil {
+				return nil, fmt.Errorf("%w, column %s", err, v.Name)
 			}
+			r[k] = f
 		}
+		updated = append(updated, r)
 	}
-	return filtered, indexes
+	return updated, nil
 }
 
-// Tests if one row matches with where clause condition.
-// Note: the row is just slice of Field, so using index indicates which field to test.
-func (r Row) matched(where ast.WhereClause, index int) bool {
-	switch where.Cmp {
-	case ast.CmpKindEq:
-		return r[index] == Field(where.Value)
-	case ast.CmpKindNotEq:
-		return r[index] != Field(where.Value)
-	case ast.CmpKindGt:
-		return r[index] > Field(where.Value)
-	case ast.CmpKindGte:
-		return r[index] >= Field(where.Value)
-	case ast.CmpKindLt:
-		return r[index] < Field(where.Value)
-	case ast.CmpKindLte:
-		return r[index] <= Field(where.Value)
+// Remove removes the rows at indexes from the table, the rows are marked as
+// deleted in data file and their keys are deleted from the indexes.
+func (t *Table) remove(indexes []int) error {
+	olds := make([]Row, 0, len(indexes))
+	for _, i := range indexes {
+		olds = append(olds, t.Rows[i])
+	}
+	if err := t.restrictReferences(olds, nil, indexes); err != nil {
+		return err
+	}
+	if err := t.drop(indexes); err != nil {
+		return err
 	}
-	return false
+	rows := make([]Row, 0, len(t.Rows)-len(indexes))
+	locations := make([]location, 0, len(t.locations))
+	for i, r := range t.Rows {
+		if slices.Contains(indexes, i) {
+			continue
+		}
+		rows = append(rows, r)
+		if i < len(t.locations) {
+			locations = append(locations, t.locations[i])
+		}
+	}
+	t.Rows = rows
+	t.locations = locations
+	t.Len = len(rows)
+	return t.cascadeReferences(olds, nil)
 }
 
-func (r Row) update(newValues []ast.ColumnUpdatedValue, table Table) {
-	sub := make([]ast.ColumnName, 0, len(newValues))
-	for _, v := range newValues {
-		sub = append(sub, v.Name)
+// Replace replaces the rows at indexes with their new versions updated. The
+// old versions are marked as deleted in data file and the new versions are
+// appended to it, so the indexes are moved to the new versions too.
+func (t *Table) replace(indexes []int, updated []Row) error {
+	if err := t.validate(updated, indexes); err != nil {
+		return err
+	}
+	olds := make([]Row, 0, len(indexes))
+	for _, i := range indexes {
+		olds = append(olds, t.Rows[i])
+	}
+	if err := t.restrictReferences(olds, updated, indexes); err != nil {
+		return err
 	}
-	indexes := indexesOf(sub, table.ColumnNames)
-	for _, nv := range newValues {
-		for i := range r {
-			if slices.Contains(indexes, i) {
-				r[i] = Field(nv.Value)
+	if err := t.drop(indexes); err != nil {
+		return err
+	}
+	// save appends locations of new versions to the end, move them to the
+	// positions of old versions.
+	n := len(t.locations)
+	if _, err := t.save(updated); err != nil {
+		return err
+	}
+	saved := t.locations[n:]
+	t.locations = t.locations[:n]
+	for j, i := range indexes {
+		t.Rows[i] = updated[j]
+		if i < len(t.locations) && j < len(saved) {
+			t.locations[i] = saved[j]
+		}
+	}
+	return t.cascadeReferences(olds, updated)
+}
+
+// Drop marks the rows at indexes as deleted in data file and deletes their
+// keys from the indexes, but the rows are still kept in memory.
+func (t *Table) drop(indexes []int) error {
+	dropped := make([]location, 0, len(indexes))
+	for _, i := range indexes {
+		// rows which haven't been saved have no location
+		if i >= len(t.locations) {
+			continue
+		}
+		l := t.locations[i]
+		dropped = append(dropped, l)
+		if t.index == nil {
+			continue
+		}
+		record := t.convert(t.Rows[i])
+		for j, c := range t.Columns {
+			// NULLs aren't indexed
+			if t.Rows[i][j] == nil {
+				continue
 			}
+			var p, b uint16
+			n := get(record, fieldName(t.Columns, j))
+			t.index.delete(string(c.Name), n, uint16(l.offset), uint16(l.length), p, b)
 		}
 	}
+	return t.erase(dropped)
 }
 
 // Search searchs the table with index and returns the row.
@@ -214,7 +509,7 @@ func (t Table) search(c ast.ColumnName, f Field) (Row, error) {
 	if btree == nil {
 		return nil, ErrIndexNotExisted
 	}
-	key := btree.Search(string(f))
+	key := btree.Search(indexKey(f))
 	if key.IsEmpty() {
 		return nil, ErrRowNotExisted
 	}
@@ -222,6 +517,44 @@ func (t Table) search(c ast.ColumnName, f Field) (Row, error) {
 	return t.read(key)
 }
 
+// SearchAll searchs the table with the index of column c and returns the
+// positions of all rows whose values of c are f, positions is the result of
+// t.positions().
+func (t Table) searchAll(c ast.ColumnName, f Field, positions map[location]int) ([]int, error) {
+	if t.index == nil {
+		return nil, ErrIndexNotExisted
+	}
+	btree := t.index.getBtree(string(c))
+	if btree == nil {
+		return nil, ErrIndexNotExisted
+	}
+	keys := btree.SearchAll(indexKey(f))
+	found := make([]int, 0, len(keys))
+	for _, k := range keys {
+		if i, ok := positions[keyLocation(k)]; ok {
+			found = append(found, i)
+		}
+	}
+	sort.Ints(found)
+	return found, nil
+}
+
+// Positions maps the locations of rows in data file to their positions in
+// t.Rows, which is used to find rows by index keys. As the offsets of index
+// keys are only 16 bits, ok is false if some locations are conflicted.
+func (t Table) positions() (map[location]int, bool) {
+	positions := make(map[location]int, len(t.locations))
+	for i, l := range t.locations {
+		positions[location{offset: int64(uint16(l.offset)), length: l.length}] = i
+	}
+	return positions, len(positions) == t.Len
+}
+
+// KeyLocation returns the location of row which index key points to.
+func keyLocation(k ds.BtreeKey) location {
+	return location{offset: int64(k.Data.Offset), length: int(k.Data.Length)}
+}
+
 // Read reads the row data from local file.
 func (t Table) read(k ds.BtreeKey) (Row, error) {
 	f, err := os.OpenFile(t.dataPath(), os.O_RDONLY, 0666)
@@ -238,5 +571,5 @@ func (t Table) read(k ds.BtreeKey) (Row, error) {
 	if err != nil {
 		return nil, err
 	}
-	return t.decodeRow(b)
+	return t.decodeRow(b, int64(k.Data.Offset))
 }
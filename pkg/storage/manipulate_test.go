@@ -0,0 +1,540 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+// Returns where clause: name = n.
+func nameEq(n string) ast.Expr {
+	return &ast.CmpExpr{
+		Cmp:   ast.CmpKindEq,
+		Left:  &ast.ColumnRef{Name: "name"},
+		Right: &ast.Literal{Kind: ast.LiteralKindString, Value: n},
+	}
+}
+
+// Returns the literal of v, v is quoted for string, and NULL for null.
+func value(v string) ast.Expr {
+	switch {
+	case v == "NULL":
+		return &ast.Literal{Kind: ast.LiteralKindNull}
+	case strings.HasPrefix(v, "'"):
+		return &ast.Literal{Kind: ast.LiteralKindString, Value: strings.Trim(v, "'")}
+	}
+	return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v}
+}
+
+// Parses source and executes the statement of CREATE TABLE, INSERT, UPDATE or
+// DELETE.
+func exec(source string) (*Result, error) {
+	stmt, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt := stmt.(type) {
+	case *ast.QueryStmtCreateTable:
+		return CreateTable(stmt)
+	case *ast.QueryStmtInsertValues:
+		return Insert(stmt)
+	case *ast.QueryStmtUpdateValues:
+		return Update(stmt)
+	case *ast.QueryStmtDeleteValues:
+		return Delete(stmt)
+	}
+	return nil, parser.ErrQuerySyntaxInvalid
+}
+
+// Execs sources in order, the test fails at the first failed one.
+func execAll(t *testing.T, sources ...string) {
+	for _, source := range sources {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+}
+
+// Returns the row of VALUES clause composed by literals of vs.
+func values(vs ...string) ast.Row {
+	row := make(ast.Row, 0, len(vs))
+	for _, v := range vs {
+		row = append(row, value(v))
+	}
+	return row
+}
+
+func TestDeleteRowsAndLoad(t *testing.T) {
+	// GIVEN
+	create := &ast.QueryStmtCreateTable{
+		Name: "testdelete1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	if _, err := CreateTable(create); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testdelete1",
+		Rows:               []ast.Row{values("'wang'", "18"), values("'li'", "20"), values("'zhao'", "28")},
+		ContainsAllColumns: true,
+	}
+	if r, err := Insert(insert); err != nil || r.Tag != "INSERT 0 3" {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+
+	// WHEN
+	r, err := Delete(&ast.QueryStmtDeleteValues{
+		TableName: "testdelete1",
+		Where:     nameEq("li"),
+	})
+
+	// THEN
+	if err != nil {
+		t.Errorf("failed to delete rows: %s", err)
+	}
+	if r.Affected != 1 || r.Tag != "DELETE 1" {
+		t.Errorf("deleted rows should be 1, but got %d", r.Affected)
+	}
+	t1 := tables["testdelete1"]
+	if t1.Len != 2 || len(t1.Rows) != 2 {
+		t.Errorf("table should have 2 rows, but got %d", t1.Len)
+	}
+	if k := t1.index.getBtree("name").Search("li"); !k.IsEmpty() {
+		t.Errorf("btree index of deleted row should be removed")
+	}
+	if d := t1.index.getLsmTree("name").Search("li"); !d.IsEmpty() {
+		t.Errorf("lsmtree index of deleted row should be removed")
+	}
+	if _, err := t1.search("name", "zhao"); err != nil {
+		t.Errorf("failed to search row after deleting: %s", err)
+	}
+
+	// THEN, deleted row shouldn't be loaded again.
+	loadSchemes()
+	load()
+	t2 := tables["testdelete1"]
+	if len(t2.Rows) != 2 {
+		t.Fatalf("table should load 2 rows, but got %d", len(t2.Rows))
+	}
+	if t2.Rows[0][0] != "wang" || t2.Rows[1][0] != "zhao" {
+		t.Errorf("loaded rows are not correct: %v", t2.Rows)
+	}
+}
+
+func TestUpdateRowsAndLoad(t *testing.T) {
+	// GIVEN
+	create := &ast.QueryStmtCreateTable{
+		Name: "testupdate1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	if _, err := CreateTable(create); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testupdate1",
+		Rows:               []ast.Row{values("'wang'", "18"), values("'li'", "20"), values("'zhao'", "28")},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %s", err)
+	}
+
+	// WHEN
+	r, err := Update(&ast.QueryStmtUpdateValues{
+		TableName: "testupdate1",
+		Values:    []ast.ColumnUpdatedValue{{Name: "name", Value: value("'qian'")}, {Name: "age", Value: value("21")}},
+		Where:     nameEq("li"),
+	})
+
+	// THEN
+	if err != nil {
+		t.Errorf("failed to update rows: %s", err)
+	}
+	if r.Affected != 1 || r.Tag != "UPDATE 1" {
+		t.Errorf("updated rows should be 1, but got %d", r.Affected)
+	}
+	t1 := tables["testupdate1"]
+	if t1.Len != 3 {
+		t.Errorf("table should have 3 rows, but got %d", t1.Len)
+	}
+	if t1.Rows[1][0] != "qian" || t1.Rows[1][1] != int64(21) {
+		t.Errorf("updated row is not correct: %v", t1.Rows[1])
+	}
+	if k := t1.index.getBtree("name").Search("li"); !k.IsEmpty() {
+		t.Errorf("btree index of old value should be removed")
+	}
+	if d := t1.index.getLsmTree("name").Search("li"); !d.IsEmpty() {
+		t.Errorf("lsmtree index of old value should be removed")
+	}
+	row, err := t1.search("name", "qian")
+	if err != nil {
+		t.Errorf("failed to search updated row: %s", err)
+	}
+	if len(row) != 2 || row[1] != int64(21) {
+		t.Errorf("searched row is not correct: %v", row)
+	}
+
+	// THEN, new version should be loaded instead of the old one.
+	loadSchemes()
+	load()
+	t2 := tables["testupdate1"]
+	if t2.Len != 3 {
+		t.Fatalf("table should load 3 rows, but got %d", t2.Len)
+	}
+	names := []Field{t2.Rows[0][0], t2.Rows[1][0], t2.Rows[2][0]}
+	if names[0] != "wang" || names[1] != "zhao" || names[2] != "qian" {
+		t.Errorf("loaded rows are not correct: %v", t2.Rows)
+	}
+}
+
+func TestInsertNullAndLoad(t *testing.T) {
+	// GIVEN, table created before NULL is supported has rows without unions
+	legacy := Table{
+		Name: "testnull1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	legacy.setColumnNames()
+	legacy.saveScheme()
+	if _, err := legacy.save([]Row{{"wang", int64(18)}}); err != nil {
+		t.Fatalf("failed to save rows: %v", err)
+	}
+	loadSchemes()
+	load()
+
+	// WHEN
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testnull1",
+		Rows:               []ast.Row{values("'li'", "NULL"), values("NULL", "20")},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+	update := &ast.QueryStmtUpdateValues{
+		TableName: "testnull1",
+		Values:    []ast.ColumnUpdatedValue{{Name: "name", Value: value("NULL")}},
+		Where:     &ast.IsNullExpr{Expr: &ast.ColumnRef{Name: "age"}},
+	}
+	if r, err := Update(update); err != nil || r.Affected != 1 {
+		t.Fatalf("failed to update rows: %v", err)
+	}
+
+	// THEN
+	// the updated row is saved at the end of data file
+	want := []Row{{"wang", int64(18)}, {nil, int64(20)}, {nil, nil}}
+	t1 := tables["testnull1"]
+	rows, err := t1.loadRows()
+	if err != nil {
+		t.Fatalf("failed to load rows: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("loaded rows should be %v, but got %v", want, rows)
+	}
+	r, err := Select(&ast.QueryStmtSelectValues{
+		TableName:          "testnull1",
+		ContainsAllColumns: true,
+		Where:              &ast.IsNullExpr{Expr: &ast.ColumnRef{Name: "name"}, Not: true},
+	})
+	if err != nil || len(r.Rows) != 1 || r.Rows[0][0] != "wang" {
+		t.Errorf("only one row has name, but got %v, %v", r, err)
+	}
+}
+
+func TestUpdateWithExprs(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testupdate2 (name text, age int, bonus int)",
+		"insert into testupdate2 values ('wang', 18, 2), ('li', 20, null)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"update testupdate2 set age = age + 1, name = upper(name)", []Row{{"WANG", int64(19), int64(2)}, {"LI", int64(21), nil}}, nil},
+		// the values are evaluated with the old versions of rows
+		{"update testupdate2 t set age = bonus, bonus = t.age where bonus is not null", []Row{{"WANG", int64(2), int64(19)}, {"LI", int64(21), nil}}, nil},
+		{"update testupdate2 set name = name || age where age > 20", []Row{{"WANG", int64(2), int64(19)}, {"LI21", int64(21), nil}}, nil},
+		{"update testupdate2 set age = coalesce(bonus, 0) * 2", []Row{{"WANG", int64(38), int64(19)}, {"LI21", int64(0), nil}}, nil},
+		{"update testupdate2 set age = no + 1", nil, ErrColumnNamesNotMatched},
+		{"update testupdate2 set age = 1, age = 2", nil, ErrColumnDuplicated},
+		{"update testupdate2 set age = age / 0", nil, ErrDivisionByZero},
+		{"update testupdate2 set age = count(*)", nil, ErrAggregateMisplaced},
+		{"update testupdate2 set age = name", nil, ErrIntInvalid},
+		{"update testupdate2 set age = bonus * 9223372036854775807", nil, ErrIntOutOfRange},
+		// the result fits int64 but not the INT column
+		{"update testupdate2 set age = bonus * 200000000", nil, ErrIntOutOfRange},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		_, err := exec(tt.source)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if rows := tables["testupdate2"].Rows; tt.err == nil && !reflect.DeepEqual(rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, rows)
+		}
+	}
+}
+
+func TestUpdateFrom(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testupdate3 (id int, name text, total int)",
+		"create table testupdate4 (uid int, amount int)",
+		"insert into testupdate3 values (1, 'wang', 0), (2, 'li', 0), (3, 'zhao', 0)",
+		"insert into testupdate4 values (1, 10), (2, 20), (1, 30)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	// only the first matched row of FROM clause is used
+	r, err := exec("update testupdate3 u set total = u.total + o.amount, name = name || o.uid from testupdate4 o where u.id = o.uid")
+
+	// THEN
+	if err != nil || r.Affected != 2 {
+		t.Fatalf("update should affect 2 rows, but got %v, %v", r, err)
+	}
+	want := []Row{{int64(1), "wang1", int64(10)}, {int64(2), "li2", int64(20)}, {int64(3), "zhao", int64(0)}}
+	if rows := tables["testupdate3"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows should be %v, but got %v", want, rows)
+	}
+	failed := []struct {
+		source string
+		err    error
+	}{
+		{"update testupdate3 set total = 1 from testupdate3", ErrTableDuplicated},
+		{"update testupdate3 set total = 1 from nothing", ErrTableNotExisted},
+		{"update testupdate3 set total = amount from testupdate4 where id = nothing", ErrColumnNamesNotMatched},
+		{"update testupdate3 set total = 1 from testupdate4 o, testupdate4 o", ErrTableDuplicated},
+	}
+	for i, tt := range failed {
+		if _, err := exec(tt.source); !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testinsert1 (id int, name text, city text default 'beijing')",
+		"create table testinsert2 (no int, title text, score int)",
+		"insert into testinsert2 values (1, 'walker', 90), (2, 'molly', 80), (3, 'bob', 70)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source   string
+		affected int
+		err      error
+	}{
+		{"insert into testinsert1 (name, id) values ('alice', 10)", 1, nil},
+		{"insert into testinsert1 (name, id) select title, no from testinsert2 where score > 75 order by no", 2, nil},
+		// the numbers are converted to the kinds of inserted columns
+		{"insert into testinsert1 (city, id, name) (select score, no * 10, title from testinsert2 where no = 3)", 1, nil},
+		{"insert into testinsert1 select no, title, 'shanghai' from testinsert2 where score > 100", 0, nil},
+		{"insert into testinsert1 (id) select no, title from testinsert2", 0, ErrValuesIncomplete},
+		{"insert into testinsert1 select no from testinsert2", 0, ErrValuesIncomplete},
+		{"insert into testinsert1 (id) select title from testinsert2", 0, ErrIntInvalid},
+		{"insert into testinsert1 (id, nothing) select no, title from testinsert2", 0, ErrColumnNamesNotMatched},
+		{"insert into testinsert1 (id) select no from nothing", 0, ErrTableNotExisted},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := exec(tt.source)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && r.Affected != tt.affected {
+			t.Errorf("test %d should insert %d rows, but got %d", i, tt.affected, r.Affected)
+		}
+	}
+	rows := []Row{
+		{int64(10), "alice", "beijing"}, {int64(1), "walker", "beijing"},
+		{int64(2), "molly", "beijing"}, {int64(30), "bob", "70"},
+	}
+	if got := tables["testinsert1"].Rows; !reflect.DeepEqual(got, rows) {
+		t.Errorf("rows should be %v, but got %v", rows, got)
+	}
+}
+
+func TestUpdateAndDeleteAfterLoad(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testreload1 (id int primary key, name text)",
+		"insert into testreload1 values (1, 'hello'), (5, 'ab'), (2, 'xy'), (3, 'world')",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+	loadSchemes()
+	load()
+
+	// WHEN
+	manipulations := []string{
+		"update testreload1 set name = 'abcde' where id = 5",
+		"delete from testreload1 where id = 2",
+		"insert into testreload1 values (4, 'apple')",
+	}
+	for _, source := range manipulations {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+	loadSchemes()
+	load()
+
+	// THEN, the new version of updated row is appended to data file
+	rows := []Row{{int64(1), "hello"}, {int64(3), "world"}, {int64(5), "abcde"}, {int64(4), "apple"}}
+	t1 := tables["testreload1"]
+	if !reflect.DeepEqual(t1.Rows, rows) {
+		t.Fatalf("loaded rows should be %v, but got %v", rows, t1.Rows)
+	}
+	if _, err := t1.search("id", int64(2)); !errors.Is(err, ErrRowNotExisted) {
+		t.Errorf("deleted row shouldn't be searched, but got %v", err)
+	}
+	if got, err := t1.search("id", int64(5)); err != nil || !reflect.DeepEqual(got, rows[2]) {
+		t.Errorf("updated row should be searched as %v, but got %v, %v", rows[2], got, err)
+	}
+	if _, err := exec("insert into testreload1 values (3, 'again')"); !errors.Is(err, ErrUniqueViolated) {
+		t.Errorf("duplicated key should be rejected after loading, but got %v", err)
+	}
+}
+
+func TestInsertFailedToSave(t *testing.T) {
+	// GIVEN
+	if _, err := exec("create table testinsert3 (id int, name text)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	// the data file can't be opened for writing if it's a directory
+	t1 := tables["testinsert3"]
+	if err := os.MkdirAll(t1.dataPath(), 0755); err != nil {
+		t.Fatalf("failed to make directory: %v", err)
+	}
+	defer os.RemoveAll(t1.dataPath())
+
+	// WHEN
+	_, err := exec("insert into testinsert3 values (1, 'wang')")
+
+	// THEN
+	if err == nil {
+		t.Errorf("insert should fail if rows can't be saved")
+	}
+	if t2 := tables["testinsert3"]; len(t2.Rows) != 0 || t2.Len != 0 {
+		t.Errorf("table shouldn't have rows, but got %v", t2.Rows)
+	}
+	if d := t1.index.getBtree("id").Search(indexKey(int64(1))); !d.IsEmpty() {
+		t.Errorf("rows failed to save shouldn't be indexed")
+	}
+}
+
+func TestSchemeFailedToSave(t *testing.T) {
+	// GIVEN, the scheme file can't be written if it's a directory
+	execAll(t, "create table testscheme2 (id int)")
+	for _, n := range []string{"testscheme1", "testscheme2"} {
+		p := Table{Name: n}.schemePath()
+		os.Remove(p)
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatalf("failed to make directory: %v", err)
+		}
+		defer os.RemoveAll(p)
+	}
+
+	// WHEN
+	_, err := exec("create table testscheme1 (id int)")
+
+	// THEN
+	if _, ok := tables["testscheme1"]; err == nil || ok {
+		t.Errorf("create should fail if scheme can't be saved, but got %v", err)
+	}
+	truncate := &ast.QueryStmtTruncateTable{TableNames: []string{"testscheme2"}}
+	if _, err := Truncate(truncate); err == nil {
+		t.Errorf("truncate should fail if scheme can't be saved")
+	}
+	alter := &ast.QueryStmtAlterTable{TableName: "testscheme2", Action: ast.AlterTableActionAddColumn, Column: ast.Column{Name: "name", Kind: ast.ColumnKindText}}
+	if _, err := AlterTable(alter); err == nil {
+		t.Errorf("alter should fail if scheme can't be saved")
+	}
+}
+
+func TestCreateTableWithInvalidName(t *testing.T) {
+	// GIVEN
+	sources := []string{
+		`create table "../testescaped" (id int)`,
+		`create table "test/escaped" (id int)`,
+		`create table ".." (id int)`,
+	}
+
+	// WHEN
+	for _, source := range sources {
+		_, err := exec(source)
+
+		// THEN
+		if !errors.Is(err, ErrTableNameInvalid) {
+			t.Errorf("%q should fail with %v, but got %v", source, ErrTableNameInvalid, err)
+		}
+	}
+	if _, err := os.Stat(config.SchemeDir + "/../testescaped.json"); !os.IsNotExist(err) {
+		t.Errorf("scheme file shouldn't be saved out of scheme dir, but got %v", err)
+	}
+}
+
+func TestQuotedColumnNamesAndLoad(t *testing.T) {
+	// GIVEN, the names of columns aren't allowed in avro schema
+	execAll(t, `create table testquoted1 ("first name" text, "b""q" int, "Ünï" text, _field0 int)`)
+
+	// WHEN
+	execAll(t,
+		`insert into testquoted1 values ('wang', 1, 'x', 2), ('li', 3, 'y', 4)`,
+		`update testquoted1 set "b""q" = 5 where "first name" = 'li'`,
+	)
+	loadSchemes()
+	load()
+
+	// THEN
+	want := []Row{{"wang", int64(1), "x", int64(2)}, {"li", int64(5), "y", int64(4)}}
+	t1 := tables["testquoted1"]
+	if !reflect.DeepEqual(t1.Rows, want) {
+		t.Fatalf("loaded rows should be %v, but got %v", want, t1.Rows)
+	}
+	if got, err := t1.search("first name", "li"); err != nil || !reflect.DeepEqual(got, want[1]) {
+		t.Errorf("row should be searched as %v, but got %v, %v", want[1], got, err)
+	}
+}
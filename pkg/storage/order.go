@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrLimitInvalid    = errors.New("argument of LIMIT must be a non-negative integer")
+	ErrOffsetInvalid   = errors.New("argument of OFFSET must be a non-negative integer")
+	ErrOrderByPosition = errors.New("ORDER BY position is not in select list")
+)
+
+// Ordered returns a copy of stmt whose keys of ORDER BY referring to output
+// columns are resolved by outputKeys with scope s.
+func (s scope) ordered(stmt *ast.QueryStmtSelectValues) (*ast.QueryStmtSelectValues, error) {
+	if len(stmt.OrderBy) == 0 {
+		return stmt, nil
+	}
+	selected := stmt.Columns
+	if stmt.ContainsAllColumns {
+		selected = s.selectAll()
+	}
+	keys, err := outputKeys(stmt.OrderBy, selected)
+	if err != nil {
+		return nil, err
+	}
+	c := *stmt
+	c.OrderBy = keys
+	return &c, nil
+}
+
+// OutputKeys resolves the keys of ORDER BY which refer to the output columns
+// selected: an integer like ORDER BY 2 is the position of output column from
+// 1, and a bare name like ORDER BY n is the output column aliased n, which
+// is preferred to the input column with the same name like PostgreSQL. The
+// keys are replaced by the expressions of output columns they refer to.
+func outputKeys(keys []ast.OrderBy, selected []ast.SelectColumn) ([]ast.OrderBy, error) {
+	resolved := make([]ast.OrderBy, 0, len(keys))
+	for _, k := range keys {
+		switch e := k.Expr.(type) {
+		case *ast.Literal:
+			if e.Kind != ast.LiteralKindNumber {
+				break
+			}
+			n, err := strconv.Atoi(e.Value)
+			if err != nil || n < 1 || n > len(selected) {
+				return nil, fmt.Errorf("%w: %s", ErrOrderByPosition, e.Value)
+			}
+			k.Expr = selected[n-1].Expr
+		case *ast.ColumnRef:
+			if e.Table != "" {
+				break
+			}
+			i := slices.IndexFunc(selected, func(c ast.SelectColumn) bool { return c.Alias == string(e.Name) })
+			if i >= 0 {
+				k.Expr = selected[i].Expr
+			}
+		}
+		resolved = append(resolved, k)
+	}
+	return resolved, nil
+}
+
+// Scan returns the rows of relation meeting where clause in the order of
+// keys. If relation is a table and where clause has prefix LIKE or BETWEEN
+// over an indexed column, only the rows in the range of B-tree index are
+// tested. Otherwise if rows can be ordered by the B-tree index of the sort
+// column, they are read in index order directly instead of being sorted.
+func (r relation) scan(where ast.Expr, keys []ast.OrderBy) ([]Row, error) {
+	s := r.scope
+	for _, k := range keys {
+		if err := s.check(k.Expr); err != nil {
+			return nil, err
+		}
+	}
+	if r.table == nil {
+		return s.filterSorted(where, keys, r.rows)
+	}
+	if found, ok := r.table.indexRange(s, where); ok {
+		rows := make([]Row, 0, len(found))
+		for _, i := range found {
+			rows = append(rows, r.rows[i])
+		}
+		return s.filterSorted(where, keys, rows)
+	}
+	order, ok := r.table.indexOrder(keys)
+	if !ok {
+		return s.filterSorted(where, keys, r.rows)
+	}
+	if err := s.check(where); err != nil {
+		return nil, err
+	}
+	rows := make([]Row, 0, len(order))
+	for _, i := range order {
+		ok, err := s.test(where, r.rows[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, r.rows[i])
+		}
+	}
+	return rows, nil
+}
+
+// FilterSorted returns the rows meeting where clause sorted by keys.
+func (s scope) filterSorted(where ast.Expr, keys []ast.OrderBy, rows []Row) ([]Row, error) {
+	filtered, _, err := s.filter(where, rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sort(filtered, keys); err != nil {
+		return nil, err
+	}
+	return filtered, nil
+}
+
+// IndexRange returns the positions of rows which could meet where clause,
+// they are found by scanning a range of B-tree index for a condition like
+// name LIKE 'wa%' or age BETWEEN 18 AND 30, which could be joined with other
+// conditions by AND. The positions are in the order of rows, and ok is false
+// if the index can't be used.
+func (t Table) indexRange(s scope, where ast.Expr) ([]int, bool) {
+	if t.index == nil {
+		return nil, false
+	}
+	for _, cond := range conjuncts(where) {
+		c, from, to, ok := s.keyRange(cond)
+		if !ok {
+			continue
+		}
+		btree := t.index.getBtree(string(c))
+		if btree == nil {
+			continue
+		}
+		positions, ok := t.positions()
+		if !ok {
+			return nil, false
+		}
+		keys := btree.Range(from, to)
+		found := make([]int, 0, len(keys))
+		for _, k := range keys {
+			p, ok := positions[keyLocation(k)]
+			if !ok {
+				return nil, false
+			}
+			found = append(found, p)
+		}
+		sort.Ints(found)
+		return found, true
+	}
+	return nil, false
+}
+
+// Conjuncts splits condition into the conditions joined by AND.
+func conjuncts(cond ast.Expr) []ast.Expr {
+	if cond == nil {
+		return nil
+	}
+	if e, ok := cond.(*ast.LogicExpr); ok && e.Op == ast.LogicOpAnd {
+		return append(conjuncts(e.Left), conjuncts(e.Right)...)
+	}
+	return []ast.Expr{cond}
+}
+
+// KeyRange returns column c and the range [from, to) of its index keys for
+// condition, ok is false unless the condition is LIKE with fixed prefix or
+// BETWEEN over a column and constants. The range has no upper bound if to
+// is empty.
+func (s scope) keyRange(cond ast.Expr) (c ast.ColumnName, from, to string, ok bool) {
+	switch e := cond.(type) {
+	case *ast.LikeExpr:
+		ref, ok1 := e.Expr.(*ast.ColumnRef)
+		p, ok2 := e.Pattern.(*ast.Literal)
+		if !ok1 || !ok2 || e.Not || e.Insensitive || p.Kind != ast.LiteralKindString {
+			return "", "", "", false
+		}
+		i, err := s.resolve(ref)
+		prefix := likePrefix(p.Value)
+		if err != nil || s.kinds[i] != ast.ColumnKindText || prefix == "" {
+			return "", "", "", false
+		}
+		return s.columns[i], prefix, successor(prefix), true
+	case *ast.BetweenExpr:
+		ref, ok := e.Expr.(*ast.ColumnRef)
+		if !ok || e.Not {
+			return "", "", "", false
+		}
+		i, err := s.resolve(ref)
+		if err != nil {
+			return "", "", "", false
+		}
+		low, ok1 := boundKey(s.kinds[i], e.Low)
+		high, ok2 := boundKey(s.kinds[i], e.High)
+		if !ok1 || !ok2 {
+			return "", "", "", false
+		}
+		// the smallest key greater than high
+		return s.columns[i], low, high + "\x00", true
+	}
+	return "", "", "", false
+}
+
+// BoundKey returns the index key of constant e compared with column of kind
+// k, TEXT column is only compared with strings in the order of index keys.
+func boundKey(k ast.ColumnKind, e ast.Expr) (string, bool) {
+	l, ok := e.(*ast.Literal)
+	if !ok || l.Kind == ast.LiteralKindNull || (k == ast.ColumnKindText && l.Kind != ast.LiteralKindString) {
+		return "", false
+	}
+	if k != ast.ColumnKindText && k != ast.ColumnKindInt {
+		return "", false
+	}
+	f, err := parseField(k, l.Value)
+	if err != nil {
+		return "", false
+	}
+	return indexKey(f), true
+}
+
+// Successor returns the smallest string greater than all strings prefixed
+// by s, or empty if there isn't.
+func successor(s string) string {
+	b := []byte(s)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// IndexOrder returns the positions of all rows in the order of keys, which
+// is read from the B-tree index. It only works for one key referring to a
+// column, ok is false if the index can't be used.
+func (t Table) indexOrder(keys []ast.OrderBy) ([]int, bool) {
+	if len(keys) != 1 || t.index == nil {
+		return nil, false
+	}
+	c, ok := keys[0].Expr.(*ast.ColumnRef)
+	if !ok {
+		return nil, false
+	}
+	btree := t.index.getBtree(string(c.Name))
+	if btree == nil {
+		return nil, false
+	}
+	positions, ok := t.positions()
+	if !ok {
+		return nil, false
+	}
+	// rows with the same key are grouped, so the groups are reversed for
+	// descending order and rows in a group keep their order as sort does.
+	groups := make([][]int, 0, t.Len)
+	last := ""
+	for i, k := range btree.Keys() {
+		p, ok := positions[keyLocation(k)]
+		if !ok {
+			return nil, false
+		}
+		if i == 0 || k.Name != last {
+			groups = append(groups, []int{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], p)
+		last = k.Name
+	}
+	if keys[0].Desc {
+		for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+			groups[i], groups[j] = groups[j], groups[i]
+		}
+	}
+	order := make([]int, 0, t.Len)
+	for _, g := range groups {
+		sort.Ints(g)
+		order = append(order, g...)
+	}
+	// fall back to sort if any row isn't indexed
+	if len(order) != t.Len {
+		return nil, false
+	}
+	return order, true
+}
+
+// Sort sorts rows by keys stably, the values of keys are evaluated once for
+// every row before sorting.
+func (s scope) sort(rows []Row, keys []ast.OrderBy) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	type sortedRow struct {
+		row    Row
+		values []interface{}
+	}
+	sorted := make([]sortedRow, 0, len(rows))
+	for _, r := range rows {
+		values := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			v, err := s.eval(k.Expr, r)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		sorted = append(sorted, sortedRow{r, values})
+	}
+	var err error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for k, key := range keys {
+			c, e := compareKey(sorted[i].values[k], sorted[j].values[k], key)
+			if e != nil && err == nil {
+				err = e
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for i, r := range sorted {
+		rows[i] = r.row
+	}
+	return err
+}
+
+// CompareKey compares values of a sort key, NULLs are larger than any other
+// values by default, so they are last in ascending order.
+func compareKey(a, b interface{}, key ast.OrderBy) (int, error) {
+	if a == nil || b == nil {
+		var c int
+		switch {
+		case a == nil && b == nil:
+			return 0, nil
+		case a == nil:
+			c = 1
+		default:
+			c = -1
+		}
+		if key.Nulls == ast.NullsOrderFirst {
+			return -c, nil
+		}
+		if key.Nulls == ast.NullsOrderLast {
+			return c, nil
+		}
+		if key.Desc {
+			return -c, nil
+		}
+		return c, nil
+	}
+	c, err := compare(a, b)
+	if key.Desc {
+		return -c, err
+	}
+	return c, err
+}
+
+// Slice returns the rows in the range of offset and limit.
+func slice(rows []Row, limit, offset ast.Expr) ([]Row, error) {
+	if offset != nil {
+		n, err := count(offset, ErrOffsetInvalid)
+		if err != nil {
+			return nil, err
+		}
+		if n > len(rows) {
+			n = len(rows)
+		}
+		rows = rows[n:]
+	}
+	if limit != nil {
+		n, err := count(limit, ErrLimitInvalid)
+		if err != nil {
+			return nil, err
+		}
+		if n < len(rows) {
+			rows = rows[:n]
+		}
+	}
+	return rows, nil
+}
+
+// Count evaluates the argument of LIMIT or OFFSET, which can't refer to any
+// columns and must be a non-negative integer.
+func count(e ast.Expr, invalid error) (int, error) {
+	v, err := scope{}.eval(e, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", invalid, err)
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("%w: %v", invalid, v)
+	}
+	return int(n), nil
+}
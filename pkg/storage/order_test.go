@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestScopeSort(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testorder1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	name := &ast.ColumnRef{Name: "name"}
+	age := &ast.ColumnRef{Name: "age"}
+
+	tests := []struct {
+		keys  []ast.OrderBy
+		names string
+	}{
+		{[]ast.OrderBy{{Expr: age}}, "dbace"},
+		{[]ast.OrderBy{{Expr: age, Desc: true}}, "eacbd"},
+		{[]ast.OrderBy{{Expr: age, Nulls: ast.NullsOrderFirst}}, "edbac"},
+		{[]ast.OrderBy{{Expr: age, Desc: true, Nulls: ast.NullsOrderLast}}, "acbde"},
+		{[]ast.OrderBy{{Expr: age}, {Expr: name, Desc: true}}, "dbcae"},
+		{[]ast.OrderBy{{Expr: name}}, "abcde"},
+	}
+
+	for i, tt := range tests {
+		rows := []Row{
+			{"a", int64(10)},
+			{"b", int64(9)},
+			{"c", int64(10)},
+			{"d", int64(-1)},
+			{"e", nil},
+		}
+
+		// WHEN
+		err := s.sort(rows, tt.keys)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d failed: %v", i, err)
+		}
+		names := ""
+		for _, r := range rows {
+			names += r[0].(string)
+		}
+		if names != tt.names {
+			t.Errorf("test %d should be sorted as %s, but got %s", i, tt.names, names)
+		}
+	}
+}
+
+func TestScanWithIndexOrder(t *testing.T) {
+	// GIVEN
+	create := &ast.QueryStmtCreateTable{
+		Name: "testorder2",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	if _, err := CreateTable(create); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	insert := &ast.QueryStmtInsertValues{
+		TableName:          "testorder2",
+		Rows:               []ast.Row{values("'wang'", "18"), values("'li'", "9"), values("'zhao'", "100"), values("'qian'", "-3")},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+	table := tables["testorder2"]
+	keys := []ast.OrderBy{{Expr: &ast.ColumnRef{Name: "age"}, Desc: true}}
+
+	// WHEN
+	order, ok := table.indexOrder(keys)
+	rows, err := relation{scope: newScope(table), rows: table.Rows, table: &table}.scan(&ast.CmpExpr{
+		Cmp:   ast.CmpKindGt,
+		Left:  &ast.ColumnRef{Name: "age"},
+		Right: &ast.Literal{Kind: ast.LiteralKindNumber, Value: "0"},
+	}, keys)
+
+	// THEN
+	if !ok {
+		t.Fatalf("rows should be ordered by index")
+	}
+	want := []int{2, 0, 1, 3}
+	for i, o := range order {
+		if o != want[i] {
+			t.Errorf("order[%d] should be %d, but got %d", i, want[i], o)
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to scan rows: %v", err)
+	}
+	if len(rows) != 3 || rows[0][1] != int64(100) || rows[2][1] != int64(9) {
+		t.Errorf("scanned rows are not correct: %v", rows)
+	}
+	if _, ok := table.indexOrder(append(keys, keys...)); ok {
+		t.Errorf("multiple keys shouldn't be ordered by index")
+	}
+}
+
+func TestSlice(t *testing.T) {
+	// GIVEN
+	rows := []Row{{"a"}, {"b"}, {"c"}}
+	number := func(v string) ast.Expr {
+		return &ast.Literal{Kind: ast.LiteralKindNumber, Value: v}
+	}
+
+	tests := []struct {
+		limit  ast.Expr
+		offset ast.Expr
+		rows   int
+		err    error
+	}{
+		{nil, nil, 3, nil},
+		{number("2"), nil, 2, nil},
+		{number("0"), nil, 0, nil},
+		{nil, number("1"), 2, nil},
+		{number("1"), number("1"), 1, nil},
+		{number("10"), number("10"), 0, nil},
+		{number("-1"), nil, 0, ErrLimitInvalid},
+		{nil, number("1.5"), 0, ErrOffsetInvalid},
+		{&ast.ColumnRef{Name: "a"}, nil, 0, ErrLimitInvalid},
+	}
+
+	for i, tt := range tests {
+		// WHEN
+		sliced, err := slice(rows, tt.limit, tt.offset)
+
+		// THEN
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should fail with %v, but got %v", i, tt.err, err)
+		}
+		if len(sliced) != tt.rows {
+			t.Errorf("test %d should get %d rows, but got %d", i, tt.rows, len(sliced))
+		}
+	}
+}
+
+func TestOrderByOutputColumns(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testorder3 (name text, city text, age int)",
+		"insert into testorder3 values ('wang', 'beijing', 30), ('li', 'shanghai', 20), ('zhao', 'beijing', 25), ('sun', 'xian', 40)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"select city, count(*) as n from testorder3 group by city order by n desc, city", []Row{{"beijing", int64(2)}, {"shanghai", int64(1)}, {"xian", int64(1)}}, nil},
+		{"select city, count(*) from testorder3 group by city order by 2, 1 desc", []Row{{"xian", int64(1)}, {"shanghai", int64(1)}, {"beijing", int64(2)}}, nil},
+		{"select name, age from testorder3 order by 2", []Row{{"li", int64(20)}, {"zhao", int64(25)}, {"wang", int64(30)}, {"sun", int64(40)}}, nil},
+		{"select * from testorder3 where age > 20 order by 3 desc", []Row{{"sun", "xian", int64(40)}, {"wang", "beijing", int64(30)}, {"zhao", "beijing", int64(25)}}, nil},
+		// the alias is preferred to the column with the same name
+		{"select name, 50 - age as age from testorder3 order by age limit 2", []Row{{"sun", int64(10)}, {"wang", int64(20)}}, nil},
+		{"select name, age * 2 as double from testorder3 order by double desc limit 1", []Row{{"sun", int64(80)}}, nil},
+		{"select distinct city as c from testorder3 order by c", []Row{{"beijing"}, {"shanghai"}, {"xian"}}, nil},
+		{"select name, rank() over (order by age) as r from testorder3 order by r desc limit 1", []Row{{"sun", int64(4)}}, nil},
+		{"select name from testorder3 where age < 25 union select city from testorder3 where age > 35 order by 1 desc", []Row{{"xian"}, {"li"}}, nil},
+		{"select name, age from testorder3 order by 3", nil, ErrOrderByPosition},
+		{"select name, age from testorder3 order by 0", nil, ErrOrderByPosition},
+		{"select name from testorder3 union select city from testorder3 order by 2", nil, ErrOrderByPosition},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := query(stmt.(ast.Query))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// EvalLike matches the value of expression with pattern, the result is NULL
+// if any of them is NULL.
+func (s scope) evalLike(e *ast.LikeExpr, r Row) (interface{}, error) {
+	v, err := s.eval(e.Expr, r)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.eval(e.Pattern, r)
+	if err != nil || v == nil || p == nil {
+		return nil, err
+	}
+	str, ok1 := v.(string)
+	pattern, ok2 := p.(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%w: %T LIKE %T", ErrExprTypesMismatch, v, p)
+	}
+	if e.Insensitive {
+		str, pattern = strings.ToLower(str), strings.ToLower(pattern)
+	}
+	return like(str, pattern) != e.Not, nil
+}
+
+// EvalIn tests if the value of expression equals to any value of list or
+// subquery.
+func (s scope) evalIn(e *ast.InExpr, r Row) (interface{}, error) {
+	if e.Query != nil {
+		return s.evalInSubquery(e, r)
+	}
+	v, err := s.eval(e.Expr, r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Field, 0, len(e.List))
+	for _, item := range e.List {
+		w, err := s.eval(item, r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, w)
+	}
+	found, err := in(v, values)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return found.(bool) != e.Not, nil
+}
+
+// In tests if v equals to any of values. The result is NULL if v is NULL,
+// or it isn't found but values have NULL, like PostgreSQL. It's false if
+// there isn't any value even if v is NULL.
+func in(v Field, values []Field) (interface{}, error) {
+	if len(values) == 0 {
+		return false, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	null := false
+	for _, w := range values {
+		if w == nil {
+			null = true
+			continue
+		}
+		c, err := compare(v, w)
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			return true, nil
+		}
+	}
+	if null {
+		return nil, nil
+	}
+	return false, nil
+}
+
+// EvalBetween evaluates x BETWEEN low AND high as x >= low AND x <= high.
+func (s scope) evalBetween(e *ast.BetweenExpr, r Row) (interface{}, error) {
+	v, err := s.eval(&ast.LogicExpr{
+		Op:    ast.LogicOpAnd,
+		Left:  &ast.CmpExpr{Cmp: ast.CmpKindGte, Left: e.Expr, Right: e.Low},
+		Right: &ast.CmpExpr{Cmp: ast.CmpKindLte, Left: e.Expr, Right: e.High},
+	}, r)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(bool) != e.Not, nil
+}
+
+// Like reports whether s matches pattern, % matches any sequence of
+// characters, _ matches any single character, and backslash escapes the
+// next character.
+func like(s, pattern string) bool {
+	str, p := []rune(s), []rune(pattern)
+	// the positions to retry from when the last % matches one more character
+	star, retry := -1, 0
+	i, j := 0, 0
+	for i < len(str) {
+		switch {
+		case j < len(p) && p[j] == '%':
+			star, retry = j, i
+			j++
+			continue
+		case j < len(p) && p[j] == '_':
+			i++
+			j++
+			continue
+		case j < len(p):
+			c := p[j]
+			next := j + 1
+			if c == '\\' && j+1 < len(p) {
+				c, next = p[j+1], j+2
+			}
+			if c == str[i] {
+				i++
+				j = next
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		retry++
+		i, j = retry, star+1
+	}
+	for j < len(p) && p[j] == '%' {
+		j++
+	}
+	return j == len(p)
+}
+
+// LikePrefix returns the fixed prefix of pattern before the first wildcard,
+// the escaped characters are unescaped.
+func likePrefix(pattern string) string {
+	var sb strings.Builder
+	p := []rune(pattern)
+	for j := 0; j < len(p); j++ {
+		switch p[j] {
+		case '%', '_':
+			return sb.String()
+		case '\\':
+			if j+1 < len(p) {
+				j++
+			}
+		}
+		sb.WriteRune(p[j])
+	}
+	return sb.String()
+}
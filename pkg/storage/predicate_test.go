@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+	"golang.org/x/exp/slices"
+)
+
+func TestLike(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		ok         bool
+		prefix     string
+	}{
+		{"walker", "walker", true, "walker"},
+		{"walker", "wa%", true, "wa"},
+		{"walker", "%er", true, ""},
+		{"walker", "w%k%r", true, "w"},
+		{"walker", "w_lker", true, "w"},
+		{"walker", "w_ker", false, "w"},
+		{"walker", "%", true, ""},
+		{"", "%", true, ""},
+		{"", "_", false, ""},
+		{"walker", "wa", false, "wa"},
+		{"a%b", "a\\%%", true, "a%"},
+		{"ab", "a\\%%", false, "a%"},
+		{"北京市", "北_市", true, "北"},
+		{"aaab", "%a%ab", true, ""},
+	}
+
+	for i, tt := range tests {
+		if ok := like(tt.s, tt.pattern); ok != tt.ok {
+			t.Errorf("test %d: %q LIKE %q should be %v, but got %v", i, tt.s, tt.pattern, tt.ok, ok)
+		}
+		if prefix := likePrefix(tt.pattern); prefix != tt.prefix {
+			t.Errorf("test %d: prefix of %q should be %q, but got %q", i, tt.pattern, tt.prefix, prefix)
+		}
+	}
+}
+
+func TestScopeEvalPredicates(t *testing.T) {
+	// GIVEN
+	table := Table{
+		Name: "testpredicate1",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+			{Name: "city", Kind: ast.ColumnKindText},
+		},
+	}
+	table.setColumnNames()
+	s := newScope(table)
+	row := Row{"Walker", int64(18), nil}
+
+	tests := []struct {
+		source string
+		value  interface{}
+	}{
+		{"name LIKE 'Wa%'", true},
+		{"name LIKE 'wa%'", false},
+		{"name ILIKE 'wa%'", true},
+		{"name NOT LIKE '%er'", false},
+		{"name NOT ILIKE 'W_LKER'", false},
+		{"city LIKE '%'", nil},
+		{"age IN (1, 18)", true},
+		{"age IN (1, 2)", false},
+		{"age NOT IN (1, 2)", true},
+		{"age IN (1, NULL)", nil},
+		{"age IN (18, NULL)", true},
+		{"city IN ('x')", nil},
+		{"age BETWEEN 18 AND 20", true},
+		{"age BETWEEN 10 + 9 AND 20", false},
+		{"age NOT BETWEEN 1 AND 10", true},
+		{"age BETWEEN 1 AND NULL", nil},
+		{"age BETWEEN 20 AND NULL", false},
+		{"age BETWEEN 1 AND 20 AND name LIKE 'W%'", true},
+	}
+
+	// WHEN
+	for i, tt := range tests {
+		e, err := parser.ParseExpr(tt.source)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.source, err)
+		}
+		v, err := s.eval(e, row)
+
+		// THEN
+		if err != nil {
+			t.Errorf("test %d: eval %q failed: %v", i, tt.source, err)
+		}
+		if v != tt.value {
+			t.Errorf("test %d: %q should be %v, but got %v", i, tt.source, tt.value, v)
+		}
+	}
+}
+
+func TestScanWithIndexRange(t *testing.T) {
+	// GIVEN
+	create := &ast.QueryStmtCreateTable{
+		Name: "testpredicate2",
+		Columns: []ast.Column{
+			{Name: "name", Kind: ast.ColumnKindText},
+			{Name: "age", Kind: ast.ColumnKindInt},
+		},
+	}
+	if _, err := CreateTable(create); err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	insert := &ast.QueryStmtInsertValues{
+		TableName: "testpredicate2",
+		Rows: []ast.Row{
+			values("'wang'", "18"), values("'li'", "9"), values("'walker'", "100"),
+			values("'wangxin'", "-3"), values("'zhao'", "20"), values("NULL", "NULL"),
+		},
+		ContainsAllColumns: true,
+	}
+	if _, err := Insert(insert); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+	table := tables["testpredicate2"]
+	r := relation{scope: newScope(table), rows: table.Rows, table: &table}
+
+	tests := []struct {
+		where string
+		// positions found by index, nil if index isn't used
+		found []int
+		names []string
+	}{
+		{"name LIKE 'wang%'", []int{0, 3}, []string{"wang", "wangxin"}},
+		{"name LIKE 'wa%er' AND age > 0", []int{0, 2, 3}, []string{"walker"}},
+		{"age > 0 AND age BETWEEN 9 AND 20", []int{0, 1, 4}, []string{"wang", "li", "zhao"}},
+		{"age BETWEEN -3 AND '18'", []int{0, 1, 3}, []string{"wang", "li", "wangxin"}},
+		{"age BETWEEN 20 AND 9", []int{}, []string{}},
+		{"name LIKE '%g'", nil, []string{"wang"}},
+		{"name ILIKE 'WANG%'", nil, []string{"wang", "wangxin"}},
+		{"name NOT LIKE 'w%'", nil, []string{"li", "zhao"}},
+		{"age BETWEEN 9.5 AND 20", nil, []string{"wang", "zhao"}},
+		{"age NOT BETWEEN 9 AND 20", nil, []string{"walker", "wangxin"}},
+	}
+
+	for i, tt := range tests {
+		where, err := parser.ParseExpr(tt.where)
+		if err != nil {
+			t.Fatalf("test %d: parse %q failed: %v", i, tt.where, err)
+		}
+
+		// WHEN
+		found, ok := table.indexRange(r.scope, where)
+		rows, err := r.scan(where, nil)
+
+		// THEN
+		if ok != (tt.found != nil) || (ok && !slices.Equal(found, tt.found)) {
+			t.Errorf("test %d: %q should find %v by index, but got %v, %v", i, tt.where, tt.found, found, ok)
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to scan rows: %v", i, err)
+		}
+		names := make([]string, 0, len(rows))
+		for _, row := range rows {
+			names = append(names, row[0].(string))
+		}
+		if !slices.Equal(names, tt.names) {
+			t.Errorf("test %d: %q should get %v, but got %v", i, tt.where, tt.names, names)
+		}
+	}
+}
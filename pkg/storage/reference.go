@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrForeignKeyInvalid    = errors.New("foreign key doesn't match primary key or unique constraint of referenced table")
+	ErrForeignKeyViolated   = errors.New("insert or update violates foreign key constraint")
+	ErrForeignKeyReferenced = errors.New("update or delete violates foreign key constraint")
+	ErrTableReferenced      = errors.New("table is referenced by foreign key constraint")
+)
+
+// Reference is a FOREIGN KEY of table referencing another table or itself.
+type reference struct {
+	table      string
+	constraint ast.Constraint
+}
+
+// ReferencedColumns returns the columns referenced by FOREIGN KEY c, which
+// are the primary key of referenced table if they're not specified. They
+// must be the primary key or unique columns of referenced table.
+func (t Table) referencedColumns(c ast.Constraint) ([]ast.ColumnName, error) {
+	parent, ok := tables[c.RefTable]
+	if c.RefTable == t.Name {
+		parent, ok = t, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotExisted, c.RefTable)
+	}
+	columns := c.RefColumns
+	if len(columns) == 0 {
+		for _, k := range parent.Constraints {
+			if k.Kind == ast.ConstraintKindPrimaryKey {
+				columns = k.Columns
+			}
+		}
+	}
+	if len(columns) != len(c.Columns) {
+		return nil, fmt.Errorf("%w: %s", ErrForeignKeyInvalid, c.RefTable)
+	}
+	for i, n := range columns {
+		j := parent.columnIndex(n)
+		if j < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrColumnNotExisted, n)
+		}
+		if parent.Columns[j].Kind != t.Columns[t.columnIndex(c.Columns[i])].Kind {
+			return nil, fmt.Errorf("%w, column %s", ErrForeignKeyInvalid, c.Columns[i])
+		}
+	}
+	for _, k := range parent.Constraints {
+		if k.Kind != ast.ConstraintKindForeignKey && slices.Equal(k.Columns, columns) {
+			return slices.Clone(columns), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrForeignKeyInvalid, c.RefTable)
+}
+
+// CheckForeignKey checks if the keys of rows exist in the table referenced by
+// FOREIGN KEY c, the keys containing NULL aren't checked. If the table refers
+// to itself, the keys can be referenced by rows too, but not the rows at skip
+// which are replaced by rows.
+func (t Table) checkForeignKey(c ast.Constraint, rows []Row, skip []int) error {
+	self := c.RefTable == t.Name
+	parent := tables[c.RefTable]
+	if self {
+		parent = t
+	}
+	columns := t.columnIndexes(c.Columns)
+	refColumns := parent.columnIndexes(c.RefColumns)
+	positions, indexed := parent.positions()
+	for _, r := range rows {
+		key := r.key(columns)
+		if slices.Contains(key, nil) {
+			continue
+		}
+		found, err := parent.findKey(refColumns, key, positions, indexed)
+		if err != nil {
+			return err
+		}
+		if self {
+			found = exclude(found, skip)
+		}
+		if len(found) == 0 && !(self && containsKey(rows, refColumns, key)) {
+			return fmt.Errorf("%w: %s", ErrForeignKeyViolated, c.Name)
+		}
+	}
+	return nil
+}
+
+// ContainsKey reports whether any of rows has key at columns.
+func containsKey(rows []Row, columns []int, key []Field) bool {
+	return slices.ContainsFunc(rows, func(r Row) bool { return hashKey(r.key(columns)) == hashKey(key) })
+}
+
+// Exclude returns the positions of rows not in skip.
+func exclude(rows, skip []int) []int {
+	kept := make([]int, 0, len(rows))
+	for _, i := range rows {
+		if !slices.Contains(skip, i) {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// References returns the FOREIGN KEYs referencing table t, including the ones
+// of t itself, which are sorted by the names of referencing tables.
+func (t Table) references() []reference {
+	names := make([]string, 0, len(tables))
+	for n := range tables {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	refs := make([]reference, 0)
+	for _, n := range names {
+		constraints := tables[n].Constraints
+		if n == t.Name {
+			constraints = t.Constraints
+		}
+		for _, c := range constraints {
+			if c.Kind == ast.ConstraintKindForeignKey && c.RefTable == t.Name {
+				refs = append(refs, reference{table: n, constraint: c})
+			}
+		}
+	}
+	return refs
+}
+
+// ReferencingTable returns the table of FOREIGN KEY ref, which is t itself
+// if t refers to itself.
+func (t *Table) referencingTable(ref reference) *Table {
+	if ref.table == t.Name {
+		return t
+	}
+	child := tables[ref.table]
+	return &child
+}
+
+// ReferencingRows returns the positions of rows in child referencing each row
+// of olds by FOREIGN KEY ref. The rows of olds whose keys contain NULL or are
+// unchanged in news are skipped, news is nil if olds are deleted. The rows at
+// skip are skipped too if t refers to itself.
+func (t *Table) referencingRows(ref reference, child *Table, olds, news []Row, skip []int) ([][]int, error) {
+	refColumns := t.columnIndexes(ref.constraint.RefColumns)
+	columns := child.columnIndexes(ref.constraint.Columns)
+	positions, indexed := child.positions()
+	found := make([][]int, len(olds))
+	for j, r := range olds {
+		key := r.key(refColumns)
+		if slices.Contains(key, nil) || (news != nil && hashKey(key) == hashKey(news[j].key(refColumns))) {
+			continue
+		}
+		rows, err := child.findKey(columns, key, positions, indexed)
+		if err != nil {
+			return nil, err
+		}
+		if child == t {
+			rows = exclude(rows, skip)
+		}
+		found[j] = rows
+	}
+	return found, nil
+}
+
+// RestrictReferences checks if rows olds at skip are still referenced by the
+// FOREIGN KEYs with NO ACTION or RESTRICT before they're deleted, or updated
+// to news. It's checked before the referencing rows are changed.
+func (t *Table) restrictReferences(olds, news []Row, skip []int) error {
+	for _, ref := range t.references() {
+		action := ref.constraint.OnDelete
+		if news != nil {
+			action = ref.constraint.OnUpdate
+		}
+		if action != ast.ReferentialActionNoAction && action != ast.ReferentialActionRestrict {
+			continue
+		}
+		found, err := t.referencingRows(ref, t.referencingTable(ref), olds, news, skip)
+		if err != nil {
+			return err
+		}
+		for _, rows := range found {
+			if len(rows) > 0 {
+				return fmt.Errorf("%w: %s on table %s", ErrForeignKeyReferenced, ref.constraint.Name, ref.table)
+			}
+		}
+	}
+	return nil
+}
+
+// CascadeReferences applies CASCADE and SET NULL actions of the FOREIGN KEYs
+// referencing rows olds, which are deleted or updated to news. The rows
+// referencing olds are deleted or updated to the new keys by CASCADE, or
+// their keys are set to NULL by SET NULL.
+func (t *Table) cascadeReferences(olds, news []Row) error {
+	refs := t.references()
+	if len(refs) == 0 {
+		return nil
+	}
+	// the referencing rows are checked with the changed rows of t
+	tables[t.Name] = *t
+	for _, ref := range refs {
+		action := ref.constraint.OnDelete
+		if news != nil {
+			action = ref.constraint.OnUpdate
+		}
+		if action != ast.ReferentialActionCascade && action != ast.ReferentialActionSetNull {
+			continue
+		}
+		child := t.referencingTable(ref)
+		found, err := t.referencingRows(ref, child, olds, news, nil)
+		if err != nil {
+			return err
+		}
+		deleted := make([]int, 0)
+		refColumns := t.columnIndexes(ref.constraint.RefColumns)
+		for j, rows := range found {
+			if len(rows) == 0 {
+				continue
+			}
+			if news == nil && action == ast.ReferentialActionCascade {
+				deleted = append(deleted, rows...)
+				continue
+			}
+			values := make([]ast.ColumnUpdatedValue, 0, len(refColumns))
+			for k, n := range ref.constraint.Columns {
+				v := ast.Expr(&ast.Literal{Kind: ast.LiteralKindNull})
+				if action == ast.ReferentialActionCascade {
+					v = fieldLiteral(news[j][refColumns[k]])
+				}
+				values = append(values, ast.ColumnUpdatedValue{Name: n, Value: v})
+			}
+			updated, err := child.updated(rows, values, newScope(*child), nil)
+			if err != nil {
+				return err
+			}
+			if err := child.replace(rows, updated); err != nil {
+				return err
+			}
+		}
+		if len(deleted) > 0 {
+			slices.Sort(deleted)
+			if err := child.remove(slices.Compact(deleted)); err != nil {
+				return err
+			}
+		}
+		tables[child.Name] = *child
+	}
+	return nil
+}
+
+// Rehearse runs fn, which deletes or updates rows of t, with the copies of
+// all tables first if t is referenced by any FOREIGN KEY. The rows of copies
+// are changed only in memory, so that the actions failed at any table along
+// the cascade leave all tables unchanged. fn is run with t if it succeeds.
+func (t *Table) rehearse(fn func(t *Table) error) error {
+	if len(t.references()) == 0 {
+		return fn(t)
+	}
+	saved := tables
+	tables = make(map[string]Table, len(saved))
+	for n, o := range saved {
+		tables[n] = o.rehearsal()
+	}
+	r := t.rehearsal()
+	err := fn(&r)
+	tables = saved
+	if err != nil {
+		return err
+	}
+	return fn(t)
+}
+
+// Rehearsal returns the copy of t whose rows are changed only in memory, the
+// copy has no locations and indexes, so rows are searched by comparing all.
+func (t Table) rehearsal() Table {
+	t.Rows = slices.Clone(t.Rows)
+	t.locations = nil
+	t.index = nil
+	t.rehearsed = true
+	return t
+}
+
+// CheckReferenced checks if t is referenced by the FOREIGN KEYs of the tables
+// other than t and excepts, it's checked before t is dropped or truncated.
+func (t Table) checkReferenced(excepts []string) error {
+	for _, ref := range t.references() {
+		if ref.table != t.Name && !slices.Contains(excepts, ref.table) {
+			return fmt.Errorf("%w: %s on table %s", ErrTableReferenced, ref.constraint.Name, ref.table)
+		}
+	}
+	return nil
+}
+
+// AlterReferences changes the FOREIGN KEYs of other tables referencing t by
+// fn, and saves the schemes of these tables.
+func (t Table) alterReferences(fn func(c *ast.Constraint)) error {
+	for n, o := range tables {
+		if n == t.Name {
+			continue
+		}
+		constraints := make([]ast.Constraint, 0, len(o.Constraints))
+		changed := false
+		for _, c := range o.Constraints {
+			if c.Kind == ast.ConstraintKindForeignKey && c.RefTable == t.Name {
+				fn(&c)
+				changed = true
+			}
+			constraints = append(constraints, c)
+		}
+		if changed {
+			o.Constraints = constraints
+			if err := o.saveScheme(); err != nil {
+				return err
+			}
+			tables[n] = o
+		}
+	}
+	return nil
+}
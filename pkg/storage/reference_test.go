@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// Returns the FOREIGN KEY of column pid referencing table n.
+func foreignKey(n string, onDelete, onUpdate ast.ReferentialAction) []ast.Constraint {
+	return []ast.Constraint{{Kind: ast.ConstraintKindForeignKey, Columns: []ast.ColumnName{"pid"}, RefTable: n, OnDelete: onDelete, OnUpdate: onUpdate}}
+}
+
+// Returns the condition id = v.
+func idEquals(v string) ast.Expr {
+	return &ast.CmpExpr{Cmp: ast.CmpKindEq, Left: &ast.ColumnRef{Name: "id"}, Right: value(v)}
+}
+
+func TestInsertWithForeignKey(t *testing.T) {
+	// GIVEN
+	execAll(t,
+		"create table testparent1 (id int primary key, name text unique, age int default 18)",
+		"insert into testparent1 values (1, 'wang', 20)",
+		"create table testchild1 (id int, pid int references testparent1)",
+	)
+
+	// WHEN
+	tests := []struct {
+		stmt ast.QueryStmt
+		err  error
+	}{
+		{&ast.QueryStmtInsertValues{TableName: "testchild1", Rows: []ast.Row{values("10", "1"), values("11", "NULL")}, ContainsAllColumns: true}, nil},
+		{&ast.QueryStmtInsertValues{TableName: "testchild1", Rows: []ast.Row{values("12", "2")}, ContainsAllColumns: true}, ErrForeignKeyViolated},
+		{&ast.QueryStmtUpdateValues{TableName: "testchild1", Values: []ast.ColumnUpdatedValue{{Name: "pid", Value: value("2")}}, Where: idEquals("11")}, ErrForeignKeyViolated},
+		{&ast.QueryStmtUpdateValues{TableName: "testchild1", Values: []ast.ColumnUpdatedValue{{Name: "pid", Value: value("1")}}, Where: idEquals("11")}, nil},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		var err error
+		switch s := tt.stmt.(type) {
+		case *ast.QueryStmtInsertValues:
+			_, err = Insert(s)
+		case *ast.QueryStmtUpdateValues:
+			_, err = Update(s)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: test %d should get err %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+	want := []Row{{int64(10), int64(1)}, {int64(11), int64(1)}}
+	if rows := tables["testchild1"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s: then: rows should be %v, but got %v", t.Name(), want, rows)
+	}
+
+	// THEN, the referenced columns are resolved and saved in scheme
+	loadScheme("testchild1.json")
+	c := tables["testchild1"].Constraints[0]
+	if c.Name != "testchild1_pid_fkey" || !reflect.DeepEqual(c.RefColumns, []ast.ColumnName{"id"}) {
+		t.Errorf("%s: then: foreign key should reference id, but got %v", t.Name(), c)
+	}
+}
+
+func TestForeignKeyActions(t *testing.T) {
+	// GIVEN
+	execAll(t,
+		"create table testparent2 (id int primary key, name text unique, age int default 18)",
+		"insert into testparent2 (id) values (1), (2), (3)",
+		"create table testchild2 (id int, pid int references testparent2 on delete cascade on update cascade)",
+		"insert into testchild2 values (10, 1), (11, 2)",
+		"create table testchild3 (id int, pid int references testparent2 on delete set null on update set null)",
+		"insert into testchild3 values (20, 2)",
+		"create table testchild4 (id int, pid int references testparent2 on delete restrict)",
+		"insert into testchild4 values (30, 3)",
+	)
+
+	// WHEN
+	tests := []struct {
+		stmt ast.QueryStmt
+		err  error
+	}{
+		{&ast.QueryStmtUpdateValues{TableName: "testparent2", Values: []ast.ColumnUpdatedValue{{Name: "id", Value: value("4")}}, Where: idEquals("1")}, nil},
+		{&ast.QueryStmtDeleteValues{TableName: "testparent2", Where: idEquals("2")}, nil},
+		{&ast.QueryStmtDeleteValues{TableName: "testparent2", Where: idEquals("3")}, ErrForeignKeyReferenced},
+		{&ast.QueryStmtUpdateValues{TableName: "testparent2", Values: []ast.ColumnUpdatedValue{{Name: "id", Value: value("6")}}, Where: idEquals("3")}, ErrForeignKeyReferenced},
+		{&ast.QueryStmtUpdateValues{TableName: "testparent2", Values: []ast.ColumnUpdatedValue{{Name: "age", Value: value("30")}}, Where: idEquals("3")}, nil},
+	}
+	for i, tt := range tests {
+		var err error
+		switch s := tt.stmt.(type) {
+		case *ast.QueryStmtUpdateValues:
+			_, err = Update(s)
+		case *ast.QueryStmtDeleteValues:
+			_, err = Delete(s)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: when: test %d should get err %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+
+	// THEN
+	wants := map[string][]Row{
+		"testparent2": {{int64(4), nil, int64(18)}, {int64(3), nil, int64(30)}},
+		"testchild2":  {{int64(10), int64(4)}},
+		"testchild3":  {{int64(20), nil}},
+		"testchild4":  {{int64(30), int64(3)}},
+	}
+	for n, want := range wants {
+		table := tables[n]
+		rows, err := table.loadRows()
+		if err != nil {
+			t.Fatalf("%s: then: failed to load rows of %s: %v", t.Name(), n, err)
+		}
+		if !reflect.DeepEqual(table.Rows, want) || len(rows) != len(want) {
+			t.Errorf("%s: then: rows of %s should be %v, but got %v and loaded %v", t.Name(), n, want, table.Rows, rows)
+		}
+	}
+}
+
+func TestForeignKeyCascadeFailed(t *testing.T) {
+	// GIVEN
+	execAll(t,
+		"create table testparent5 (id int primary key)",
+		"insert into testparent5 values (1), (2)",
+		"create table testchild7 (id int primary key, pid int references testparent5 on delete cascade on update cascade)",
+		"insert into testchild7 values (10, 1), (20, 2)",
+		"create table testchild8 (id int, cid int references testchild7)",
+		"insert into testchild8 values (100, 10)",
+	)
+
+	// WHEN, the row cascaded to is still referenced
+	if _, err := exec("delete from testparent5 where id = 1"); !errors.Is(err, ErrForeignKeyReferenced) {
+		t.Fatalf("%s: when: delete should fail with %v, but got %v", t.Name(), ErrForeignKeyReferenced, err)
+	}
+
+	// THEN, no table is changed, neither in memory nor after reloading
+	wants := map[string][]Row{
+		"testparent5": {{int64(1)}, {int64(2)}},
+		"testchild7":  {{int64(10), int64(1)}, {int64(20), int64(2)}},
+		"testchild8":  {{int64(100), int64(10)}},
+	}
+	for n, want := range wants {
+		if rows := tables[n].Rows; !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s: then: rows of %s should be %v, but got %v", t.Name(), n, want, rows)
+		}
+	}
+	loadSchemes()
+	load()
+	for n, want := range wants {
+		if rows := tables[n].Rows; !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s: then: loaded rows of %s should be %v, but got %v", t.Name(), n, want, rows)
+		}
+	}
+
+	// THEN, the cascade which isn't referenced is applied to all tables
+	if _, err := exec("update testparent5 set id = 3 where id = 1"); err != nil {
+		t.Fatalf("%s: then: update should ok, but got err: %v", t.Name(), err)
+	}
+	want := []Row{{int64(10), int64(3)}, {int64(20), int64(2)}}
+	if rows := tables["testchild7"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("%s: then: rows of testchild7 should be %v, but got %v", t.Name(), want, rows)
+	}
+}
+
+func TestSelfReferencingForeignKey(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testtree (id int primary key, pid int references testtree on delete cascade)")
+
+	// WHEN, the rows reference the rows inserted together
+	execAll(t, "insert into testtree values (1, NULL), (2, 1), (3, 2)")
+
+	// THEN
+	if _, err := Delete(&ast.QueryStmtDeleteValues{TableName: "testtree", Where: idEquals("1")}); err != nil {
+		t.Fatalf("%s: then: delete should ok, but got err: %v", t.Name(), err)
+	}
+	if rows := tables["testtree"].Rows; len(rows) != 0 {
+		t.Errorf("%s: then: rows should be deleted by cascade, but got %v", t.Name(), rows)
+	}
+}
+
+func TestForeignKeyFailed(t *testing.T) {
+	// GIVEN
+	execAll(t, "create table testparent3 (id int primary key, name text unique, age int default 18)")
+	execAll(t, "create table testchild5 (id int, pid int references testparent3)")
+
+	// WHEN
+	ints := []ast.Column{{Name: "id", Kind: ast.ColumnKindInt}, {Name: "pid", Kind: ast.ColumnKindInt}}
+	texts := []ast.Column{{Name: "id", Kind: ast.ColumnKindInt}, {Name: "pid", Kind: ast.ColumnKindText}}
+	tests := []struct {
+		stmt ast.QueryStmt
+		err  error
+	}{
+		{&ast.QueryStmtCreateTable{Name: "testchild6", Columns: ints, Constraints: foreignKey("testparentx", 0, 0)}, ErrTableNotExisted},
+		{&ast.QueryStmtCreateTable{Name: "testchild6", Columns: ints, Constraints: foreignKey("testchild5", 0, 0)}, ErrForeignKeyInvalid},
+		{&ast.QueryStmtCreateTable{Name: "testchild6", Columns: texts, Constraints: foreignKey("testparent3", 0, 0)}, ErrForeignKeyInvalid},
+		{&ast.QueryStmtCreateTable{Name: "testchild6", Columns: ints, Constraints: []ast.Constraint{
+			{Kind: ast.ConstraintKindForeignKey, Columns: []ast.ColumnName{"pid"}, RefTable: "testparent3", RefColumns: []ast.ColumnName{"age"}},
+		}}, ErrForeignKeyInvalid},
+		{&ast.QueryStmtDropTable{TableNames: []string{"testparent3"}}, ErrTableReferenced},
+		{&ast.QueryStmtTruncateTable{TableNames: []string{"testparent3"}}, ErrTableReferenced},
+		{&ast.QueryStmtAlterTable{TableName: "testparent3", Action: ast.AlterTableActionDropColumn, ColumnName: "id"}, ErrTableReferenced},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		var err error
+		switch s := tt.stmt.(type) {
+		case *ast.QueryStmtCreateTable:
+			_, err = CreateTable(s)
+		case *ast.QueryStmtDropTable:
+			_, err = DropTable(s)
+		case *ast.QueryStmtTruncateTable:
+			_, err = Truncate(s)
+		case *ast.QueryStmtAlterTable:
+			_, err = AlterTable(s)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: then: test %d should fail with %v, but got %v", t.Name(), i, tt.err, err)
+		}
+	}
+
+	// WHEN, renames referenced table and column
+	alters := []*ast.QueryStmtAlterTable{
+		{TableName: "testparent3", Action: ast.AlterTableActionRenameColumn, ColumnName: "id", NewName: "no"},
+		{TableName: "testparent3", Action: ast.AlterTableActionRenameTable, NewName: "testparent4"},
+	}
+	for _, a := range alters {
+		if _, err := AlterTable(a); err != nil {
+			t.Fatalf("%s: when: alter should ok, but got err: %v", t.Name(), err)
+		}
+	}
+
+	// THEN
+	c := tables["testchild5"].Constraints[0]
+	if c.RefTable != "testparent4" || !reflect.DeepEqual(c.RefColumns, []ast.ColumnName{"no"}) {
+		t.Errorf("%s: then: foreign key should reference testparent4(no), but got %v", t.Name(), c)
+	}
+	drop := &ast.QueryStmtDropTable{TableNames: []string{"testparent4", "testchild5"}}
+	if _, err := DropTable(drop); err != nil {
+		t.Errorf("%s: then: dropping tables together should ok, but got err: %v", t.Name(), err)
+	}
+}
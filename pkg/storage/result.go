@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+// Result is the result of executing a statement. Storage never prints it, so
+// the callers like REPL, tests or any network front-end can render it.
+type Result struct {
+	// Columns describes the returned rows, it's empty if no rows returned.
+	Columns []ast.Column
+	Rows    []Row
+	// Tag is the command tag like PostgreSQL, such as INSERT 0 2, SELECT 3.
+	Tag string
+	// Affected is the number of rows inserted, selected, updated or deleted.
+	Affected int
+}
+
+// Returns result for statements without affecting rows, like CREATE TABLE.
+func commandResult(tag string) *Result {
+	return &Result{Tag: tag}
+}
+
+// Returns result for statements affecting n rows, the tag is composed with
+// command and n, except INSERT which has an extra 0 for oid like PostgreSQL.
+func affectedResult(command string, n int) *Result {
+	if command == "INSERT" {
+		return &Result{Tag: fmt.Sprintf("%s 0 %d", command, n), Affected: n}
+	}
+	return &Result{Tag: fmt.Sprintf("%s %d", command, n), Affected: n}
+}
+
+// Returns result for SELECT statement with columns and rows.
+func selectedResult(columns []ast.Column, rows []Row) *Result {
+	return &Result{
+		Columns:  columns,
+		Rows:     rows,
+		Tag:      fmt.Sprintf("SELECT %d", len(rows)),
+		Affected: len(rows),
+	}
+}
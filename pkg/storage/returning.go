@@ -0,0 +1,48 @@
+package storage
+
+import "github.com/wangwalker/gpostgres/pkg/ast"
+
+// Returning is the checked RETURNING clause of INSERT, UPDATE or DELETE, its
+// columns are evaluated with scope after the rows are written.
+type returning struct {
+	scope    scope
+	columns  []ast.Column
+	selected []ast.SelectColumn
+}
+
+// Returning checks the columns of RETURNING clause r with scope s before any
+// row is written, so that an invalid clause doesn't leave the table changed.
+// It returns nil if r is nil.
+func (s scope) returning(r *ast.Returning) (*returning, error) {
+	if r == nil {
+		return nil, nil
+	}
+	selected := r.Columns
+	if r.ContainsAllColumns {
+		selected = s.selectAll()
+	}
+	columns := make([]ast.Column, 0, len(selected))
+	for _, c := range selected {
+		if err := s.check(c.Expr); err != nil {
+			return nil, err
+		}
+		columns = append(columns, ast.Column{Name: columnName(c), Kind: s.kind(c.Expr)})
+	}
+	return &returning{scope: s, columns: columns, selected: selected}, nil
+}
+
+// Result returns the result of command which affects rows, the rows are
+// returned with the columns of RETURNING clause if r isn't nil, but the tag
+// is still the one of command like INSERT 0 2.
+func (r *returning) result(command string, rows []Row) (*Result, error) {
+	affected := affectedResult(command, len(rows))
+	if r == nil {
+		return affected, nil
+	}
+	res, err := r.scope.project(r.columns, r.selected, rows)
+	if err != nil {
+		return nil, err
+	}
+	res.Tag = affected.Tag
+	return res, nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+func TestReturning(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testreturning1 (id int, name text, score int default 60)",
+		"create table testreturning2 (uid int, bonus int)",
+		"insert into testreturning2 values (2, 5), (3, 8)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source  string
+		columns []ast.ColumnName
+		rows    []Row
+		tag     string
+		err     error
+	}{
+		// the default values are returned too
+		{"insert into testreturning1 (name, id) values ('walker', 1), ('molly', 2) returning *",
+			[]ast.ColumnName{"id", "name", "score"}, []Row{{int64(1), "walker", int64(60)}, {int64(2), "molly", int64(60)}}, "INSERT 0 2", nil},
+		{"insert into testreturning1 select uid + 1, 'bob', bonus from testreturning2 where uid = 2 returning id, upper(name) as name",
+			[]ast.ColumnName{"id", "name"}, []Row{{int64(3), "BOB"}}, "INSERT 0 1", nil},
+		// the new versions are returned with the rows of FROM clause
+		{"update testreturning1 t set score = score + b.bonus from testreturning2 b where t.id = b.uid returning t.id, score, b.bonus",
+			[]ast.ColumnName{"id", "score", "bonus"}, []Row{{int64(2), int64(65), int64(5)}, {int64(3), int64(13), int64(8)}}, "UPDATE 2", nil},
+		{"update testreturning1 set name = name || '!' where id = 1 returning name",
+			[]ast.ColumnName{"name"}, []Row{{"walker!"}}, "UPDATE 1", nil},
+		{"update testreturning1 set score = 0 where id > 10 returning id",
+			[]ast.ColumnName{"id"}, []Row{}, "UPDATE 0", nil},
+		{"delete from testreturning1 where score < 60 returning id, score * 2",
+			[]ast.ColumnName{"id", "?column?"}, []Row{{int64(3), int64(26)}}, "DELETE 1", nil},
+		{"insert into testreturning1 values (4, 'alice') returning nothing", nil, nil, "", ErrColumnNamesNotMatched},
+		{"insert into testreturning1 values (4, 'alice') returning count(*)", nil, nil, "", ErrAggregateMisplaced},
+		{"update testreturning1 set score = 0 returning bonus", nil, nil, "", ErrColumnNamesNotMatched},
+		{"delete from testreturning1 returning nothing", nil, nil, "", ErrColumnNamesNotMatched},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		r, err := exec(tt.source)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		columns := make([]ast.ColumnName, 0, len(r.Columns))
+		for _, c := range r.Columns {
+			columns = append(columns, c.Name)
+		}
+		if !reflect.DeepEqual(columns, tt.columns) {
+			t.Errorf("test %d should get columns %v, but got %v", i, tt.columns, columns)
+		}
+		if !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+		if r.Tag != tt.tag {
+			t.Errorf("test %d should get tag %s, but got %s", i, tt.tag, r.Tag)
+		}
+	}
+	// the failed statements don't change the table
+	rows := []Row{{int64(1), "walker!", int64(60)}, {int64(2), "molly", int64(65)}}
+	if got := tables["testreturning1"].Rows; !reflect.DeepEqual(got, rows) {
+		t.Errorf("rows should be %v, but got %v", rows, got)
+	}
+}
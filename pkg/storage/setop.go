@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrSetColumnsNotMatched = errors.New("each query of set operation must have the same number of columns")
+	ErrSetKindsNotMatched   = errors.New("types of set operation cannot be matched")
+)
+
+// Combine runs set operation of queries, the rows of both queries are
+// combined by UNION, INTERSECT or EXCEPT like multisets with ALL, otherwise
+// like sets whose rows are distinct. The columns are named by the left query,
+// and their kinds must be compatible.
+func Combine(stmt *ast.QueryStmtSetOperation) (*Result, error) {
+	left, err := query(stmt.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := query(stmt.Right)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := combinedColumns(left.Columns, right.Columns)
+	if err != nil {
+		return nil, err
+	}
+	lrows, rrows := cast(left.Rows, columns), cast(right.Rows, columns)
+	var rows []Row
+	switch stmt.Op {
+	case ast.SetOpUnion:
+		rows = append(lrows, rrows...)
+	case ast.SetOpIntersect, ast.SetOpExcept:
+		// the rows of right side by their hash keys
+		counts := make(map[string]int, len(rrows))
+		for _, r := range rrows {
+			counts[hashKey(r)]++
+		}
+		rows = make([]Row, 0, len(lrows))
+		for _, r := range lrows {
+			k := hashKey(r)
+			found := counts[k] > 0
+			// every row of right side matches one row of left side with ALL
+			if found && stmt.All {
+				counts[k]--
+			}
+			if found == (stmt.Op == ast.SetOpIntersect) {
+				rows = append(rows, r)
+			}
+		}
+	}
+	s := resultScope(columns)
+	if !stmt.All {
+		if rows, err = s.distinct(rows, nil); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := outputKeys(stmt.OrderBy, s.selectAll())
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err := s.check(k.Expr); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.sort(rows, keys); err != nil {
+		return nil, err
+	}
+	if rows, err = slice(rows, stmt.Limit, stmt.Offset); err != nil {
+		return nil, err
+	}
+	return selectedResult(columns, rows), nil
+}
+
+// Query runs SELECT or set operation of queries.
+func query(q ast.Query) (*Result, error) {
+	if s, ok := q.(*ast.QueryStmtSelectValues); ok {
+		return Select(s)
+	}
+	return Combine(q.(*ast.QueryStmtSetOperation))
+}
+
+// CombinedColumns returns the columns of set operation, they are named by
+// the left columns, and the kind of every column is the known one of both
+// sides, or FLOAT if INT is combined with FLOAT.
+func combinedColumns(left, right []ast.Column) ([]ast.Column, error) {
+	if len(left) != len(right) {
+		return nil, fmt.Errorf("%w: %d and %d", ErrSetColumnsNotMatched, len(left), len(right))
+	}
+	columns := make([]ast.Column, 0, len(left))
+	for i, c := range left {
+		k, o := c.Kind, right[i].Kind
+		switch {
+		case k == o || o == ast.ColumnKindUnknown:
+		case k == ast.ColumnKindUnknown:
+			k = o
+		case (k == ast.ColumnKindInt && o == ast.ColumnKindFloat) || (k == ast.ColumnKindFloat && o == ast.ColumnKindInt):
+			k = ast.ColumnKindFloat
+		default:
+			return nil, fmt.Errorf("%w: %s and %s", ErrSetKindsNotMatched, k, o)
+		}
+		columns = append(columns, ast.Column{Name: c.Name, Kind: k})
+	}
+	return columns, nil
+}
+
+// Cast returns the copies of rows whose integers of FLOAT columns are
+// converted to floats, so the same numbers of both sides are the same.
+func cast(rows []Row, columns []ast.Column) []Row {
+	casted := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		row := make(Row, 0, len(r))
+		for i, v := range r {
+			if n, ok := v.(int64); ok && columns[i].Kind == ast.ColumnKindFloat {
+				v = float64(n)
+			}
+			row = append(row, v)
+		}
+		casted = append(casted, row)
+	}
+	return casted
+}
+
+// ResultScope returns the scope of the rows of result, the columns aren't
+// qualified by any table.
+func resultScope(columns []ast.Column) scope {
+	s := scope{}
+	for _, c := range columns {
+		s.tables = append(s.tables, "")
+		s.columns = append(s.columns, c.Name)
+		s.kinds = append(s.kinds, c.Kind)
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestCombine(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testsetop1 (name text, age int)",
+		"create table testsetop2 (name text, age int)",
+		"insert into testsetop1 values ('wang', 18), ('li', 20), ('li', 20), ('zhao', null)",
+		"insert into testsetop2 values ('li', 20), ('qian', 30), ('zhao', null)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"select name from testsetop1 union select name from testsetop2", []Row{{"wang"}, {"li"}, {"zhao"}, {"qian"}}, nil},
+		{"select name from testsetop1 union all select name from testsetop2 order by name limit 3", []Row{{"li"}, {"li"}, {"li"}}, nil},
+		{"select name, age from testsetop1 intersect select name, age from testsetop2", []Row{{"li", int64(20)}, {"zhao", nil}}, nil},
+		{"select name from testsetop1 intersect all select name from testsetop2", []Row{{"li"}, {"zhao"}}, nil},
+		{"select name from testsetop1 except select name from testsetop2", []Row{{"wang"}}, nil},
+		{"select name from testsetop1 except all select name from testsetop2 order by name", []Row{{"li"}, {"wang"}}, nil},
+		// INTERSECT binds tighter than UNION
+		{"select name from testsetop1 where age = 18 union select name from testsetop1 intersect select name from testsetop2", []Row{{"wang"}, {"li"}, {"zhao"}}, nil},
+		{"(select name from testsetop1 where age = 18 union select name from testsetop1) intersect select name from testsetop2", []Row{{"li"}, {"zhao"}}, nil},
+		{"select name n from testsetop1 union select upper(name) from testsetop2 order by n desc offset 4", []Row{{"QIAN"}, {"LI"}}, nil},
+		// the integers are casted to floats to be combined with averages
+		{"select age from testsetop1 union select avg(age) from testsetop2 order by age", []Row{{float64(18)}, {float64(20)}, {float64(25)}, {nil}}, nil},
+		{"select age from testsetop1 union (select age from testsetop2 order by age desc limit 1)", []Row{{int64(18)}, {int64(20)}, {nil}}, nil},
+		{"select name, age from testsetop1 union select name from testsetop2", nil, ErrSetColumnsNotMatched},
+		{"select name from testsetop1 union select age from testsetop2", nil, ErrSetKindsNotMatched},
+		{"select name from testsetop1 union select name from testsetop2 order by age", nil, ErrColumnNamesNotMatched},
+		{"select name from testsetop1 union select name from nothing", nil, ErrTableNotExisted},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := query(stmt.(ast.Query))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrSubqueryColumns = errors.New("subquery must return only one column")
+	ErrSubqueryRows    = errors.New("more than one row returned by a subquery used as an expression")
+)
+
+// SubqueryCache keeps the subqueries which are evaluated once for all rows,
+// they're found by the expressions of subqueries.
+type subqueryCache struct {
+	// results of the subqueries which don't refer to outer rows
+	results map[ast.Expr]*Result
+	// semi-joins of IN subqueries, it's nil if the subquery can't be
+	// decorrelated into semi-join
+	semiJoins map[*ast.InExpr]*semiJoin
+}
+
+func newSubqueryCache() *subqueryCache {
+	return &subqueryCache{
+		results:   make(map[ast.Expr]*Result),
+		semiJoins: make(map[*ast.InExpr]*semiJoin),
+	}
+}
+
+// EvalSubquery evaluates scalar subquery with row r, the result is NULL if
+// the subquery returns no row.
+func (s scope) evalSubquery(e *ast.SubqueryExpr, r Row) (interface{}, error) {
+	res, err := s.subquery(e, e.Query, r)
+	if err != nil {
+		return nil, err
+	}
+	switch len(res.Rows) {
+	case 0:
+		return nil, nil
+	case 1:
+		return res.Rows[0][0], nil
+	}
+	return nil, ErrSubqueryRows
+}
+
+// EvalExists tests if the subquery returns any row with row r.
+func (s scope) evalExists(e *ast.ExistsExpr, r Row) (interface{}, error) {
+	res, err := s.runSubquery(e, e.Query, r)
+	if err != nil {
+		return nil, err
+	}
+	return len(res.Rows) > 0, nil
+}
+
+// EvalInSubquery tests if the value of expression is returned by subquery.
+// The subquery is looked up by its semi-join if it can be decorrelated,
+// otherwise it's run with row r.
+func (s scope) evalInSubquery(e *ast.InExpr, r Row) (interface{}, error) {
+	v, err := s.eval(e.Expr, r)
+	if err != nil {
+		return nil, err
+	}
+	j, ok := s.cache.semiJoin(e)
+	if !ok {
+		if j, err = s.semiJoin(e); err != nil {
+			return nil, err
+		}
+		s.cache.setSemiJoin(e, j)
+	}
+	var found interface{}
+	if j != nil {
+		found, err = j.lookup(s, r, v)
+	} else {
+		var res *Result
+		if res, err = s.subquery(e, e.Query, r); err != nil {
+			return nil, err
+		}
+		values := make([]Field, 0, len(res.Rows))
+		for _, row := range res.Rows {
+			values = append(values, row[0])
+		}
+		found, err = in(v, values)
+	}
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return found.(bool) != e.Not, nil
+}
+
+// Subquery runs subquery q of expression e which returns only one column.
+func (s scope) subquery(e ast.Expr, q ast.Query, r Row) (*Result, error) {
+	res, err := s.runSubquery(e, q, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Columns) != 1 {
+		return nil, fmt.Errorf("%w: %d columns", ErrSubqueryColumns, len(res.Columns))
+	}
+	return res, nil
+}
+
+// RunSubquery runs subquery q of expression e with row r, the result is
+// cached for all rows if q doesn't refer to the columns of scope.
+func (s scope) runSubquery(e ast.Expr, q ast.Query, r Row) (*Result, error) {
+	if res, ok := s.cache.result(e); ok {
+		return res, nil
+	}
+	bound, correlated, err := s.correlate(q, r)
+	if err != nil {
+		return nil, err
+	}
+	res, err := query(bound)
+	if err != nil {
+		return nil, err
+	}
+	if !correlated {
+		s.cache.setResult(e, res)
+	}
+	return res, nil
+}
+
+// Correlate returns the copy of query q whose column references to scope s
+// are replaced with the values of row r, so it can be run like uncorrelated
+// query. The references are resolved by the tables of q and its outer
+// queries first like PostgreSQL, and correlated is true if any reference is
+// replaced.
+func (s scope) correlate(q ast.Query, r Row) (bound ast.Query, correlated bool, err error) {
+	var bind func(q ast.Query, inners []scope) ast.Query
+	bind = func(q ast.Query, inners []scope) ast.Query {
+		if o, ok := q.(*ast.QueryStmtSetOperation); ok {
+			c := *o
+			c.Left, c.Right = bind(o.Left, inners), bind(o.Right, inners)
+			return &c
+		}
+		stmt := q.(*ast.QueryStmtSelectValues)
+		inner, e := fromScope(stmt)
+		if e != nil {
+			err = e
+			return q
+		}
+		inners = append(inners[:len(inners):len(inners)], inner)
+		var fn func(ast.Expr) (ast.Expr, bool)
+		fn = func(e ast.Expr) (ast.Expr, bool) {
+			switch e := e.(type) {
+			case *ast.ColumnRef:
+				for _, in := range inners {
+					if in.has(e) {
+						return e, true
+					}
+				}
+				if i, err := s.resolve(e); err == nil {
+					correlated = true
+					return fieldLiteral(r[i]), true
+				}
+				return e, true
+			case *ast.SubqueryExpr:
+				return &ast.SubqueryExpr{Query: bind(e.Query, inners)}, true
+			case *ast.ExistsExpr:
+				return &ast.ExistsExpr{Query: bind(e.Query, inners)}, true
+			case *ast.InExpr:
+				if e.Query != nil {
+					return &ast.InExpr{Expr: ast.Transform(e.Expr, fn), Query: bind(e.Query, inners), Not: e.Not}, true
+				}
+			}
+			return e, false
+		}
+		return ast.TransformStmt(stmt, fn).(ast.Query)
+	}
+	bound = bind(q, nil)
+	return bound, correlated, err
+}
+
+// FromScope returns the scope of the tables in FROM clause of select
+// statement, their rows aren't joined.
+func fromScope(stmt *ast.QueryStmtSelectValues) (scope, error) {
+	t, ok := queryTable(stmt.TableName)
+	if !ok {
+		return scope{}, fmt.Errorf("%w: %s", ErrTableNotExisted, stmt.TableName)
+	}
+	s := newScope(t).as(aliasOr(stmt.Alias, t.Name))
+	for _, j := range stmt.Joins {
+		t, ok := queryTable(j.TableName)
+		if !ok {
+			return scope{}, fmt.Errorf("%w: %s", ErrTableNotExisted, j.TableName)
+		}
+		s = s.join(newScope(t).as(aliasOr(j.Alias, t.Name)))
+	}
+	return s, nil
+}
+
+// Has reports whether column reference c refers to any column of scope, even
+// if it's ambiguous.
+func (s scope) has(c *ast.ColumnRef) bool {
+	_, err := s.resolve(c)
+	return !errors.Is(err, ErrColumnNamesNotMatched)
+}
+
+// SubqueryKind returns the kind of the only column of query, it's unknown if
+// it can't be known without running the query.
+func subqueryKind(q ast.Query) ast.ColumnKind {
+	if o, ok := q.(*ast.QueryStmtSetOperation); ok {
+		return subqueryKind(o.Left)
+	}
+	stmt := q.(*ast.QueryStmtSelectValues)
+	if len(stmt.Columns) != 1 {
+		return ast.ColumnKindUnknown
+	}
+	s, err := fromScope(stmt)
+	if err != nil {
+		return ast.ColumnKindUnknown
+	}
+	return s.kind(stmt.Columns[0].Expr)
+}
+
+// SubqueryColumnName returns the name of the only column of query.
+func subqueryColumnName(q ast.Query) ast.ColumnName {
+	if o, ok := q.(*ast.QueryStmtSetOperation); ok {
+		return subqueryColumnName(o.Left)
+	}
+	stmt := q.(*ast.QueryStmtSelectValues)
+	if len(stmt.Columns) != 1 {
+		return "?column?"
+	}
+	return columnName(stmt.Columns[0])
+}
+
+// SemiJoin is the values of decorrelated IN subquery hashed by the values of
+// correlated columns, so the subquery is run once for all rows instead of
+// once for every row.
+type semiJoin struct {
+	// outers are the outer expressions compared with the inner ones by the
+	// correlated equalities, it's empty if the subquery is uncorrelated.
+	outers []ast.Expr
+	groups map[string]*semiGroup
+}
+
+// SemiGroup is the values of subquery correlated with the same outer values.
+type semiGroup struct {
+	values map[string]bool
+	null   bool
+}
+
+// SemiJoin decorrelates the subquery of e into semi-join. The correlated
+// equalities joined by AND in WHERE clause, like orders.uid = users.id, are
+// removed from the subquery, and their inner sides are selected after the
+// compared column, so it's run once and the values are grouped by the inner
+// sides. It returns nil if the subquery isn't simple enough, like grouping,
+// LIMIT or the outer references out of the equalities, or the values can't
+// be hashed by their kinds.
+func (s scope) semiJoin(e *ast.InExpr) (*semiJoin, error) {
+	stmt, ok := e.Query.(*ast.QueryStmtSelectValues)
+	if !ok || stmt.ContainsAllColumns || len(stmt.Columns) != 1 || aggregated(stmt) || len(stmt.DistinctOn) > 0 ||
+		stmt.Limit != nil || stmt.Offset != nil {
+		return nil, nil
+	}
+	inner, err := fromScope(stmt)
+	if err != nil {
+		return nil, err
+	}
+	// refs counts the inner and outer references of expression, nested is
+	// true if it has subquery.
+	refs := func(e ast.Expr) (inners, outers int, nested bool) {
+		ast.Walk(e, func(e ast.Expr) bool {
+			switch e := e.(type) {
+			case *ast.ColumnRef:
+				if inner.has(e) {
+					inners++
+				} else if s.has(e) {
+					outers++
+				}
+			case *ast.SubqueryExpr, *ast.ExistsExpr:
+				nested = true
+			case *ast.InExpr:
+				nested = nested || e.Query != nil
+			}
+			return true
+		})
+		return inners, outers, nested
+	}
+	simple := func(e ast.Expr) bool {
+		_, outers, nested := refs(e)
+		return outers == 0 && !nested
+	}
+	if !simple(stmt.Columns[0].Expr) || !hashable(s.kind(e.Expr), inner.kind(stmt.Columns[0].Expr)) {
+		return nil, nil
+	}
+	for _, j := range stmt.Joins {
+		if !simple(j.On) {
+			return nil, nil
+		}
+	}
+	columns := []ast.SelectColumn{stmt.Columns[0]}
+	j := &semiJoin{groups: make(map[string]*semiGroup)}
+	var where ast.Expr
+	for _, cond := range conjuncts(stmt.Where) {
+		if simple(cond) {
+			if where != nil {
+				cond = &ast.LogicExpr{Op: ast.LogicOpAnd, Left: where, Right: cond}
+			}
+			where = cond
+			continue
+		}
+		cmp, ok := cond.(*ast.CmpExpr)
+		if !ok || cmp.Cmp != ast.CmpKindEq {
+			return nil, nil
+		}
+		matched := false
+		for _, sides := range [][2]ast.Expr{{cmp.Left, cmp.Right}, {cmp.Right, cmp.Left}} {
+			inners, outers, nested := refs(sides[1])
+			if !simple(sides[0]) || inners > 0 || outers == 0 || nested || !hashable(inner.kind(sides[0]), s.kind(sides[1])) {
+				continue
+			}
+			columns = append(columns, ast.SelectColumn{Expr: sides[0]})
+			j.outers = append(j.outers, sides[1])
+			matched = true
+			break
+		}
+		if !matched {
+			return nil, nil
+		}
+	}
+	decorrelated := *stmt
+	decorrelated.Distinct, decorrelated.Columns, decorrelated.Where, decorrelated.OrderBy = false, columns, where, nil
+	res, err := Select(&decorrelated)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range res.Rows {
+		// NULLs never equal to the outer values
+		if hasNull(row[1:]) {
+			continue
+		}
+		k := semiKey(row[1:])
+		g, ok := j.groups[k]
+		if !ok {
+			g = &semiGroup{values: make(map[string]bool)}
+			j.groups[k] = g
+		}
+		if row[0] == nil {
+			g.null = true
+		} else {
+			g.values[semiKey(row[:1])] = true
+		}
+	}
+	return j, nil
+}
+
+// Lookup tests if v is in the group of semi-join correlated with row r like
+// In.
+func (j *semiJoin) lookup(s scope, r Row, v Field) (interface{}, error) {
+	keys := make([]Field, 0, len(j.outers))
+	for _, e := range j.outers {
+		k, err := s.eval(e, r)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			return false, nil
+		}
+		keys = append(keys, k)
+	}
+	g, ok := j.groups[semiKey(keys)]
+	switch {
+	case !ok:
+		return false, nil
+	case v == nil:
+		return nil, nil
+	case g.values[semiKey([]Field{v})]:
+		return true, nil
+	case g.null:
+		return nil, nil
+	}
+	return false, nil
+}
+
+// Hashable reports whether the values of kinds a and b are equal only if
+// their hash keys are the same, numbers are hashed as floats like compare.
+func hashable(a, b ast.ColumnKind) bool {
+	numeric := func(k ast.ColumnKind) bool { return k == ast.ColumnKindInt || k == ast.ColumnKindFloat }
+	return (a == ast.ColumnKindText && b == ast.ColumnKindText) || (numeric(a) && numeric(b))
+}
+
+// SemiKey returns the hash key of values of semi-join.
+func semiKey(values []Field) string {
+	keys := make([]Field, 0, len(values))
+	for _, v := range values {
+		if i, ok := v.(int64); ok {
+			v = float64(i)
+		}
+		keys = append(keys, v)
+	}
+	return hashKey(keys)
+}
+
+func hasNull(values []Field) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *subqueryCache) result(e ast.Expr) (*Result, bool) {
+	if c == nil {
+		return nil, false
+	}
+	res, ok := c.results[e]
+	return res, ok
+}
+
+func (c *subqueryCache) setResult(e ast.Expr, res *Result) {
+	if c != nil {
+		c.results[e] = res
+	}
+}
+
+func (c *subqueryCache) semiJoin(e *ast.InExpr) (*semiJoin, bool) {
+	if c == nil {
+		return nil, false
+	}
+	j, ok := c.semiJoins[e]
+	return j, ok
+}
+
+func (c *subqueryCache) setSemiJoin(e *ast.InExpr, j *semiJoin) {
+	if c != nil {
+		c.semiJoins[e] = j
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestSubqueries(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testsubquery1 (id int, name text, age int)",
+		"create table testsubquery2 (uid int, item text, price int)",
+		"insert into testsubquery1 values (1, 'wang', 18), (2, 'li', 20), (3, 'zhao', null), (4, 'qian', 30)",
+		"insert into testsubquery2 values (1, 'book', 10), (1, 'pen', 2), (2, 'book', 12), (null, 'cup', 5)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"select name from testsubquery1 where id in (select uid from testsubquery2)", []Row{{"wang"}, {"li"}}, nil},
+		// NOT IN is NULL for every row if the subquery returns NULL
+		{"select name from testsubquery1 where id not in (select uid from testsubquery2)", []Row{}, nil},
+		{"select name from testsubquery1 where id not in (select uid from testsubquery2 where uid is not null)", []Row{{"zhao"}, {"qian"}}, nil},
+		{"select name from testsubquery1 where id in (select uid from testsubquery2 where price > 100)", []Row{}, nil},
+		{"select name from testsubquery1 where exists (select * from testsubquery2 where uid = id and price > 5)", []Row{{"wang"}, {"li"}}, nil},
+		{"select name from testsubquery1 t where not exists (select * from testsubquery2 where uid = t.id)", []Row{{"zhao"}, {"qian"}}, nil},
+		// correlated IN is decorrelated into semi-join
+		{"select name from testsubquery1 where 'pen' in (select item from testsubquery2 where uid = id)", []Row{{"wang"}}, nil},
+		{"select name from testsubquery1 t where 12 in (select price from testsubquery2 o where o.uid = t.id and o.item = 'book')", []Row{{"li"}}, nil},
+		// correlated IN which can't be decorrelated is run for every row
+		{"select name from testsubquery1 where age in (select price + 10 from testsubquery2 where uid < id)", []Row{{"li"}}, nil},
+		{"select name, (select sum(price) from testsubquery2 where uid = id) total from testsubquery1 order by id", []Row{{"wang", int64(12)}, {"li", int64(12)}, {"zhao", nil}, {"qian", nil}}, nil},
+		{"select name from testsubquery1 where age > (select avg(age) from testsubquery1)", []Row{{"qian"}}, nil},
+		{"select name from testsubquery1 where id = (select uid from testsubquery2 where item = 'cup')", []Row{}, nil},
+		// the subquery of subquery refers to the outermost row
+		{"select name from testsubquery1 t where exists (select * from testsubquery2 where item = 'book' and exists (select * from testsubquery1 where id = t.id and uid = t.id))", []Row{{"wang"}, {"li"}}, nil},
+		{"select name from testsubquery1 where id in (select uid from testsubquery2 union select 4 from testsubquery2)", []Row{{"wang"}, {"li"}, {"qian"}}, nil},
+		{"select name from testsubquery1 where id = (select uid from testsubquery2 where item = 'book')", nil, ErrSubqueryRows},
+		{"select name from testsubquery1 where id in (select uid, item from testsubquery2)", nil, ErrSubqueryColumns},
+		{"select (select * from testsubquery2 where uid = 2) from testsubquery1", nil, ErrSubqueryColumns},
+		{"select name from testsubquery1 where id in (select nothing from testsubquery2)", nil, ErrColumnNamesNotMatched},
+		{"select name from testsubquery1 where exists (select * from nothing)", nil, ErrTableNotExisted},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := Select(stmt.(*ast.QueryStmtSelectValues))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+	}
+}
+
+func TestSubqueriesInUpdateAndDelete(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testsubquery3 (id int, name text, total int)",
+		"create table testsubquery4 (uid int, price int)",
+		"insert into testsubquery3 values (1, 'wang', 0), (2, 'li', 0), (3, 'zhao', 0)",
+		"insert into testsubquery4 values (1, 10), (1, 2), (2, 12)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	update := "update testsubquery3 set total = (select sum(price) from testsubquery4 where uid = id) where id in (select uid from testsubquery4)"
+	if _, err := exec(update); err != nil {
+		t.Fatalf("failed to exec %q: %v", update, err)
+	}
+	stmt, err := parser.Parse("delete from testsubquery3 where not exists (select * from testsubquery4 where uid = id)")
+	if err != nil {
+		t.Fatalf("failed to parse delete: %v", err)
+	}
+	if _, err := Delete(stmt.(*ast.QueryStmtDeleteValues)); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	// THEN
+	rows := []Row{{int64(1), "wang", int64(12)}, {int64(2), "li", int64(12)}}
+	if got := tables["testsubquery3"].Rows; !reflect.DeepEqual(got, rows) {
+		t.Errorf("rows should be %v, but got %v", rows, got)
+	}
+}
@@ -2,21 +2,27 @@ package storage
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"regexp"
 	"strings"
 
 	"github.com/linkedin/goavro/v2"
 	"github.com/wangwalker/gpostgres/pkg/ast"
+	"golang.org/x/exp/slices"
 )
 
 const (
 	tableRowDefaultCount uint8 = 100
-	rowSeparator         byte  = '\n'
+	// rowTombstone fills the bytes of a deleted row in data file. As every
+	// encoded row starts with a varint, a row full of 0xff never ends its first
+	// field, so it can't be mistaken for a valid row.
+	rowTombstone byte = 0xff
 )
 
 var (
@@ -25,78 +31,104 @@ var (
 	errConvertRecordFailed = errors.New("failed to convert binary to record")
 )
 
-type Field string
+type Row []Field
 
-// Purify removes the quotes of a string when inserting new rows.
-func (f Field) purify() Field {
-	pure := strings.ReplaceAll(string(f), "'", "")
-	pure = strings.ReplaceAll(pure, "\"", "")
-	return Field(pure)
+// location is the position of an encoded row in the data file of a table.
+// Every row is prefixed by its length as uvarint, because Avro binary could
+// contain any byte, offset and length are of the row after the prefix.
+type location struct {
+	offset int64
+	length int
 }
 
-type Row []Field
-
 type Table struct {
 	Name        string           `json:"name"`
 	Len         int              `json:"len"`
 	Columns     []ast.Column     `json:"columns"`
 	ColumnNames []ast.ColumnName `json:"column_names"`
-	Rows        []Row
-	index       *Index
-	avroCodec   *goavro.Codec
+	// Nullable is true if fields are encoded as avro unions with null, it's
+	// false for the tables created before NULL is supported.
+	Nullable bool `json:"nullable"`
+	// Framed is true if rows are prefixed by their lengths in data file, it's
+	// false for the tables saved when rows were separated by newlines.
+	Framed bool `json:"framed"`
+	// PRIMARY KEY and UNIQUE constraints over columns.
+	Constraints []ast.Constraint `json:"constraints,omitempty"`
+	// old writer schemas of data file, which are kept after altering columns.
+	Versions []schemaVersion `json:"versions,omitempty"`
+	Rows     []Row           `json:"-"`
+	// locations of rows in data file, one-to-one mapping with Rows.
+	locations []location
+	index     *Index
+	// rehearsed is true if rows of the table are changed only in memory.
+	rehearsed bool
+}
+
+// SchemaVersion is the writer schema of the rows in data file before offset
+// end and after the end of previous version. The columns are renamed along
+// with the table, and dropped columns are left with empty names.
+type schemaVersion struct {
+	End      int64        `json:"end"`
+	Columns  []ast.Column `json:"columns"`
+	Nullable bool         `json:"nullable"`
 }
 
 // Convert converts a row for table to  type map[string]interface{}
-// with column name as key and column value as value, which is used
+// with field name of column as key and column value as value, which is used
 // for encoding to avro binary in save(row) method.
+// NULL is nil, and other values are wrapped with their types as avro unions
+// if the table is nullable.
 func (t Table) convert(r Row) map[string]interface{} {
 	record := make(map[string]interface{})
 	for i, c := range t.Columns {
-		name := string(c.Name)
 		var v interface{}
 		if c.Kind == ast.ColumnKindInt {
-			ii, _ := strconv.Atoi(string(r[i]))
-			v = ii
+			iv, _ := r[i].(int64)
+			v = int(iv)
 		} else {
-			v = string(r[i])
+			v, _ = r[i].(string)
+		}
+		if t.Nullable {
+			if r[i] == nil {
+				v = nil
+			} else {
+				v = goavro.Union(avroType(c.Kind), v)
+			}
 		}
-		record[name] = v
+		record[fieldName(t.Columns, i)] = v
 	}
 	return record
 }
 
-// Get gets the stringed value of a column with the column name, which is
-// used for updating index for the column.
+// Get gets the index key of a column with its field name, which is used for
+// updating index for the column.
 // The parameter r is the result of call convert(row) method.
 func get(r map[string]interface{}, name string) string {
 	v, ok := r[name]
 	if !ok {
 		panic(fmt.Sprintf("column %s not found", name))
 	}
+	v = unwrap(v)
 	sv, ok := v.(string)
 	if ok {
-		return sv
+		return indexKey(sv)
 	}
-	return strconv.Itoa(v.(int))
-
+	return indexKey(int64(v.(int)))
 }
 
 // SaveScheme saves table scheme to file with json format when creating one.
-func (t Table) saveScheme() {
+func (t Table) saveScheme() error {
 	_, err := os.Stat(config.SchemeDir)
 	if os.IsNotExist(err) {
 		os.Mkdir(config.SchemeDir, 0755)
 	}
-	path := t.schemePath()
+	// the data file is converted before the scheme of an old table is saved
+	t.Framed = true
 	bytes, err := json.Marshal(t)
 	if err != nil {
-		fmt.Printf("Failed to marshal table %s scheme to json: %s", t.Name, err)
-		return
-	}
-	err = os.WriteFile(path, bytes, 0644)
-	if err != nil {
-		fmt.Printf("Failed to write table %s scheme to file: %s", t.Name, err)
+		return err
 	}
+	return os.WriteFile(t.schemePath(), bytes, 0644)
 }
 
 // returns the path of a table's local scheme file.
@@ -144,94 +176,194 @@ func loadScheme(name string) {
 		fmt.Printf("Failed to decode json file %s: %s", path, err)
 		return
 	}
+	// the rows saved before NULL is supported are kept with their old schema
+	migrated := !table.Nullable || !table.Framed
+	if !table.Nullable {
+		table.keepVersion()
+		table.Nullable = true
+	}
+	if !table.Framed {
+		if err := table.frame(); err != nil {
+			fmt.Printf("Failed to convert data file of table %s: %s", table.Name, err)
+			return
+		}
+		table.Framed = true
+	}
+	if migrated {
+		if err := table.saveScheme(); err != nil {
+			fmt.Printf("Failed to save scheme of table %s: %s", table.Name, err)
+			return
+		}
+	}
 	table.loadIndex()
 	tables[table.Name] = table
 }
 
-// ComposeAvroCodec composes avro codec based on table scheme. As goavro says,
-// codec ought to be cached to avoid the overhead of parsing the schema. so we
-// save the codec in table struct after finishing composing.
-func (t Table) composeAvroCodec() (*goavro.Codec, error) {
-	if t.avroCodec != nil {
-		return t.avroCodec, nil
-	}
+// The avro codecs cached by their schemas. As goavro says, codec ought to be
+// cached to avoid the overhead of parsing the schema.
+var avroCodecs = make(map[string]*goavro.Codec)
+
+// ComposeAvroCodec composes avro codec based on the writer schema of rows,
+// which is the columns of table when the rows were saved. Avro binary data
+// doesn't contain the names of fields, so the rows written with an old schema
+// must be decoded by it, then they are resolved to the current columns as
+// reader schema by resolve. The dropped columns are only kept in old schemas
+// with empty names, they are named by their positions in codec, and so are
+// the columns whose names aren't allowed by avro.
+//
+// The fields of nullable schema are unions like ["null", "int"] whose default
+// is null, so NULL can be saved for any column.
+func composeAvroCodec(v schemaVersion) (*goavro.Codec, error) {
+	columns := v.Columns
 	var fields strings.Builder
-	for i, c := range t.Columns {
-		if c.Kind == ast.ColumnKindInt {
-			s := fmt.Sprintf(`{"name": "%s", "type": "int", "default": 0}`, c.Name)
-			fields.WriteString(s)
-		} else {
-			s := fmt.Sprintf(`{"name": "%s", "type": "string", "default": ""}`, c.Name)
-			fields.WriteString(s)
+	for i, c := range columns {
+		var s string
+		switch {
+		case v.Nullable:
+			s = fmt.Sprintf(`{"name": "%s", "type": ["null", "%s"], "default": null}`, fieldName(columns, i), avroType(c.Kind))
+		case c.Kind == ast.ColumnKindInt:
+			s = fmt.Sprintf(`{"name": "%s", "type": "int", "default": 0}`, fieldName(columns, i))
+		default:
+			s = fmt.Sprintf(`{"name": "%s", "type": "string", "default": ""}`, fieldName(columns, i))
 		}
-		if i < len(t.Columns)-1 {
+		fields.WriteString(s)
+		if i < len(columns)-1 {
 			fields.WriteString(",")
 		}
 	}
-	var err error
-	t.avroCodec, err = goavro.NewCodec(`{
+	schema := `{
 		"type": "record",
 		"name": "User",
 		"fields" : [` + fields.String() + "]" + `
-	}`)
+	}`
+	if codec, ok := avroCodecs[schema]; ok {
+		return codec, nil
+	}
+	codec, err := goavro.NewCodec(schema)
 	if err != nil {
 		return nil, err
 	}
-	return t.avroCodec, nil
+	avroCodecs[schema] = codec
+	return codec, nil
 }
 
-// Save saves rows to local Avro binary file when inserting rows.
-// For many rows, we should call this serially.
-func (t Table) save(rows []Row) (int, error) {
+// AvroType returns the avro type of values of column kind k.
+func avroType(k ast.ColumnKind) string {
+	if k == ast.ColumnKindInt {
+		return "int"
+	}
+	return "string"
+}
+
+// Unwrap returns the value of avro union, other values are returned as is.
+func unwrap(v interface{}) interface{} {
+	if u, ok := v.(map[string]interface{}); ok {
+		for _, v := range u {
+			return v
+		}
+	}
+	return v
+}
+
+// AvroName matches the names allowed in avro schema.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FieldName returns the name of i-th field in avro record. The columns whose
+// names aren't allowed by avro, like quoted names and dropped columns with
+// empty names, are named like _field1, which are prefixed until no column
+// uses it.
+func fieldName(columns []ast.Column, i int) string {
+	if avroName.MatchString(string(columns[i].Name)) {
+		return string(columns[i].Name)
+	}
+	name := fmt.Sprintf("_field%d", i)
+	for slices.ContainsFunc(columns, func(c ast.Column) bool { return string(c.Name) == name }) {
+		name = "_" + name
+	}
+	return name
+}
+
+// WriterSchema returns the schema which the row at offset of data file was
+// saved with, rows after all old versions are saved with current schema.
+func (t Table) writerSchema(offset int64) schemaVersion {
+	for _, v := range t.Versions {
+		if offset < v.End {
+			return v
+		}
+	}
+	return t.schema()
+}
+
+// Schema returns current schema of table for saving rows.
+func (t Table) schema() schemaVersion {
+	return schemaVersion{Columns: t.Columns, Nullable: t.Nullable}
+}
+
+// Save saves rows to local Avro binary file when inserting rows, and records
+// the location of every row. For many rows, we should call this serially.
+func (t *Table) save(rows []Row) (int, error) {
+	if t.rehearsed {
+		return len(rows), nil
+	}
 	_, err := os.Stat(config.DataDir)
 	if os.IsNotExist(err) {
 		os.Mkdir(config.DataDir, 0755)
 	}
-	codec, err := t.composeAvroCodec()
+	codec, err := composeAvroCodec(t.schema())
 	if err != nil {
-		fmt.Println(err)
 		return 0, err
 	}
 	f, err := os.OpenFile(t.dataPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	fs, _ := f.Stat()
-	size := fs.Size()
 	if err != nil {
-		fmt.Println(err)
 		return 0, err
 	}
 	defer f.Close()
+	fs, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fs.Size()
 
-	// accumulated size of rows inserted in this call
-	var size1, offset uint16
-	// write rows into file with Avro binary format
+	// encode and write all rows before indexing them, so nothing is indexed
+	// if any row fails, and the rows partly written are truncated.
+	encoded := make([][]byte, 0, len(rows))
 	w := bufio.NewWriter(f)
 	for _, r := range rows {
-		record := t.convert(r)
-		bytes, err := codec.BinaryFromNative(nil, record)
-		bytes = append(bytes, rowSeparator)
+		bytes, err := codec.BinaryFromNative(nil, t.convert(r))
 		if err != nil {
-			fmt.Println(err)
+			return 0, err
 		}
-		_, err = w.Write(bytes)
-		if err != nil {
-			fmt.Printf("Write %v to file failed.\n", bytes)
+		prefix := binary.AppendUvarint(nil, uint64(len(bytes)))
+		if _, err := w.Write(append(prefix, bytes...)); err != nil {
+			f.Truncate(size)
+			return 0, err
 		}
+		encoded = append(encoded, bytes)
+	}
+	if err := w.Flush(); err != nil {
+		f.Truncate(size)
+		return 0, err
+	}
+	offset := size
+	for j, r := range rows {
 		// update index for all columns
 		// Note: we don't use page and block now, so we set them to 0
 		// TODO: organize row binary data into pages and blocks later
-		l := uint16(len(bytes))
-		size1 += l
-		for _, c := range t.Columns {
-			if idx := t.index; idx != nil {
+		l := len(encoded[j])
+		offset += int64(len(binary.AppendUvarint(nil, uint64(l))))
+		record := t.convert(r)
+		for i, c := range t.Columns {
+			// NULLs aren't indexed, as they are never equal to any value
+			if idx := t.index; idx != nil && r[i] != nil {
 				var p, b uint16
+				n := get(record, fieldName(t.Columns, i))
 				c := string(c.Name)
-				n := get(record, c)
-				idx.insert(c, n, offset, l, p, b)
+				idx.insert(c, n, uint16(offset), uint16(l), p, b)
 			}
 		}
-		offset = uint16(size) + size1
+		t.locations = append(t.locations, location{offset: offset, length: l})
+		offset += int64(l)
 	}
-	w.Flush()
 	return len(rows), nil
 }
 
@@ -245,17 +377,18 @@ func load() {
 	newTables := make(map[string]Table)
 	for _, t := range tables {
 		newT := t
-		rows, err := t.loadRows()
+		rows, err := newT.loadRows()
 		if err == nil && len(rows) > 0 {
 			newT.Rows = append(newT.Rows, rows...)
 		}
+		newT.Len = len(newT.Rows)
 		newTables[t.Name] = newT
 	}
 	tables = newTables
 }
 
-// LoadRows loads binary rows of a table from local Avro format to Rows.
-// It is the reversed process of SaveRows.
+// LoadRows loads binary rows of a table from local Avro format to Rows, the
+// deleted rows are skipped. It is the reversed process of SaveRows.
 func (t *Table) loadRows() ([]Row, error) {
 	_, err := os.Stat(config.DataDir)
 	if os.IsNotExist(err) {
@@ -272,26 +405,116 @@ func (t *Table) loadRows() ([]Row, error) {
 	defer f.Close()
 	r := bufio.NewReader(f)
 	rows := make([]Row, 0, len(t.Columns))
+	var offset int64
 	for {
-		line, err := r.ReadBytes(rowSeparator)
+		line, n, err := readRow(r)
 		if err != nil {
-			if err == io.EOF {
+			// the row partly written at the end is ignored
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			}
 			return nil, err
 		}
-		if len(line) == 1 && line[0] == rowSeparator {
+		l := location{offset: offset + int64(n), length: len(line)}
+		offset += int64(n + len(line))
+		if isTombstone(line) {
 			continue
 		}
-		r, err := t.decodeRow(line)
+		r, err := t.decodeRow(line, l.offset)
 		if err != nil {
 			continue
 		}
 		rows = append(rows, r)
+		t.locations = append(t.locations, l)
 	}
 	return rows, nil
 }
 
+// Frame converts the data file saved when rows were separated by newlines,
+// so that they are prefixed by their lengths. The rows are decoded by their
+// writer schemas and saved again with current columns, and the indexes are
+// rebuilt since their locations and keys are changed.
+func (t *Table) frame() error {
+	b, err := os.ReadFile(t.dataPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rows := make([]Row, 0)
+	var offset int64
+	for _, line := range bytes.SplitAfter(b, []byte{'\n'}) {
+		// empty lines and deleted rows are skipped, and so are the rows which
+		// can't be decoded as they were skipped when loading.
+		if len(line) > 1 && !isTombstone(line[:len(line)-1]) {
+			if r, err := t.decodeRow(line, offset); err == nil && r != nil {
+				rows = append(rows, r)
+			}
+		}
+		offset += int64(len(line))
+	}
+	old := t.dataPath() + ".old"
+	if err := os.Rename(t.dataPath(), old); err != nil {
+		return err
+	}
+	t.Versions = nil
+	t.removeIndex()
+	t.createIndex()
+	if _, err := t.save(rows); err != nil {
+		os.Remove(t.dataPath())
+		os.Rename(old, t.dataPath())
+		return err
+	}
+	// the locations are recorded again when loading rows
+	t.locations = nil
+	return os.Remove(old)
+}
+
+// ReadRow reads the next row prefixed by its length from data file, n is
+// the number of bytes of the prefix.
+func readRow(r *bufio.Reader) ([]byte, int, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	line := make([]byte, size)
+	if _, err := io.ReadFull(r, line); err != nil {
+		return nil, 0, err
+	}
+	return line, len(binary.AppendUvarint(nil, size)), nil
+}
+
+// Tests if the line read from data file is a deleted row.
+func isTombstone(line []byte) bool {
+	for _, b := range line {
+		if b != rowTombstone {
+			return false
+		}
+	}
+	return true
+}
+
+// Erase marks the rows at locations as deleted in data file by filling their
+// bytes with tombstone, the length prefixes are kept.
+func (t Table) erase(locations []location) error {
+	if len(locations) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(t.dataPath(), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, l := range locations {
+		tombstone := bytes.Repeat([]byte{rowTombstone}, l.length)
+		if _, err := f.WriteAt(tombstone, l.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (t *Table) setColumnNames() {
 	cn := make([]ast.ColumnName, 0, len(t.Columns))
 	for _, c := range t.Columns {
@@ -303,17 +526,20 @@ func (t *Table) setColumnNames() {
 func NewTable(stmt ast.QueryStmtCreateTable) *Table {
 	rows := make([]Row, 0, tableRowDefaultCount)
 	t := &Table{
-		Name:    stmt.Name,
-		Columns: stmt.Columns,
-		Rows:    rows,
+		Name:     stmt.Name,
+		Columns:  stmt.Columns,
+		Nullable: true,
+		Rows:     rows,
 	}
 	t.createIndex()
 	return t
 }
 
-// DecodeRow decodes a row from binary data.
-func (t Table) decodeRow(b []byte) (Row, error) {
-	codec, err := t.composeAvroCodec()
+// DecodeRow decodes a row from binary data at offset of data file, which is
+// decoded by its writer schema and resolved to current columns.
+func (t Table) decodeRow(b []byte, offset int64) (Row, error) {
+	writer := t.writerSchema(offset)
+	codec, err := composeAvroCodec(writer)
 	if err != nil {
 		return nil, err
 	}
@@ -325,21 +551,44 @@ func (t Table) decodeRow(b []byte) (Row, error) {
 	if !ok {
 		return nil, errConvertRecordFailed
 	}
+	return t.resolve(record, writer.Columns)
+}
+
+// Resolve converts a record decoded with writer columns to a row of current
+// columns as avro schema resolution does: fields are matched by the names of
+// their columns, fields of dropped columns are ignored, and added columns
+// which are missing in the writer schema get their default values. NULLs of
+// unions are nil.
+func (t Table) resolve(record map[string]interface{}, writer []ast.Column) (Row, error) {
 	row := make(Row, 0, len(t.Columns))
 	for _, c := range t.Columns {
-		v := record[string(c.Name)]
+		// the names of dropped columns are empty, which can't be matched.
+		k := slices.IndexFunc(writer, func(w ast.Column) bool { return w.Name == c.Name })
+		var v interface{}
+		ok := k >= 0
+		if ok {
+			v, ok = record[fieldName(writer, k)]
+		}
+		if !ok {
+			row = append(row, defaultField(c))
+			continue
+		}
+		if v = unwrap(v); v == nil {
+			row = append(row, nil)
+			continue
+		}
 		if c.Kind == ast.ColumnKindInt {
 			iv, ok := v.(int32)
 			if !ok {
 				return nil, errConvertIntFailed
 			}
-			row = append(row, Field(strconv.Itoa(int(iv))))
+			row = append(row, int64(iv))
 		} else {
 			sv, ok := v.(string)
 			if !ok {
 				return nil, errConvertTextFailed
 			}
-			row = append(row, Field(sv).purify())
+			row = append(row, sv)
 		}
 	}
 	return row, nil
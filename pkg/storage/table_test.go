@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -112,7 +115,7 @@ func TestComposeAvroCodec(t *testing.T) {
 	}
 
 	// WHEN
-	codec, err := table.composeAvroCodec()
+	codec, err := composeAvroCodec(table.schema())
 
 	// THEN
 	if err != nil {
@@ -137,8 +140,8 @@ func TestSaveRows(t *testing.T) {
 
 	// WHEN
 	rows := make([]Row, 0, 2)
-	r1 := Row{Field("wang"), Field("18")}
-	r2 := Row{Field("li"), Field("20")}
+	r1 := Row{Field("wang"), int64(18)}
+	r2 := Row{Field("li"), int64(20)}
 	rows = append(rows, r1, r2)
 	n, err := t1.save(rows)
 
@@ -165,8 +168,8 @@ func TestLoadRows(t *testing.T) {
 
 	// WHEN
 	rows := make([]Row, 0, 2)
-	r1 := Row{Field("wang"), Field("18")}
-	r2 := Row{Field("li"), Field("20")}
+	r1 := Row{Field("wang"), int64(18)}
+	r2 := Row{Field("li"), int64(20)}
 	rows = append(rows, r1, r2)
 	t1.save(rows)
 
@@ -185,17 +188,49 @@ func TestLoadRows(t *testing.T) {
 	if t2.Rows[0][0] != "wang" {
 		t.Errorf("table row field is not correct")
 	}
-	if t2.Rows[0][1] != "18" {
+	if t2.Rows[0][1] != int64(18) {
 		t.Errorf("table row field is not correct")
 	}
 	if t2.Rows[1][0] != "li" {
 		t.Errorf("table row field is not correct")
 	}
-	if t2.Rows[1][1] != "20" {
+	if t2.Rows[1][1] != int64(20) {
 		t.Errorf("table row field is not correct")
 	}
 }
 
+// TestLoadRowsWithNewlineBytes tests the rows whose Avro binary contains 0x0a
+// like INT 5 and 5-character strings are loaded, as they aren't separated
+// by newlines in data file.
+func TestLoadRowsWithNewlineBytes(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testuser9 (id int, name text)",
+		"insert into testuser9 values (1, 'hello'), (5, 'ab'), (2, 'xy')",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	loadSchemes()
+	load()
+
+	// THEN
+	rows := []Row{{int64(1), "hello"}, {int64(5), "ab"}, {int64(2), "xy"}}
+	t1 := tables["testuser9"]
+	if !reflect.DeepEqual(t1.Rows, rows) {
+		t.Fatalf("loaded rows should be %v, but got %v", rows, t1.Rows)
+	}
+	for _, r := range rows {
+		if got, err := t1.search("id", r[0]); err != nil || !reflect.DeepEqual(got, r) {
+			t.Errorf("search %v with index should get %v, but got %v, %v", r[0], r, got, err)
+		}
+	}
+}
+
 func TestSaveRowsAndSearchWithIndex(t *testing.T) {
 	// GIVEN
 	t1 := Table{
@@ -210,10 +245,10 @@ func TestSaveRowsAndSearchWithIndex(t *testing.T) {
 
 	// WHEN
 	rows := make([]Row, 0, 4)
-	r1 := Row{Field("wang"), Field("18")}
-	r2 := Row{Field("li"), Field("20")}
-	r3 := Row{Field("zhao"), Field("28")}
-	r4 := Row{Field("qian"), Field("30")}
+	r1 := Row{Field("wang"), int64(18)}
+	r2 := Row{Field("li"), int64(20)}
+	r3 := Row{Field("zhao"), int64(28)}
+	r4 := Row{Field("qian"), int64(30)}
 	rows = append(rows, r1, r2, r3, r4)
 	_, err := t1.save(rows)
 
@@ -261,7 +296,7 @@ func TestConvertRow(t *testing.T) {
 	t1.saveScheme()
 
 	// WHEN
-	row := Row{Field("wang"), Field("18")}
+	row := Row{Field("wang"), int64(18)}
 	record := t1.convert(row)
 	name := get(record, "name")
 	age := get(record, "age")
@@ -278,7 +313,7 @@ func TestConvertRow(t *testing.T) {
 	if name != "wang" {
 		t.Errorf("record field is not correct")
 	}
-	if age != "18" {
+	if age != indexKey(int64(18)) {
 		t.Errorf("record field is not correct")
 	}
 }
@@ -297,8 +332,8 @@ func TestLoadSchemesAndSaveRow(t *testing.T) {
 	t1.saveScheme()
 
 	rows := make([]Row, 0, 2)
-	r1 := Row{Field("wang"), Field("18")}
-	r2 := Row{Field("li"), Field("20")}
+	r1 := Row{Field("wang"), int64(18)}
+	r2 := Row{Field("li"), int64(20)}
 	rows = append(rows, r1, r2)
 	// will update index when save rows
 	t1.save(rows)
@@ -341,8 +376,8 @@ func TestSearchWithIndex(t *testing.T) {
 	t1.saveScheme()
 
 	rows := make([]Row, 0, 2)
-	r1 := Row{Field("wang"), Field("18")}
-	r2 := Row{Field("li"), Field("20")}
+	r1 := Row{Field("wang"), int64(18)}
+	r2 := Row{Field("li"), int64(20)}
 	rows = append(rows, r1, r2)
 	// will update index when save rows
 	t1.save(rows)
@@ -383,3 +418,52 @@ func TestSearchWithIndex(t *testing.T) {
 		t.Errorf("search result is not correct")
 	}
 }
+
+func TestLoadTableSavedWithNewlines(t *testing.T) {
+	// GIVEN, the scheme, data and index files saved when rows were separated
+	// by newlines, and the index keys were of the old format.
+	dirs := map[string]string{"scheme": config.SchemeDir, "data": config.DataDir, "index": config.IndexDir}
+	for from, to := range dirs {
+		src := filepath.Join("testdata", "legacy", from)
+		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(src, path)
+			os.MkdirAll(filepath.Dir(filepath.Join(to, rel)), 0755)
+			return os.WriteFile(filepath.Join(to, rel), b, 0644)
+		})
+		if err != nil {
+			t.Fatalf("failed to copy %s: %v", src, err)
+		}
+	}
+
+	// WHEN
+	loadSchemes()
+	load()
+
+	// THEN, the data file is converted and the rows are indexed again
+	want := []Row{{"wang", int64(18)}, {"li", int64(10)}, {"zhao", int64(20)}}
+	t1 := tables["testlegacy"]
+	if !t1.Framed || !reflect.DeepEqual(t1.Rows, want) {
+		t.Fatalf("loaded rows should be %v, but got %v", want, t1.Rows)
+	}
+	if r, err := t1.search("age", int64(10)); err != nil || !reflect.DeepEqual(r, want[1]) {
+		t.Errorf("row should be searched as %v, but got %v, %v", want[1], r, err)
+	}
+
+	// THEN, the converted table is loaded again as it is
+	if _, err := exec("delete from testlegacy where name = 'li'"); err != nil {
+		t.Fatalf("failed to delete row: %v", err)
+	}
+	loadSchemes()
+	load()
+	want = []Row{want[0], want[2]}
+	if rows := tables["testlegacy"].Rows; !reflect.DeepEqual(rows, want) {
+		t.Errorf("reloaded rows should be %v, but got %v", want, rows)
+	}
+}
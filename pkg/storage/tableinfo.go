@@ -21,9 +21,40 @@ func (t Table) String() string {
 	for _, c := range t.Columns {
 		sb.WriteString(fmt.Sprintf("| %-10s | %-20s|\n", c.Name, c.Kind))
 	}
+	keys := make([]string, 0, len(t.Constraints))
+	checks := make([]string, 0, len(t.Constraints))
+	foreigns := make([]string, 0, len(t.Constraints))
+	for _, c := range t.Constraints {
+		switch c.Kind {
+		case ast.ConstraintKindPrimaryKey, ast.ConstraintKindUnique:
+			keys = append(keys, fmt.Sprintf("    %q %s (%s)\n", c.Name, c.Kind, joinColumns(c.Columns)))
+		case ast.ConstraintKindCheck:
+			checks = append(checks, fmt.Sprintf("    %q %s (%s)\n", c.Name, c.Kind, c.Check))
+		case ast.ConstraintKindForeignKey:
+			foreigns = append(foreigns, fmt.Sprintf("    %q %s (%s) REFERENCES %s(%s) ON UPDATE %s ON DELETE %s\n",
+				c.Name, c.Kind, joinColumns(c.Columns), c.RefTable, joinColumns(c.RefColumns), c.OnUpdate, c.OnDelete))
+		}
+	}
+	if len(keys) > 0 {
+		sb.WriteString("Indexes:\n" + strings.Join(keys, ""))
+	}
+	if len(checks) > 0 {
+		sb.WriteString("Check constraints:\n" + strings.Join(checks, ""))
+	}
+	if len(foreigns) > 0 {
+		sb.WriteString("Foreign-key constraints:\n" + strings.Join(foreigns, ""))
+	}
 	return sb.String()
 }
 
+func joinColumns(columns []ast.ColumnName) string {
+	names := make([]string, 0, len(columns))
+	for _, n := range columns {
+		names = append(names, string(n))
+	}
+	return strings.Join(names, ", ")
+}
+
 func ShowTableSchemes(t string) {
 	if t == "" {
 		names := make([]string, 0, len(tables))
@@ -40,14 +71,15 @@ func ShowTableSchemes(t string) {
 	fmt.Println(table.String())
 }
 
-func ShowRows(rows []Row, stmt *ast.QueryStmtSelectValues) {
+// ShowRows prints the returned rows of a result with its columns as header.
+func ShowRows(r *Result) {
+	rows := r.Rows
 	if len(rows) == 0 {
 		return
 	}
-	columns := stmt.ColumnNames
-	if len(columns) == 0 {
-		table := tables[stmt.TableName]
-		columns = append(columns, table.ColumnNames...)
+	columns := make([]ast.ColumnName, 0, len(r.Columns))
+	for _, c := range r.Columns {
+		columns = append(columns, c.Name)
 	}
 	var sb, sp strings.Builder
 	sp1, sp2, sp3, sp4, sp5 := " | ", "-+-", "| ", "|-", "--"
@@ -69,7 +101,7 @@ func ShowRows(rows []Row, stmt *ast.QueryStmtSelectValues) {
 	for ri, r := range rows {
 		sb.WriteString(sp3)
 		for i, f := range r {
-			sb.WriteString(fmt.Sprintf(widthFormats[i].format, f, sp1))
+			sb.WriteString(fmt.Sprintf(widthFormats[i].format, formatField(f), sp1))
 		}
 		if ri < len(rows)-1 {
 			sb.WriteByte('\n')
@@ -90,8 +122,8 @@ func columnFormats(rows []Row, columnNames []ast.ColumnName) []widthFormat {
 	}
 	for _, r := range rows {
 		for c, f := range r {
-			if len(f) > widths[c] {
-				widths[c] = len(f)
+			if n := len(formatField(f)); n > widths[c] {
+				widths[c] = n
 			}
 		}
 	}
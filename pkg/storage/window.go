@@ -0,0 +1,486 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+)
+
+var (
+	ErrWindowMisplaced    = errors.New("window functions are not allowed here")
+	ErrOverRequired       = errors.New("window function requires an OVER clause")
+	ErrNotWindowFunc      = errors.New("OVER specified, but function is not a window function nor an aggregate function")
+	ErrFrameOffsetInvalid = errors.New("frame offset must be a non-negative integer")
+)
+
+// WindowFunc is the function computing result from the rows of partition, it
+// accepts minArgs to maxArgs arguments.
+type windowFunc struct {
+	minArgs int
+	maxArgs int
+}
+
+// The window functions by name, the aggregate functions could be called with
+// OVER clause as well.
+var windowFuncs = map[string]windowFunc{
+	"row_number":  {minArgs: 0, maxArgs: 0},
+	"rank":        {minArgs: 0, maxArgs: 0},
+	"dense_rank":  {minArgs: 0, maxArgs: 0},
+	"lag":         {minArgs: 1, maxArgs: 3},
+	"lead":        {minArgs: 1, maxArgs: 3},
+	"first_value": {minArgs: 1, maxArgs: 1},
+}
+
+// HasWindow returns true if expression calls any window function.
+func hasWindow(e ast.Expr) bool {
+	found := false
+	ast.Walk(e, func(e ast.Expr) bool {
+		if f, ok := e.(*ast.FuncCall); ok && f.Over != nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Windowed returns true if select statement calls window functions in output
+// columns, ORDER BY or DISTINCT ON.
+func windowed(stmt *ast.QueryStmtSelectValues) bool {
+	for _, c := range stmt.Columns {
+		if hasWindow(c.Expr) {
+			return true
+		}
+	}
+	for _, k := range stmt.OrderBy {
+		if hasWindow(k.Expr) {
+			return true
+		}
+	}
+	for _, e := range stmt.DistinctOn {
+		if hasWindow(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Windowing computes window functions for the rows of scope without
+// collapsing them like grouping. The results of window functions are appended
+// to every row, and the expressions after windowing, like output columns,
+// ORDER BY and DISTINCT ON are rewritten to refer to them like aggregation.
+type windowing struct {
+	scope   scope
+	calls   []*ast.FuncCall
+	outputs []ast.SelectColumn
+	keys    []ast.OrderBy
+	on      []ast.Expr
+}
+
+// Window runs select statement with window functions on the rows of relation,
+// which are filtered by WHERE clause before windowing.
+func (r relation) window(stmt *ast.QueryStmtSelectValues) (*Result, error) {
+	s := r.scope
+	selected, columns := stmt.Columns, r.columns()
+	if !stmt.ContainsAllColumns {
+		columns = make([]ast.Column, 0, len(selected))
+		for _, c := range selected {
+			columns = append(columns, ast.Column{Name: columnName(c), Kind: s.kind(c.Expr)})
+		}
+	} else {
+		selected = s.selectAll()
+	}
+	w, err := s.windowing(selected, stmt.OrderBy, stmt.DistinctOn)
+	if err != nil {
+		return nil, err
+	}
+	filtered, err := r.scan(stmt.Where, nil)
+	if err != nil {
+		return nil, err
+	}
+	return w.output(stmt, columns, filtered)
+}
+
+// Windowing rewrites the selected columns, sort keys and DISTINCT ON
+// expressions evaluated by scope s after windowing, and checks them.
+func (s scope) windowing(selected []ast.SelectColumn, keys []ast.OrderBy, on []ast.Expr) (*windowing, error) {
+	w := &windowing{scope: s}
+	exprs := make([]ast.Expr, 0, len(selected)+len(keys)+len(on))
+	for _, c := range selected {
+		exprs = append(exprs, c.Expr)
+	}
+	for _, k := range keys {
+		exprs = append(exprs, k.Expr)
+	}
+	exprs = append(exprs, on...)
+	rewritten := make([]ast.Expr, 0, len(exprs))
+	for _, e := range exprs {
+		e, err := w.rewrite(e)
+		if err != nil {
+			return nil, err
+		}
+		rewritten = append(rewritten, e)
+	}
+	ws := w.windowScope()
+	for _, e := range rewritten {
+		if err := ws.check(e); err != nil {
+			return nil, err
+		}
+	}
+	for i := range selected {
+		w.outputs = append(w.outputs, ast.SelectColumn{Expr: rewritten[i]})
+	}
+	for i, k := range keys {
+		w.keys = append(w.keys, ast.OrderBy{Expr: rewritten[len(selected)+i], Desc: k.Desc, Nulls: k.Nulls})
+	}
+	w.on = rewritten[len(selected)+len(keys):]
+	return w, nil
+}
+
+// Rewrite replaces window calls in expression with the columns of their
+// results.
+func (w *windowing) rewrite(e ast.Expr) (ast.Expr, error) {
+	var err error
+	r := ast.Transform(e, func(e ast.Expr) (ast.Expr, bool) {
+		if err != nil {
+			return e, true
+		}
+		if f, ok := e.(*ast.FuncCall); ok && f.Over != nil {
+			err = w.checkCall(f)
+			w.calls = append(w.calls, f)
+			return &ast.ColumnRef{Name: ast.ColumnName(fmt.Sprintf("#window%d", len(w.calls)-1))}, true
+		}
+		return e, false
+	})
+	return r, err
+}
+
+// CheckCall checks the arguments and window of window call, window calls
+// can't be nested.
+func (w *windowing) checkCall(f *ast.FuncCall) error {
+	if fn, ok := windowFuncs[f.Name]; ok {
+		if f.Star || len(f.Args) < fn.minArgs || len(f.Args) > fn.maxArgs {
+			return fmt.Errorf("%w: %s", ErrFuncArgsInvalid, f.Name)
+		}
+	} else if aggregates[f.Name] {
+		if (f.Star && f.Name != "count") || (!f.Star && len(f.Args) != 1) {
+			return fmt.Errorf("%w: %s", ErrFuncArgsInvalid, f.Name)
+		}
+	} else if _, ok := scalars[f.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrNotWindowFunc, f.Name)
+	} else {
+		return fmt.Errorf("%w: %s", ErrFuncNotExisted, f.Name)
+	}
+	exprs := append([]ast.Expr{}, f.Args...)
+	exprs = append(exprs, f.Over.PartitionBy...)
+	for _, k := range f.Over.OrderBy {
+		exprs = append(exprs, k.Expr)
+	}
+	for _, e := range exprs {
+		if err := w.scope.check(e); err != nil {
+			return err
+		}
+	}
+	_, _, err := frameOffsets(f.Over.Frame)
+	return err
+}
+
+// WindowScope returns the scope of windowed rows, the columns of rows are
+// followed by the results of window calls.
+func (w *windowing) windowScope() scope {
+	s := scope{}
+	for i, f := range w.calls {
+		s.tables = append(s.tables, "")
+		s.columns = append(s.columns, ast.ColumnName(fmt.Sprintf("#window%d", i)))
+		s.kinds = append(s.kinds, w.scope.kind(f))
+	}
+	return w.scope.join(s)
+}
+
+// Output computes window calls for rows, then sorts and outputs the windowed
+// rows like SELECT.
+func (w *windowing) output(stmt *ast.QueryStmtSelectValues, columns []ast.Column, rows []Row) (*Result, error) {
+	windowed := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		windowed = append(windowed, append(append(make(Row, 0, len(r)+len(w.calls)), r...), make(Row, len(w.calls))...))
+	}
+	for i, f := range w.calls {
+		results, err := w.compute(f, rows)
+		if err != nil {
+			return nil, err
+		}
+		for j, v := range results {
+			windowed[j][len(rows[j])+i] = v
+		}
+	}
+	ws := w.windowScope()
+	if err := ws.sort(windowed, w.keys); err != nil {
+		return nil, err
+	}
+	return ws.output(stmt, columns, w.outputs, w.on, windowed)
+}
+
+// Partition is the positions of rows in a partition sorted by the window,
+// peers are the ranges of rows whose sort keys are the same.
+type partition struct {
+	rows []int
+	// the start and end of peers of every row
+	peerStart []int
+	peerEnd   []int
+}
+
+// Compute returns the results of window call f for every row. The rows are
+// put into partitions in the order of their first rows, and sorted by the
+// window stably in every partition.
+func (w *windowing) compute(f *ast.FuncCall, rows []Row) ([]Field, error) {
+	partitions, err := w.partitions(f.Over, rows)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Field, len(rows))
+	for _, p := range partitions {
+		var err error
+		switch f.Name {
+		case "row_number", "rank", "dense_rank":
+			p.rank(f.Name, results)
+		case "lag", "lead":
+			err = w.shift(f, p, rows, results)
+		default:
+			err = w.frame(f, p, rows, results)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Partitions puts rows into partitions by hashing the values of PARTITION BY,
+// and sorts every partition by ORDER BY of window.
+func (w *windowing) partitions(spec *ast.WindowSpec, rows []Row) ([]*partition, error) {
+	s := w.scope
+	partitions := make([]*partition, 0)
+	hashed := make(map[string]*partition)
+	keys := make([][]interface{}, 0, len(rows))
+	for i, r := range rows {
+		values := make([]Field, 0, len(spec.PartitionBy))
+		for _, e := range spec.PartitionBy {
+			v, err := s.eval(e, r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		k := hashKey(values)
+		p, ok := hashed[k]
+		if !ok {
+			p = &partition{}
+			partitions = append(partitions, p)
+			hashed[k] = p
+		}
+		p.rows = append(p.rows, i)
+		sortKeys := make([]interface{}, 0, len(spec.OrderBy))
+		for _, o := range spec.OrderBy {
+			v, err := s.eval(o.Expr, r)
+			if err != nil {
+				return nil, err
+			}
+			sortKeys = append(sortKeys, v)
+		}
+		keys = append(keys, sortKeys)
+	}
+	var err error
+	compareRows := func(a, b int) int {
+		for k, key := range spec.OrderBy {
+			c, e := compareKey(keys[a][k], keys[b][k], key)
+			if e != nil && err == nil {
+				err = e
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	for _, p := range partitions {
+		sort.SliceStable(p.rows, func(i, j int) bool {
+			return compareRows(p.rows[i], p.rows[j]) < 0
+		})
+		n := len(p.rows)
+		p.peerStart, p.peerEnd = make([]int, n), make([]int, n)
+		for i := 0; i < n; i++ {
+			if i > 0 && compareRows(p.rows[i-1], p.rows[i]) == 0 {
+				p.peerStart[i] = p.peerStart[i-1]
+			} else {
+				p.peerStart[i] = i
+			}
+		}
+		for i := n - 1; i >= 0; i-- {
+			if i < n-1 && p.peerStart[i+1] == p.peerStart[i] {
+				p.peerEnd[i] = p.peerEnd[i+1]
+			} else {
+				p.peerEnd[i] = i + 1
+			}
+		}
+	}
+	return partitions, err
+}
+
+// Rank computes row_number, rank or dense_rank for the rows of partition,
+// peers have the same rank.
+func (p *partition) rank(name string, results []Field) {
+	dense := int64(0)
+	for i, r := range p.rows {
+		if p.peerStart[i] == i {
+			dense++
+		}
+		switch name {
+		case "row_number":
+			results[r] = int64(i + 1)
+		case "rank":
+			results[r] = int64(p.peerStart[i] + 1)
+		default:
+			results[r] = dense
+		}
+	}
+}
+
+// Shift computes lag or lead for the rows of partition, which is the value
+// of the row before or after current row by offset, or default if there
+// isn't such row. The offset is 1 and default is NULL if not specified.
+func (w *windowing) shift(f *ast.FuncCall, p *partition, rows []Row, results []Field) error {
+	s := w.scope
+	for i, r := range p.rows {
+		offset := int64(1)
+		if len(f.Args) > 1 {
+			v, err := s.eval(f.Args[1], rows[r])
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				results[r] = nil
+				continue
+			}
+			n, ok := v.(int64)
+			if !ok {
+				return fmt.Errorf("%w: %s(%T)", ErrFuncArgsInvalid, f.Name, v)
+			}
+			offset = n
+		}
+		if f.Name == "lag" {
+			offset = -offset
+		}
+		var v interface{}
+		var err error
+		if j := int64(i) + offset; j >= 0 && j < int64(len(p.rows)) {
+			v, err = s.eval(f.Args[0], rows[p.rows[j]])
+		} else if len(f.Args) > 2 {
+			v, err = s.eval(f.Args[2], rows[r])
+		}
+		if err != nil {
+			return err
+		}
+		results[r] = v
+	}
+	return nil
+}
+
+// Frame computes first_value or aggregate over the frame of every row of
+// partition. The aggregate accumulates rows as the frame grows if the frame
+// always starts from the first row, like running sum.
+func (w *windowing) frame(f *ast.FuncCall, p *partition, rows []Row, results []Field) error {
+	s := w.scope
+	frame := f.Over.Frame
+	start, end, err := frameOffsets(frame)
+	if err != nil {
+		return err
+	}
+	n := len(p.rows)
+	// bounds returns the range [from, to) of the frame of row i
+	bounds := func(i int) (from, to int) {
+		switch {
+		case frame != nil:
+			from, to = frameBound(frame.Start, start, i, n), frameBound(frame.End, end, i, n)+1
+		case len(f.Over.OrderBy) > 0:
+			from, to = 0, p.peerEnd[i]
+		default:
+			from, to = 0, n
+		}
+		if from < 0 {
+			from = 0
+		}
+		if to > n {
+			to = n
+		}
+		return from, to
+	}
+	values := make([]Field, 0, n)
+	for _, r := range p.rows {
+		var v interface{} = true
+		if !f.Star {
+			if v, err = s.eval(f.Args[0], rows[r]); err != nil {
+				return err
+			}
+		}
+		values = append(values, v)
+	}
+	if f.Name == "first_value" {
+		for i, r := range p.rows {
+			if from, to := bounds(i); from < to {
+				results[r] = values[from]
+			}
+		}
+		return nil
+	}
+	running := frame == nil || frame.Start.Kind == ast.FrameBoundUnboundedPreceding
+	agg, added := newAggregator(f.Name), 0
+	for i, r := range p.rows {
+		from, to := bounds(i)
+		if !running {
+			agg, added = newAggregator(f.Name), from
+		}
+		for ; added < to; added++ {
+			if err := agg.add(values[added]); err != nil {
+				return err
+			}
+		}
+		results[r] = agg.result()
+	}
+	return nil
+}
+
+// FrameOffsets returns the offsets of the start and end of frame, which are 0
+// unless they're n PRECEDING or n FOLLOWING.
+func frameOffsets(frame *ast.WindowFrame) (start, end int, err error) {
+	if frame == nil {
+		return 0, 0, nil
+	}
+	if frame.Start.Offset != nil {
+		if start, err = count(frame.Start.Offset, ErrFrameOffsetInvalid); err != nil {
+			return 0, 0, err
+		}
+	}
+	if frame.End.Offset != nil {
+		if end, err = count(frame.End.Offset, ErrFrameOffsetInvalid); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, end, nil
+}
+
+// FrameBound returns the position of bound b with offset for row i of the
+// partition of n rows, which could be out of the partition.
+func frameBound(b ast.FrameBound, offset, i, n int) int {
+	switch b.Kind {
+	case ast.FrameBoundUnboundedPreceding:
+		return 0
+	case ast.FrameBoundPreceding:
+		return i - offset
+	case ast.FrameBoundFollowing:
+		return i + offset
+	case ast.FrameBoundUnboundedFollowing:
+		return n - 1
+	}
+	return i
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestWindowFunctions(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testwindow1 (name text, city text, age int)",
+		"insert into testwindow1 values ('wang', 'bj', 18), ('li', 'sh', 20), ('zhao', 'bj', 20), ('qian', 'bj', 18), ('sun', 'sh', null)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"select name, row_number() over (order by name) from testwindow1", []Row{
+			{"wang", int64(4)}, {"li", int64(1)}, {"zhao", int64(5)}, {"qian", int64(2)}, {"sun", int64(3)},
+		}, nil},
+		{"select name, rank() over (order by age), dense_rank() over (order by age) from testwindow1 order by age, name", []Row{
+			{"qian", int64(1), int64(1)}, {"wang", int64(1), int64(1)}, {"li", int64(3), int64(2)}, {"zhao", int64(3), int64(2)}, {"sun", int64(5), int64(3)},
+		}, nil},
+		{"select name, row_number() over (partition by city order by age desc, name) from testwindow1 order by city, name", []Row{
+			{"qian", int64(2)}, {"wang", int64(3)}, {"zhao", int64(1)}, {"li", int64(2)}, {"sun", int64(1)},
+		}, nil},
+		// the frame of running sum includes the peers of current row
+		{"select name, sum(age) over (order by age) from testwindow1 where city = 'bj' order by age, name", []Row{
+			{"qian", int64(36)}, {"wang", int64(36)}, {"zhao", int64(56)},
+		}, nil},
+		{"select name, sum(age) over (order by age, name rows between unbounded preceding and current row) from testwindow1 where city = 'bj'", []Row{
+			{"wang", int64(36)}, {"zhao", int64(56)}, {"qian", int64(18)},
+		}, nil},
+		{"select name, count(*) over (partition by city), avg(age) over (partition by city) from testwindow1 where city = 'sh'", []Row{
+			{"li", int64(2), float64(20)}, {"sun", int64(2), float64(20)},
+		}, nil},
+		{"select name, max(age) over (order by name rows between 1 preceding and 1 following) from testwindow1 order by name", []Row{
+			{"li", int64(20)}, {"qian", int64(20)}, {"sun", int64(18)}, {"wang", int64(20)}, {"zhao", int64(20)},
+		}, nil},
+		{"select name, count(age) over (order by name rows 1 preceding) from testwindow1 order by name", []Row{
+			{"li", int64(1)}, {"qian", int64(2)}, {"sun", int64(1)}, {"wang", int64(1)}, {"zhao", int64(2)},
+		}, nil},
+		{"select name, lag(name) over (order by name), lead(age, 2, 0) over (order by name) from testwindow1 order by name", []Row{
+			{"li", nil, nil}, {"qian", "li", int64(18)}, {"sun", "qian", int64(20)}, {"wang", "sun", int64(0)}, {"zhao", "wang", int64(0)},
+		}, nil},
+		{"select name, first_value(name) over (partition by city order by age desc nulls last) from testwindow1 order by name", []Row{
+			{"li", "li"}, {"qian", "zhao"}, {"sun", "li"}, {"wang", "zhao"}, {"zhao", "zhao"},
+		}, nil},
+		{"select city, count(*), sum(count(*)) over (), rank() over (order by count(*) desc) from testwindow1 group by city", []Row{
+			{"bj", int64(3), int64(5), int64(1)}, {"sh", int64(2), int64(5), int64(2)},
+		}, nil},
+		{"select name from testwindow1 order by row_number() over (order by age desc nulls last) limit 2", []Row{{"li"}, {"zhao"}}, nil},
+		{"select distinct city, count(*) over (partition by city) from testwindow1 order by city", []Row{{"bj", int64(3)}, {"sh", int64(2)}}, nil},
+		{"select name from testwindow1 where row_number() over () > 1", nil, ErrWindowMisplaced},
+		{"select city from testwindow1 group by city having count(*) over () > 1", nil, ErrWindowMisplaced},
+		{"select sum(row_number() over ()) over () from testwindow1", nil, ErrWindowMisplaced},
+		{"select row_number() from testwindow1", nil, ErrOverRequired},
+		{"select upper(name) over () from testwindow1", nil, ErrNotWindowFunc},
+		{"select row_number(age) over () from testwindow1", nil, ErrFuncArgsInvalid},
+		{"select sum(age) over (rows between -1 preceding and current row) from testwindow1", nil, ErrFrameOffsetInvalid},
+		{"select rank() over (partition by nothing) from testwindow1", nil, ErrColumnNamesNotMatched},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := Select(stmt.(*ast.QueryStmtSelectValues))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+	}
+}
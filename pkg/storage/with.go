@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+var (
+	ErrCTEDuplicated        = errors.New("WITH query name specified more than once")
+	ErrCTEColumnsNotMatched = errors.New("WITH query has fewer columns than the specified column names")
+	ErrRecursiveCTEInvalid  = errors.New("recursive query must be of the form non-recursive-term UNION [ALL] recursive-term")
+	ErrRecursionTooDeep     = errors.New("recursive query exceeds the maximum depth")
+)
+
+// maxRecursionDepth is the maximum iterations of recursive WITH query, so the
+// query over cyclic rows with UNION ALL fails instead of running forever.
+const maxRecursionDepth = 1000
+
+// The rows of WITH queries by name, they're read as tables by the queries of
+// the statement with WITH clause.
+var ctes = make(map[string]Table)
+
+// QueryTable returns the table named name for reading by queries, the rows
+// of WITH query shadow the table with the same name. The tables modified by
+// INSERT, UPDATE and DELETE are never shadowed.
+func queryTable(name string) (Table, bool) {
+	if t, ok := ctes[name]; ok {
+		return t, true
+	}
+	t, ok := tables[name]
+	return t, ok
+}
+
+// With evaluates the queries of WITH clause in order and executes the
+// statement with their rows, the rows are dropped after executing.
+func With(stmt *ast.QueryStmtWith) (*Result, error) {
+	names := make(map[string]bool, len(stmt.CTEs))
+	defer func() {
+		for n := range names {
+			delete(ctes, n)
+		}
+	}()
+	for _, cte := range stmt.CTEs {
+		if names[cte.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrCTEDuplicated, cte.Name)
+		}
+		names[cte.Name] = true
+		var r *Result
+		var err error
+		if stmt.Recursive && refers(cte.Query, cte.Name) {
+			r, err = recursive(cte)
+		} else {
+			r, err = query(cte.Query)
+		}
+		if err != nil {
+			return nil, err
+		}
+		columns, err := cteColumns(cte, r.Columns)
+		if err != nil {
+			return nil, err
+		}
+		ctes[cte.Name] = cteTable(cte.Name, columns, r.Rows)
+	}
+	switch s := stmt.Stmt.(type) {
+	case ast.Query:
+		return query(s)
+	case *ast.QueryStmtInsertValues:
+		return Insert(s)
+	case *ast.QueryStmtUpdateValues:
+		return Update(s)
+	case *ast.QueryStmtDeleteValues:
+		return Delete(s)
+	}
+	return nil, parser.ErrQuerySyntaxInvalid
+}
+
+// Recursive evaluates recursive WITH query like PostgreSQL: the rows of
+// non-recursive term are the first working rows, then recursive term reads
+// the working rows by the name of query and returns the next ones until no
+// row is returned. All the rows are the result, and the duplicated rows are
+// removed without UNION ALL.
+func recursive(cte ast.CommonTableExpr) (*Result, error) {
+	o, ok := cte.Query.(*ast.QueryStmtSetOperation)
+	if !ok || o.Op != ast.SetOpUnion || refers(o.Left, cte.Name) || len(o.OrderBy) > 0 || o.Limit != nil || o.Offset != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRecursiveCTEInvalid, cte.Name)
+	}
+	left, err := query(o.Left)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := cteColumns(cte, left.Columns)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	// distinct removes the rows which have been returned without ALL
+	distinct := func(rows []Row) []Row {
+		if o.All {
+			return rows
+		}
+		kept := make([]Row, 0, len(rows))
+		for _, r := range rows {
+			if k := hashKey(r); !seen[k] {
+				seen[k] = true
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	}
+	rows := distinct(left.Rows)
+	working := rows
+	for depth := 0; len(working) > 0; depth++ {
+		if depth >= maxRecursionDepth {
+			return nil, fmt.Errorf("%w: %d", ErrRecursionTooDeep, maxRecursionDepth)
+		}
+		ctes[cte.Name] = cteTable(cte.Name, columns, working)
+		right, err := query(o.Right)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := combinedColumns(columns, right.Columns); err != nil {
+			return nil, err
+		}
+		working = distinct(cast(right.Rows, columns))
+		rows = append(rows, working...)
+	}
+	return selectedResult(left.Columns, rows), nil
+}
+
+// CteColumns returns the columns of WITH query, the first ones are renamed
+// by the column names of query in order.
+func cteColumns(cte ast.CommonTableExpr, columns []ast.Column) ([]ast.Column, error) {
+	if len(cte.Columns) > len(columns) {
+		return nil, fmt.Errorf("%w: %s", ErrCTEColumnsNotMatched, cte.Name)
+	}
+	renamed := make([]ast.Column, 0, len(columns))
+	for i, c := range columns {
+		if i < len(cte.Columns) {
+			c.Name = cte.Columns[i]
+		}
+		renamed = append(renamed, ast.Column{Name: c.Name, Kind: c.Kind})
+	}
+	return renamed, nil
+}
+
+// CteTable returns the table of the rows of WITH query, which only lives in
+// memory without index.
+func cteTable(name string, columns []ast.Column, rows []Row) Table {
+	t := Table{Name: name, Len: len(rows), Columns: columns, Nullable: true, Rows: rows}
+	t.setColumnNames()
+	return t
+}
+
+// Refers reports whether query q reads the table named name, including its
+// subqueries.
+func refers(q ast.Query, name string) bool {
+	found := false
+	var visit func(q ast.Query)
+	var fn func(e ast.Expr) (ast.Expr, bool)
+	fn = func(e ast.Expr) (ast.Expr, bool) {
+		switch e := e.(type) {
+		case *ast.SubqueryExpr:
+			visit(e.Query)
+			return e, true
+		case *ast.ExistsExpr:
+			visit(e.Query)
+			return e, true
+		case *ast.InExpr:
+			if e.Query != nil {
+				visit(e.Query)
+				ast.Transform(e.Expr, fn)
+				return e, true
+			}
+		}
+		return e, false
+	}
+	visit = func(q ast.Query) {
+		switch q := q.(type) {
+		case *ast.QueryStmtSetOperation:
+			visit(q.Left)
+			visit(q.Right)
+		case *ast.QueryStmtSelectValues:
+			found = found || q.TableName == name
+			for _, j := range q.Joins {
+				found = found || j.TableName == name
+			}
+			ast.TransformStmt(q, fn)
+		}
+	}
+	visit(q)
+	return found
+}
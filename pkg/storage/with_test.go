@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wangwalker/gpostgres/pkg/ast"
+	"github.com/wangwalker/gpostgres/pkg/parser"
+)
+
+func TestWith(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testwith1 (id int, name text, manager int)",
+		"insert into testwith1 values (1, 'ceo', null), (2, 'cto', 1), (3, 'cfo', 1), (4, 'dev', 2), (5, 'ops', 4)",
+		"create table testwith2 (a int, b int)",
+		"insert into testwith2 values (1, 2), (2, 3), (3, 1)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	tests := []struct {
+		source string
+		rows   []Row
+		err    error
+	}{
+		{"with m as (select * from testwith1 where manager = 1) select name from m order by id", []Row{{"cto"}, {"cfo"}}, nil},
+		{"with m (mid, mname) as (select id, name from testwith1 where manager = 1), n as (select mname from m where mid > 2) select * from n", []Row{{"cfo"}}, nil},
+		// WITH query shadows the table with the same name
+		{"with testwith2 as (select name from testwith1 where id = 1) select * from testwith2", []Row{{"ceo"}}, nil},
+		{"with m as (select id from testwith1 where manager is null) select name from testwith1 where manager in (select id from m)", []Row{{"cto"}, {"cfo"}}, nil},
+		{"with m as (select id, name from testwith1) select e.name, m.name from testwith1 e join m on e.manager = m.id where e.id = 5", []Row{{"ops", "dev"}}, nil},
+		{"with recursive t (n) as (select 1 from testwith2 where a = 1 union all select n + 1 from t where n < 5) select sum(n) from t", []Row{{int64(15)}}, nil},
+		// the subordinates of cto with their levels
+		{`with recursive sub (id, name, level) as (
+			select id, name, 1 from testwith1 where name = 'cto'
+			union all
+			select e.id, e.name, s.level + 1 from testwith1 e join sub s on e.manager = s.id
+		) select name, level from sub order by level`, []Row{{"cto", int64(1)}, {"dev", int64(2)}, {"ops", int64(3)}}, nil},
+		// the cycle stops with UNION because the rows have been returned
+		{"with recursive r (x) as (select a from testwith2 where a = 1 union select b from testwith2 join r on a = x) select x from r", []Row{{int64(1)}, {int64(2)}, {int64(3)}}, nil},
+		// RECURSIVE is ignored for the queries which don't read themselves
+		{"with recursive m as (select name from testwith1 where id = 2) select * from m", []Row{{"cto"}}, nil},
+		{"with recursive r (x) as (select a from testwith2 where a = 1 union all select b from testwith2 join r on a = x) select x from r", nil, ErrRecursionTooDeep},
+		{"with recursive r (x) as (select a from r) select x from r", nil, ErrRecursiveCTEInvalid},
+		{"with recursive r (x) as (select a from testwith2 union select x from r limit 1) select x from r", nil, ErrRecursiveCTEInvalid},
+		{"with recursive r (x) as (select a from testwith2 intersect select x from r) select x from r", nil, ErrRecursiveCTEInvalid},
+		{"with m (a, b) as (select name from testwith1) select * from m", nil, ErrCTEColumnsNotMatched},
+		{"with m as (select name from testwith1), m as (select id from testwith1) select * from m", nil, ErrCTEDuplicated},
+		{"with m as (select name from testwith1) select id from m", nil, ErrColumnNamesNotMatched},
+		{"with m as (select name from nothing) select * from m", nil, ErrTableNotExisted},
+	}
+
+	// THEN
+	for i, tt := range tests {
+		stmt, err := parser.Parse(tt.source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.source, err)
+		}
+		r, err := With(stmt.(*ast.QueryStmtWith))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("test %d should get err %v, but got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(r.Rows, tt.rows) {
+			t.Errorf("test %d should get rows %v, but got %v", i, tt.rows, r.Rows)
+		}
+		if len(ctes) > 0 {
+			t.Errorf("test %d should drop the rows of WITH queries, but got %v", i, ctes)
+		}
+	}
+}
+
+func TestWithManipulations(t *testing.T) {
+	// GIVEN
+	given := []string{
+		"create table testwith3 (id int, parent int, price int)",
+		"insert into testwith3 values (1, null, 0), (2, 1, 0), (3, 2, 0), (4, null, 0)",
+	}
+	for _, source := range given {
+		if _, err := exec(source); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// WHEN
+	manipulations := []string{
+		"with recursive tree (id) as (select id from testwith3 where id = 1 union select c.id from testwith3 c join tree on c.parent = tree.id) update testwith3 set price = 10 where id in (select id from tree)",
+		// the WITH query named by the updated table only shadows it in FROM clause
+		"with testwith3 as (select id from testwith3 where parent is null) update testwith3 t set price = price + 1 from testwith3 where t.id = testwith3.id",
+		"with leaf as (select id from testwith3 where id not in (select parent from testwith3 where parent is not null)) delete from testwith3 where id in (select id from leaf) and price = 1",
+	}
+	for _, source := range manipulations {
+		stmt, err := parser.Parse(source)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", source, err)
+		}
+		if _, err := With(stmt.(*ast.QueryStmtWith)); err != nil {
+			t.Fatalf("failed to exec %q: %v", source, err)
+		}
+	}
+
+	// THEN
+	rows := []Row{{int64(1), nil, int64(11)}, {int64(2), int64(1), int64(10)}, {int64(3), int64(2), int64(10)}}
+	if got := tables["testwith3"].Rows; !reflect.DeepEqual(got, rows) {
+		t.Errorf("rows should be %v, but got %v", rows, got)
+	}
+}